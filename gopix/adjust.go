@@ -0,0 +1,162 @@
+// Copyright (c) 2020, The gide / Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/goki/gi/gi"
+	"github.com/goki/gi/units"
+	"github.com/goki/ki/ki"
+	"github.com/goki/mat32"
+	"goki.dev/gopix/picinfo"
+)
+
+// adjustField is a tone or color adjustment in the adjustments panel
+type adjustField struct {
+
+	// label for the slider
+	Label string
+
+	// minimum value
+	Min float32
+
+	// maximum value
+	Max float32
+
+	// returns the value in given Edits
+	Val func(ed *picinfo.Edits) *float64
+}
+
+// adjustFields are the tone and color adjustments in the adjustments panel, in order
+var adjustFields = []adjustField{
+	{"Black", 0, 0.5, func(ed *picinfo.Edits) *float64 { return &ed.Black }},
+	{"White", 0, 0.5, func(ed *picinfo.Edits) *float64 { return &ed.White }},
+	{"Exposure", -5, 5, func(ed *picinfo.Edits) *float64 { return &ed.Exposure }},
+	{"Contrast", -1, 1, func(ed *picinfo.Edits) *float64 { return &ed.Contrast }},
+	{"Highlights", -1, 1, func(ed *picinfo.Edits) *float64 { return &ed.Highlights }},
+	{"Shadows", -1, 1, func(ed *picinfo.Edits) *float64 { return &ed.Shadows }},
+	{"Saturation", -1, 1, func(ed *picinfo.Edits) *float64 { return &ed.Saturation }},
+	{"Temp", -1, 1, func(ed *picinfo.Edits) *float64 { return &ed.Temp }},
+	{"Tint", -1, 1, func(ed *picinfo.Edits) *float64 { return &ed.Tint }},
+}
+
+// AdjustPanel returns the panel for the tone and color adjustments, beside the image
+func (iv *ImgView) AdjustPanel() *gi.Layout {
+	return iv.Parent().ChildByName("adjust", 1).(*gi.Layout)
+}
+
+// StartAdjust opens the adjustments panel, previewing the adjustments
+// on the image as they are changed
+func (iv *ImgView) StartAdjust() {
+	if iv.Info == nil || iv.Adjusting {
+		return
+	}
+	iv.ImgView.StartAdjust()
+	iv.ConfigCropBar() // closes it
+	iv.ConfigAdjustPanel()
+	iv.GrabFocus()
+}
+
+// ApplyAdjust closes the adjustments panel, saving the adjustments in the
+// Edits of the picture, in its metadata, and updating its thumbnail.
+// The image is then shown with them applied at full resolution.
+// As for all Edits, the original image data is not changed.
+func (iv *ImgView) ApplyAdjust() {
+	if !iv.Adjusting {
+		return
+	}
+	ed := iv.AdjustEdits
+	iv.EndAdjust()
+	iv.ConfigAdjustPanel()
+	iv.PixView.SetEdits(iv.Info, ed) // shows the result
+}
+
+// CancelAdjust closes the adjustments panel without changing the Edits
+func (iv *ImgView) CancelAdjust() {
+	iv.ImgView.CancelAdjust()
+	iv.ConfigAdjustPanel()
+}
+
+// ResetAdjust resets the adjustments being previewed to none
+func (iv *ImgView) ResetAdjust() {
+	iv.SetAdjustEdits(picinfo.Edits{})
+	iv.ConfigAdjustPanel()
+}
+
+// AutoLevels sets the black and white levels from the image histogram
+func (iv *ImgView) AutoLevels() {
+	iv.ImgView.AutoLevels()
+	iv.ConfigAdjustPanel()
+}
+
+// ConfigAdjustPanel configures the adjustments panel, with a slider for
+// each adjustment, which is empty unless adjusting
+func (iv *ImgView) ConfigAdjustPanel() {
+	ap := iv.AdjustPanel()
+	updt := ap.UpdateStart()
+	defer ap.UpdateEnd(updt)
+	ap.SetFullReRender()
+	ap.DeleteChildren(ki.DestroyKids)
+	if !iv.Adjusting {
+		return
+	}
+	ap.SetProp("spacing", gi.StdDialogVSpaceUnits)
+	tb := gi.AddNewToolbar(ap, "adjbar")
+	tb.AddAction(gi.ActOpts{Label: "Auto Levels", Icon: "update", Tooltip: "set the black and white levels from the histogram of the image, so its darkest and brightest tones become black and white"},
+		iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			ivv.AutoLevels()
+		})
+	tb.AddAction(gi.ActOpts{Label: "Reset", Icon: "reset", Tooltip: "reset all the adjustments to none"},
+		iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			ivv.ResetAdjust()
+		})
+	tb.AddSeparator("sep-apply")
+	tb.AddAction(gi.ActOpts{Label: "Apply", Icon: "file-save", Tooltip: "apply the adjustments, saving them in the edits of the image (Enter)"},
+		iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			ivv.ApplyAdjust()
+		})
+	tb.AddAction(gi.ActOpts{Label: "Cancel", Icon: "cancel", Tooltip: "cancel the adjustments, leaving the image as it was (Escape)"},
+		iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			ivv.CancelAdjust()
+		})
+
+	gr := gi.AddNewLayout(ap, "sliders", gi.LayoutGrid)
+	gr.SetProp("columns", 3)
+	gr.SetProp("spacing", gi.StdDialogVSpaceUnits)
+	for i, af := range adjustFields {
+		fi := i
+		val := *af.Val(&iv.AdjustEdits)
+		gi.AddNewLabel(gr, "lbl-"+af.Label, af.Label+":")
+		sl := gi.AddNewSlider(gr, af.Label)
+		sl.Defaults()
+		sl.Dim = mat32.X
+		sl.Min = af.Min
+		sl.Max = af.Max
+		sl.Step = (af.Max - af.Min) / 100
+		sl.PageStep = (af.Max - af.Min) / 10
+		sl.Prec = 3
+		sl.Tracking = true
+		sl.SetMinPrefWidth(units.NewEm(12))
+		sl.SetValue(float32(val))
+		vl := gi.AddNewLabel(gr, "val-"+af.Label, fmt.Sprintf("%.2f", val))
+		vl.SetMinPrefWidth(units.NewEm(3))
+		sl.SliderSig.Connect(iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			if sig != int64(gi.SliderValueChanged) {
+				return
+			}
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			v := float64(data.(float32))
+			vl.SetText(fmt.Sprintf("%.2f", v))
+			ed := ivv.AdjustEdits
+			*adjustFields[fi].Val(&ed) = v
+			ivv.SetAdjustEdits(ed)
+		})
+	}
+}
@@ -17,6 +17,8 @@ import (
 
 func main() {
 	oswin.TheApp.SetName("gopix")
+	Prefs.Defaults()
+	Prefs.Open()
 	oswin.TheApp.SetAbout(`<code>GoPix</code> Is a Go picture management system within the <b>Goki</b> tree framework.  See <a href="https://goki.dev/gopix">GoPix on GitHub</a>`)
 
 	// oswin.TheApp.SetQuitCleanFunc(func() {
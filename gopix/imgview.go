@@ -6,13 +6,17 @@ package main
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/goki/gi/gi"
 	"github.com/goki/gi/oswin"
 	"github.com/goki/gi/oswin/key"
+	"github.com/goki/gi/units"
 	"github.com/goki/ki/ki"
 	"github.com/goki/ki/kit"
+	"github.com/goki/mat32"
 	"goki.dev/gopix/imgview"
+	"goki.dev/gopix/picinfo"
 )
 
 // ImgView is gopix version of ImgView with keyboard navigation through list of images
@@ -31,10 +35,125 @@ func AddNewImgView(parent ki.Ki, name string) *ImgView {
 	return parent.AddNewChild(KiT_ImgView, name).(*ImgView)
 }
 
+// SetInfo sets the image info, ending the crop tool or adjustments if active
+func (iv *ImgView) SetInfo(pi *picinfo.Info) {
+	iv.ImgView.SetInfo(pi)
+	iv.ConfigCropBar()
+	iv.ConfigAdjustPanel()
+}
+
+// CropBar returns the toolbar for the crop tool, above the image
+func (iv *ImgView) CropBar() *gi.Toolbar {
+	return iv.Parent().Parent().ChildByName("cropbar", 0).(*gi.Toolbar)
+}
+
+// StartCrop starts the interactive crop and straighten tool, with the
+// crop toolbar for the aspect ratio and straighten angle
+func (iv *ImgView) StartCrop() {
+	if iv.Info == nil || iv.Cropping {
+		return
+	}
+	iv.ImgView.StartCrop()
+	iv.ConfigCropBar()
+	iv.ConfigAdjustPanel() // closes it
+	iv.GrabFocus()
+}
+
+// ApplyCrop ends the crop tool, applying the crop and straighten.
+// Jpeg files that are not straightened are cropped losslessly in their
+// image data, with the crop moved to start on the grid of Jpeg blocks
+// (see CropJpeg).  Otherwise the crop and straighten are saved in the
+// Edits of the picture, in its metadata, without changing the original
+// image data.  Updates its thumbnail.
+func (iv *ImgView) ApplyCrop() {
+	if !iv.Cropping {
+		return
+	}
+	ed := iv.CropEdits()
+	iv.EndCrop()
+	iv.ConfigCropBar()
+	if !ed.Crop.Empty() && ed.Straighten == 0 {
+		err := iv.PixView.CropJpeg(iv.Info, ed.Crop, ed) // shows the result
+		if err == nil {
+			return
+		}
+		if err != picinfo.ErrJpegNotLossless {
+			log.Println(err)
+		}
+	}
+	iv.PixView.SetEdits(iv.Info, ed) // shows the result
+}
+
+// CancelCrop ends the crop tool without changing the Edits
+func (iv *ImgView) CancelCrop() {
+	iv.ImgView.CancelCrop()
+	iv.ConfigCropBar()
+}
+
+// ConfigCropBar configures the crop toolbar, which is empty unless
+// the crop tool is active
+func (iv *ImgView) ConfigCropBar() {
+	tb := iv.CropBar()
+	updt := tb.UpdateStart()
+	defer tb.UpdateEnd(updt)
+	tb.SetFullReRender()
+	tb.DeleteChildren(ki.DestroyKids)
+	if !iv.Cropping {
+		return
+	}
+	gi.AddNewLabel(tb, "aspect-lbl", "Aspect:")
+	cb := gi.AddNewComboBox(tb, "aspect")
+	cb.ItemsFromStringList(imgview.CropAspectLabels(), false, 0)
+	cb.SelectItem(int(iv.CropAspect))
+	cb.ComboSig.Connect(iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+		ivv := recv.Embed(KiT_ImgView).(*ImgView)
+		ivv.SetCropAspect(imgview.CropAspects(sig))
+	})
+	tb.AddSeparator("sep-str")
+	gi.AddNewLabel(tb, "straighten-lbl", "Straighten:")
+	sl := gi.AddNewSlider(tb, "straighten")
+	sl.Defaults()
+	sl.Dim = mat32.X
+	sl.Min = -45
+	sl.Max = 45
+	sl.Step = 0.1
+	sl.PageStep = 1
+	sl.Prec = 3
+	sl.Tracking = true
+	sl.SetMinPrefWidth(units.NewEm(20))
+	sl.SetValue(float32(iv.Straighten))
+	vl := gi.AddNewLabel(tb, "straighten-val", fmt.Sprintf("%.1f°", iv.Straighten))
+	vl.SetMinPrefWidth(units.NewEm(4))
+	sl.SliderSig.Connect(iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+		if sig != int64(gi.SliderValueChanged) {
+			return
+		}
+		ivv := recv.Embed(KiT_ImgView).(*ImgView)
+		deg := float64(data.(float32))
+		vl.SetText(fmt.Sprintf("%.1f°", deg))
+		ivv.SetStraighten(deg)
+	})
+	tb.AddSeparator("sep-apply")
+	tb.AddAction(gi.ActOpts{Label: "Apply", Icon: "file-save", Tooltip: "apply the crop and straighten, saving them in the edits of the image (Enter)"},
+		iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			ivv.ApplyCrop()
+		})
+	tb.AddAction(gi.ActOpts{Label: "Cancel", Icon: "cancel", Tooltip: "cancel the crop and straighten, leaving the image as it was (Escape)"},
+		iv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			ivv := recv.Embed(KiT_ImgView).(*ImgView)
+			ivv.CancelCrop()
+		})
+}
+
 func (iv *ImgView) KeyInput(kt *key.ChordEvent) {
 	if gi.DebugSettings.KeyEventTrace {
 		fmt.Printf("ImgView KeyInput: %v\n", iv.Path())
 	}
+	if iv.Cropping || iv.Adjusting {
+		iv.EditKeyInput(kt)
+		return
+	}
 	switch kt.Chord() {
 	case "=":
 		kt.SetProcessed()
@@ -60,6 +179,10 @@ func (iv *ImgView) KeyInput(kt *key.ChordEvent) {
 	if kt.IsProcessed() {
 		return
 	}
+	iv.PixView.RatingKeys(kt)
+	if kt.IsProcessed() {
+		return
+	}
 	kf := keyfun.(kt.Chord())
 	switch kf {
 	case keyfun.ZoomIn:
@@ -81,6 +204,34 @@ func (iv *ImgView) KeyInput(kt *key.ChordEvent) {
 	}
 }
 
+// EditKeyInput handles keys while the crop tool or the adjustments panel
+// is active: Enter applies, Escape cancels, and zooming works as usual --
+// other keys are ignored, so the image can't be changed while editing
+func (iv *ImgView) EditKeyInput(kt *key.ChordEvent) {
+	switch kt.Chord() {
+	case "ReturnEnter", "KeypadEnter":
+		kt.SetProcessed()
+		if iv.Cropping {
+			iv.ApplyCrop()
+		} else {
+			iv.ApplyAdjust()
+		}
+	case "Escape":
+		kt.SetProcessed()
+		if iv.Cropping {
+			iv.CancelCrop()
+		} else {
+			iv.CancelAdjust()
+		}
+	case "+", "Shift++":
+		kt.SetProcessed()
+		iv.ZoomIn()
+	case "-", "Shift+-":
+		kt.SetProcessed()
+		iv.ZoomOut()
+	}
+}
+
 func (iv *ImgView) ConnectEvents2D() {
 	iv.ImgViewEvents()
 }
@@ -6,17 +6,19 @@ package main
 
 import (
 	"fmt"
+	"image"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/anthonynsimon/bild/transform"
 	"github.com/goki/gi/gi"
 	"github.com/goki/gi/giv"
 	"github.com/goki/gi/oswin"
+	"github.com/goki/gi/oswin/key"
 	"github.com/goki/gi/oswin/mouse"
 	"github.com/goki/ki/dirs"
 	"github.com/goki/ki/ki"
@@ -73,6 +75,12 @@ type PixView struct {
 
 	// parallel progress monitor
 	PProg *gi.ProgressBar `view:"-"`
+
+	// gazetteer for looking up place names -- opened when first needed
+	Gazetteer *picinfo.Gazetteer `view:"-"`
+
+	// gazetteer file that was last opened, or failed to open
+	GazetteerFile string `view:"-"`
 }
 
 var KiT_PixView = kit.Types.AddType(&PixView{}, PixViewProps)
@@ -157,10 +165,18 @@ func (pv *PixView) Config(imgdir string) {
 	ig.ImageMax = ThumbMaxSize
 	ig.Config(true)
 	ig.CtxtMenuFunc = pv.ImgGridCtxtMenu
-
-	pic := tv.AddNewTab(KiT_ImgView, "Current").(*ImgView)
+	ig.KeyFunc = pv.RatingKeys
+
+	cur := tv.AddNewTab(gi.KiT_Layout, "Current").(*gi.Layout)
+	cur.Lay = gi.LayoutVert
+	cur.SetStretchMax()
+	gi.AddNewToolbar(cur, "cropbar")
+	vlay := gi.AddNewLayout(cur, "viewlay", gi.LayoutHoriz)
+	vlay.SetStretchMax()
+	pic := AddNewImgView(vlay, "imgview")
 	pic.PixView = pv
 	pic.SetStretchMax()
+	gi.AddNewLayout(vlay, "adjust", gi.LayoutVert)
 
 	split.SetSplits(.1, .9)
 
@@ -247,7 +263,7 @@ func (pv *PixView) ImgGrid() *imgrid.ImgGrid {
 
 // CurImgView returns the ImgView for viewing the current file
 func (pv *PixView) CurImgView() *ImgView {
-	return pv.Tabs().TabByName("Current").(*ImgView)
+	return pv.Tabs().TabByName("Current").ChildByName("viewlay", 1).ChildByName("imgview", 0).(*ImgView)
 }
 
 // Toolbar returns the toolbar widget
@@ -356,6 +372,41 @@ func (pv *PixView) ImgGridCtxtMenu(m *gi.Menu, idx int) {
 			pv.SetCurFile(pi, idx)
 			giv.CallMethod(pv, "SetDateTakenCur", pv.Viewport)
 		})
+	m.AddAction(gi.ActOpts{Label: "Set Location", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			giv.CallMethod(pv, "SetLocationSel", pv.Viewport)
+		})
+	m.AddAction(gi.ActOpts{Label: "Clear Location", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			giv.CallMethod(pv, "ClearLocationSel", pv.Viewport)
+		})
+	m.AddAction(gi.ActOpts{Label: "Add Keywords", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			giv.CallMethod(pv, "AddKeywordsSel", pv.Viewport)
+		})
+	m.AddAction(gi.ActOpts{Label: "Remove Keywords", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			giv.CallMethod(pv, "RemoveKeywordsSel", pv.Viewport)
+		})
+	m.AddAction(gi.ActOpts{Label: "Edit", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			pv.SetCurFile(pi, idx)
+			pv.EditCur()
+		})
+	m.AddAction(gi.ActOpts{Label: "Crop", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			pv.SetCurFile(pi, idx)
+			pv.CropCur()
+		})
+	m.AddAction(gi.ActOpts{Label: "Adjust", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			pv.SetCurFile(pi, idx)
+			pv.AdjustCur()
+		})
+	m.AddAction(gi.ActOpts{Label: "Revert to Original", Data: idx},
+		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+			giv.CallMethod(pv, "RevertSel", pv.Viewport)
+		})
 	m.AddSeparator("clip")
 	m.AddAction(gi.ActOpts{Label: "Copy", Data: idx},
 		pv.This(), func(recv, send ki.Ki, sig int64, data any) {
@@ -405,6 +456,7 @@ func (pv *PixView) RenameFile(oldnm, newnm string) {
 	aofn := filepath.Join(adir, oldnm)
 	anfn := filepath.Join(adir, newnm)
 	os.Rename(aofn, anfn)
+	MoveSidecar(aofn, anfn)
 
 	sf := filepath.Join("../All", newnm)
 	for i, fld := range pv.Folders {
@@ -473,6 +525,7 @@ func (pv *PixView) TrashFiles(files picinfo.Pics) {
 		if err != nil {
 			log.Println(err)
 		}
+		MoveSidecar(afn, tfn)
 		pv.DeleteFromFolders(fn)
 	}
 }
@@ -500,6 +553,20 @@ func (pv *PixView) UntrashFiles(files picinfo.Pics) {
 		if err != nil {
 			log.Println(err)
 		}
+		MoveSidecar(tfn, afn)
+	}
+}
+
+// MoveSidecar moves the XMP sidecar file for given image file, if it exists,
+// to go along with the image file moving from ofn to nfn.
+func MoveSidecar(ofn, nfn string) {
+	osc := picinfo.SidecarFile(ofn)
+	if _, err := os.Stat(osc); err != nil {
+		return
+	}
+	err := os.Rename(osc, picinfo.SidecarFile(nfn))
+	if err != nil {
+		log.Println(err)
 	}
 }
 
@@ -605,6 +672,9 @@ func (pv *PixView) Duplicate(pi *picinfo.Info) error {
 	npi.Number = n
 	npi.SetFileThumbFmBase(nfn, adir, tdir)
 	giv.CopyFile(npi.File, pi.File, 0664)
+	if picinfo.HasSidecar(pi.File) {
+		giv.CopyFile(picinfo.SidecarFile(npi.File), picinfo.SidecarFile(pi.File), 0664)
+	}
 	npi.UpdateFileMod()
 	giv.CopyFile(npi.Thumb, pi.Thumb, 0664)
 	pv.AllInfo[nfn] = npi
@@ -735,8 +805,109 @@ func (pv *PixView) MapFile(pi *picinfo.Info) {
 	oswin.TheApp.OpenURL(url)
 }
 
-// SaveExifSel saves updated Exif information for currently selected files.
-// This will change file type if it is not already a Jpeg as that is only supported type.
+// CameraStats shows the number of pictures in the current folder
+// taken with each camera and lens
+func (pv *PixView) CameraStats() {
+	var b strings.Builder
+	b.WriteString("<b>Cameras</b><br>\n")
+	for _, nc := range pv.Info.CountBy(picinfo.CameraName) {
+		fmt.Fprintf(&b, "%d\t%s<br>\n", nc.Count, nc.Name)
+	}
+	b.WriteString("<br>\n<b>Lenses</b><br>\n")
+	for _, nc := range pv.Info.CountBy(picinfo.LensName) {
+		fmt.Fprintf(&b, "%d\t%s<br>\n", nc.Count, nc.Name)
+	}
+	gi.PromptDialog(nil, gi.DlgOpts{Title: "Camera Stats: " + pv.Folder, Prompt: b.String()}, gi.AddOk, gi.NoCancel, nil, nil)
+}
+
+// PlaceStats shows the number of pictures in the current folder
+// taken in each country and place
+func (pv *PixView) PlaceStats() {
+	var b strings.Builder
+	b.WriteString("<b>Countries</b><br>\n")
+	for _, nc := range pv.Info.CountBy(picinfo.CountryName) {
+		fmt.Fprintf(&b, "%d\t%s<br>\n", nc.Count, nc.Name)
+	}
+	b.WriteString("<br>\n<b>Places</b><br>\n")
+	for _, nc := range pv.Info.CountBy(picinfo.PlaceName) {
+		fmt.Fprintf(&b, "%d\t%s<br>\n", nc.Count, nc.Name)
+	}
+	gi.PromptDialog(nil, gi.DlgOpts{Title: "Place Stats: " + pv.Folder, Prompt: b.String()}, gi.AddOk, gi.NoCancel, nil, nil)
+}
+
+// SortByPlace sorts the pictures in the current folder by place and then
+// date taken -- this lasts until the folder is updated
+func (pv *PixView) SortByPlace() {
+	pv.Info.SortByKey(picinfo.PlaceName, true)
+	pv.Thumbs = pv.Info.Thumbs()
+	pv.ImgGrid().SetImages(pv.Thumbs, true)
+}
+
+// FilterByPlace shows only the pictures in the current folder whose place
+// name (country, region, city) contains given text, ignoring case --
+// this lasts until the folder is updated
+func (pv *PixView) FilterByPlace(place string) {
+	place = strings.ToLower(strings.TrimSpace(place))
+	pv.Info = pv.Info.Filter(func(pi *picinfo.Info) bool {
+		return strings.Contains(strings.ToLower(pi.Place.Name()), place)
+	})
+	pv.Thumbs = pv.Info.Thumbs()
+	pv.ImgGrid().SetImages(pv.Thumbs, true)
+}
+
+// OpenGazetteer returns the gazetteer from the file in Prefs, opening
+// it if not already open -- nil if it can't be opened, which is only
+// reported once for each file.
+func (pv *PixView) OpenGazetteer() *picinfo.Gazetteer {
+	fn := string(Prefs.Gazetteer)
+	if pv.GazetteerFile == fn {
+		return pv.Gazetteer
+	}
+	pv.GazetteerFile = fn
+	gz, err := picinfo.OpenGazetteer(fn)
+	if err != nil {
+		log.Printf("place names not available: %v\n", err)
+	}
+	pv.Gazetteer = gz
+	return gz
+}
+
+// UpdatePlaces looks up the place names of given pictures if their GPS
+// location has changed since last looked up
+func (pv *PixView) UpdatePlaces(pics picinfo.Pics) {
+	for _, pi := range pics {
+		if !pi.NeedsPlace() {
+			continue
+		}
+		var gz *picinfo.Gazetteer
+		if pi.HasGPS() {
+			if gz = pv.OpenGazetteer(); gz == nil {
+				return
+			}
+		}
+		pi.SetPlace(gz, Prefs.PlaceMaxKm)
+	}
+}
+
+// EditPrefs edits the GoPix preferences, which are saved when the dialog is closed with Ok
+func (pv *PixView) EditPrefs() {
+	giv.StructViewDialog(pv.Viewport, &Prefs, giv.DlgOpts{Title: "GoPix Preferences"}, pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+		if sig == int64(gi.DialogAccepted) {
+			Prefs.Save()
+		}
+	})
+}
+
+// SortByCamera sorts the pictures in the current folder by camera and then
+// date taken -- this lasts until the folder is updated
+func (pv *PixView) SortByCamera() {
+	pv.Info.SortByKey(picinfo.CameraName, true)
+	pv.Thumbs = pv.Info.Thumbs()
+	pv.ImgGrid().SetImages(pv.Thumbs, true)
+}
+
+// SaveExifSel saves updated metadata for currently selected files.
+// Jpeg, Png and Tiff files are updated in place, and other formats use an XMP sidecar file.
 func (pv *PixView) SaveExifSel() {
 	pv.UpdtMu.Lock()
 	defer pv.UpdtMu.Unlock()
@@ -766,27 +937,60 @@ func (pv *PixView) RenameAsJpeg(pi *picinfo.Info) {
 	pv.RenameFile(fnb, nfn)
 	adir := filepath.Join(pv.ImageDir, "All")
 	pi.File = filepath.Join(adir, nfn)
+	pi.Ext = ".jpg"
+	pi.Sup = filecat.Jpeg
 }
 
-// SaveExifFile saves updated Exif information for given file.
-// This will change file type if it is not already a Jpeg as that is only supported type.
-// This calls GetFolderFiles() if FolderFiles is empty -- can reset that to nil in an outer loop
+// SaveExifFile saves updated metadata for given file, using picinfo.SaveMeta:
+// Jpeg, Png and Tiff files are updated in place, and other formats use an XMP sidecar file,
+// so the image data is never re-encoded.  Regenerates the thumbnail.
 func (pv *PixView) SaveExifFile(pi *picinfo.Info) error {
-	if pi.Sup != filecat.Jpeg {
-		fmt.Printf("Note: changing file to Jpeg instead of %s\n", pi.Sup.String())
-		img, err := picinfo.OpenImage(pi.File)
-		if err != nil {
-			log.Println(err)
-			return err
+	err := pi.SaveMeta()
+	pv.ThumbGen(pi)
+	return err
+}
+
+// SaveOrient saves the updated Orient of given file.  Jpeg files are
+// transformed losslessly to display as is, unless the JpegOrientMeta
+// preference is set.  If that is not possible, because the image size
+// is not a whole number of Jpeg blocks, the image is only re-encoded with
+// the orientation applied (see SaveOrientImage) if the JpegOrientReencode
+// preference is set.  Otherwise the orientation metadata is saved
+// (see SaveExifFile).  Regenerates the thumbnail.
+func (pv *PixView) SaveOrient(pi *picinfo.Info) error {
+	if Prefs.JpegOrientMeta || pi.Sup != filecat.Jpeg {
+		return pv.SaveExifFile(pi)
+	}
+	err := pi.SaveJpegTransformed(image.Rectangle{})
+	if err == picinfo.ErrJpegNotLossless {
+		if !Prefs.JpegOrientReencode {
+			return pv.SaveExifFile(pi)
 		}
-		pv.RenameAsJpeg(pi)
-		pi.Size = img.Bounds().Size()
-		err = pi.SaveJpegNew(img)
-		pv.ThumbGen(pi)
-		return err
+		err = pv.SaveOrientImage(pi)
+	}
+	if err != nil {
+		log.Println(err)
+		return pv.SaveExifFile(pi) // the orientation is still saved
 	}
-	err := pi.SaveJpegUpdated()
 	pv.ThumbGen(pi)
+	return nil
+}
+
+// SaveOrientImage re-encodes the image of given file with its Orient
+// applied, so it displays as is, with the SaveOpts preferences,
+// preserving the metadata.  The Orient is then Rotated0.
+func (pv *PixView) SaveOrientImage(pi *picinfo.Info) error {
+	img, err := picinfo.OpenImage(pi.File)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	or := pi.Orient
+	pi.Orient = picinfo.Rotated0 // orientation is now baked into the image
+	err = pi.SaveUpdatedImage(picinfo.OrientImage(img, or), &Prefs.SaveOpts)
+	if err != nil {
+		pi.Orient = or
+	}
 	return err
 }
 
@@ -800,11 +1004,49 @@ func (pv *PixView) RotateRightSel() {
 	pv.RotateSel(90)
 }
 
+// FlipHSel flips (mirrors) selected images horizontally, left to right
+func (pv *PixView) FlipHSel() {
+	pv.FlipSel(true)
+}
+
+// FlipVSel flips (mirrors) selected images vertically, top to bottom
+func (pv *PixView) FlipVSel() {
+	pv.FlipSel(false)
+}
+
+// FlipSel flips selected images horizontally (horiz) or vertically, through
+// the Orientation, which is applied to the image data of Jpeg files, and
+// otherwise saved in the metadata (see SaveOrient).
+func (pv *PixView) FlipSel(horiz bool) {
+	pv.UpdtMu.Lock()
+	defer pv.UpdtMu.Unlock()
+
+	pis := pv.CheckSel()
+	n := len(pis)
+	if n == 0 {
+		return
+	}
+	pv.PProg.Start(len(pis))
+	for _, pi := range pis {
+		or := pi.Orient
+		if horiz {
+			pi.Orient = pi.Orient.FlipH()
+		} else {
+			pi.Orient = pi.Orient.FlipV()
+		}
+		pi.Edits.Reorient(or, pi.Orient, pi.Size)
+		pv.SaveOrient(pi) // does thumbgen
+		pv.PProg.ProgStep()
+	}
+	pv.FolderFiles = nil
+	pv.DirInfo(false) // update -- also saves updated info
+}
+
 // RotateSel rotates selected images by given number of degrees (+ = right, - = left).
-// +/- 90 and 180 are special cases:
-// If a Jpeg file, rotation is done through the Orientation Exif
-// setting, otherwise it is manually rotated and saved, except if it is an Heic file
-// which must be converted to jpeg at this point..
+// Multiples of 90 are special cases, done through the Orientation (see SaveOrient).
+// Otherwise the image is manually rotated and saved with the Save preferences,
+// preserving metadata for Jpeg, Png and Tiff, except if it is an Heic file which
+// must be converted to jpeg at this point..
 func (pv *PixView) RotateSel(deg float32) {
 	pv.UpdtMu.Lock()
 	defer pv.UpdtMu.Unlock()
@@ -824,40 +1066,222 @@ func (pv *PixView) RotateSel(deg float32) {
 }
 
 // RotateImage rotates image by given number of degrees (+ = right, - = left).
-// +/- 90 and 180 are special cases:
-// If a Jpeg file, rotation is done through the Orientation Exif
-// setting, otherwise it is manually rotated and saved, except if it is an Heic file
-// which must be converted to jpeg at this point..
+// Multiples of 90 are special cases, done through the Orientation (see SaveOrient).
+// Otherwise the image is manually rotated and saved with the Save preferences,
+// preserving metadata for Jpeg, Png and Tiff, except if it is an Heic file which
+// must be converted to jpeg at this point..
+// Camera RAW files can only be rotated by the Orientation.
 func (pv *PixView) RotateImage(pi *picinfo.Info, deg float32) error {
-	non90 := deg != 90 && deg != -90 && deg != 180
-	if non90 || pi.Sup != filecat.Jpeg {
+	non90 := deg != float32(int(deg)) || int(deg)%90 != 0
+	if non90 && picinfo.IsRaw(pi.File) {
+		err := fmt.Errorf("RotateImage: RAW file can only be rotated in 90 degree steps: %s", pi.File)
+		log.Println(err)
+		return err
+	}
+	if non90 {
 		img, err := picinfo.OpenImage(pi.File)
 		if err != nil {
 			log.Println(err)
 			return err
 		}
+		or, sz := pi.Orient, pi.Size
 		img = picinfo.OrientImage(img, pi.Orient)
-		opts := &transform.RotationOptions{ResizeBounds: true}
-		img = transform.Rotate(img, float64(deg), opts)
+		img = picinfo.RotateImage(img, float64(deg))
+		pi.Orient = picinfo.Rotated0 // orientation is now baked into the image
+		pi.Size = img.Bounds().Size()
 		switch pi.Sup {
-		case filecat.Jpeg:
-			rawExif, _ := picinfo.OpenRawExif(pi.File)
-			pi.SaveJpegUpdatedExif(rawExif, img)
 		case filecat.Heic:
-			rawExif, _ := picinfo.OpenRawExif(pi.File)
+			rm, _ := picinfo.OpenRawMeta(pi.File)
 			pv.RenameAsJpeg(pi)
-			pi.SaveJpegUpdatedExif(rawExif, img)
+			if rm == nil {
+				rm = &picinfo.RawMeta{}
+			}
+			pi.SaveJpegUpdatedExif(rm.Exif, img, &Prefs.SaveOpts)
+			if rm.ICC != nil {
+				pi.SaveJpegICC(rm.ICC)
+			}
 		default:
-			picinfo.SaveImage(pi.File, img) // todo: need exif support for other formats..
+			if err := pi.SaveUpdatedImage(img, &Prefs.SaveOpts); err != nil {
+				log.Println(err)
+				pi.Orient, pi.Size = or, sz
+				return err
+			}
 		}
 		pv.ThumbGen(pi)
 	} else {
+		or := pi.Orient
 		pi.Orient = pi.Orient.Rotate(int(deg))
-		pv.SaveExifFile(pi) // does thumbgen
+		pi.Edits.Reorient(or, pi.Orient, pi.Size)
+		pv.SaveOrient(pi) // does thumbgen
+	}
+	return nil
+}
+
+// EditCur edits the Edits of the current file (last selected), which are
+// saved in its metadata when the dialog is closed with Ok, and applied
+// whenever it is shown.  The original image data is never changed: use
+// RevertSel to go back to the original, and ExportSel to save the result.
+func (pv *PixView) EditCur() {
+	pi := pv.CheckCur()
+	if pi == nil {
+		return
+	}
+	ed := pi.Edits
+	giv.StructViewDialog(pv.Viewport, &ed, giv.DlgOpts{Title: "Edits: " + pi.File}, pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+		if sig == int64(gi.DialogAccepted) {
+			pv.SetEdits(pi, ed)
+		}
+	})
+}
+
+// CropCur starts the interactive crop and straighten tool on the current
+// file (last selected), in the Current view.  The crop and straighten are
+// applied with ImgView.ApplyCrop.
+func (pv *PixView) CropCur() {
+	pi := pv.CheckCur()
+	if pi == nil {
+		return
+	}
+	iv := pv.CurImgView()
+	if iv.Info != pi {
+		pv.ViewFile(pi, pv.CurIdx)
+	} else {
+		pv.Tabs().SelectTabByName("Current")
+	}
+	iv.StartCrop()
+}
+
+// AdjustCur opens the tone and color adjustments panel for the current
+// file (last selected), beside it in the Current view, with a preview of
+// the adjustments.  They are saved in its Edits when applied, as in EditCur,
+// and applied at full resolution whenever it is shown or exported.
+func (pv *PixView) AdjustCur() {
+	pi := pv.CheckCur()
+	if pi == nil {
+		return
+	}
+	iv := pv.CurImgView()
+	if iv.Info != pi {
+		pv.ViewFile(pi, pv.CurIdx)
+	} else {
+		pv.Tabs().SelectTabByName("Current")
+	}
+	iv.StartAdjust()
+}
+
+// SetEdits sets the Edits of given file, saving them in its metadata,
+// and updates its thumbnail and the current view if showing it.
+func (pv *PixView) SetEdits(pi *picinfo.Info, ed picinfo.Edits) {
+	pv.UpdtMu.Lock()
+	defer pv.UpdtMu.Unlock()
+
+	ed.Crop = ed.Crop.Canon()
+	pi.Edits = ed
+	pv.SaveExifFile(pi) // does thumbgen
+	pv.DirInfo(false)   // update -- also saves updated info
+	pv.EditsUpdated(pi)
+}
+
+// CropJpeg crops the image data of given Jpeg file losslessly to given
+// rectangle in the oriented image, moved to start on the grid of Jpeg
+// blocks (see SnapJpegCrop), and sets its other Edits, which must not
+// straighten it, saving them in its metadata.  Updates its thumbnail and
+// the current view if showing it.  Returns ErrJpegNotLossless if it cannot
+// be done losslessly, in which case nothing is changed.
+func (pv *PixView) CropJpeg(pi *picinfo.Info, crop image.Rectangle, ed picinfo.Edits) error {
+	pv.UpdtMu.Lock()
+	defer pv.UpdtMu.Unlock()
+
+	if pi.Sup != filecat.Jpeg || ed.Straighten != 0 {
+		return picinfo.ErrJpegNotLossless
+	}
+	crop, err := pi.SnapJpegCrop(crop)
+	if err != nil {
+		return err
+	}
+	oed := pi.Edits
+	pi.Edits = ed
+	pi.Edits.Crop = image.Rectangle{}
+	err = pi.SaveJpegTransformed(crop)
+	if err != nil {
+		pi.Edits = oed
+		return err
+	}
+	pv.ThumbGen(pi)
+	pv.DirInfo(false) // update -- also saves updated info
+	iv := pv.CurImgView()
+	if iv.Info == pi {
+		iv.SetInfo(pi) // image data has changed
 	}
 	return nil
 }
 
+// EditsUpdated updates the current view if it is showing given file,
+// after its Edits have changed
+func (pv *PixView) EditsUpdated(pi *picinfo.Info) {
+	iv := pv.CurImgView()
+	if iv.Info == pi {
+		iv.ApplyEdits()
+	}
+}
+
+// RevertSel reverts selected images to their originals, removing all of their Edits
+func (pv *PixView) RevertSel() {
+	pv.UpdtMu.Lock()
+	defer pv.UpdtMu.Unlock()
+
+	pis := pv.CheckSel()
+	n := len(pis)
+	if n == 0 {
+		return
+	}
+	pv.PProg.Start(len(pis))
+	for _, pi := range pis {
+		if !pi.Edits.IsZero() {
+			pi.Edits = picinfo.Edits{}
+			pv.SaveExifFile(pi) // does thumbgen
+			pv.EditsUpdated(pi)
+		}
+		pv.PProg.ProgStep()
+	}
+	pv.FolderFiles = nil
+	pv.DirInfo(false) // update -- also saves updated info
+}
+
+// ExportSel saves selected images with their Edits applied to given
+// directory, using the Save options in the preferences, with the same
+// file names.  Formats that cannot be saved (e.g., HEIC and camera RAW)
+// are saved as Jpeg.  The originals are not changed.
+func (pv *PixView) ExportSel(dir gi.FileName) {
+	pis := pv.CheckSel()
+	n := len(pis)
+	if n == 0 {
+		return
+	}
+	edir := string(dir)
+	if st, err := os.Stat(edir); err == nil && !st.IsDir() {
+		edir = filepath.Dir(edir)
+	}
+	pv.PProg.Start(len(pis))
+	for _, pi := range pis {
+		fnext, ext := dirs.SplitExt(filepath.Base(pi.File))
+		switch {
+		case picinfo.IsRaw(pi.File):
+			ext = ".jpg"
+		case pi.Sup == filecat.Jpeg, pi.Sup == filecat.Png, pi.Sup == filecat.Tiff, pi.Sup == filecat.Gif, pi.Sup == filecat.Bmp:
+		default:
+			ext = ".jpg"
+		}
+		efn := filepath.Join(edir, fnext+ext)
+		if efn == pi.File {
+			log.Printf("File: %s not exported over itself\n", pi.File)
+		} else {
+			pi.ExportEdited(efn, &Prefs.SaveOpts)
+		}
+		pv.PProg.ProgStep()
+	}
+}
+
 // SetDateTakenSel sets the DateTaken for selected items, with given day and minute increments between each
 func (pv *PixView) SetDateTakenSel(date time.Time, dayInc int, minInc int) {
 	pv.UpdtMu.Lock()
@@ -894,13 +1318,260 @@ func (pv *PixView) SetDateTakenCur(date time.Time) error {
 	return err
 }
 
-// SetDateTaken sets the DateTaken for the given image and saves updated Exif metadata.
-// Saving the exif requires conversion of non-jpeg format files to Jpeg format.
+// SetDateTaken sets the DateTaken for the given image and saves updated metadata
+// (Exif for Jpeg, Png and Tiff, XMP sidecar for other formats).
+// The date is the local wall-clock time where the picture was taken,
+// so any known time zone of the picture is kept.
 func (pv *PixView) SetDateTaken(pi *picinfo.Info, date time.Time) error {
-	pi.DateTaken = date
+	pi.DateTaken = picinfo.WallClockIn(date, pi.DateTaken.Location())
 	return pv.SaveExifFile(pi)
 }
 
+// AddKeywordsSel adds given keywords (separated by commas or semicolons)
+// to selected images, and saves the updated metadata.  Keywords can be
+// hierarchical, with levels separated by | e.g., Family|Kids|Anna
+func (pv *PixView) AddKeywordsSel(keywords string) {
+	kws := picinfo.ParseKeywords(keywords)
+	if len(kws) == 0 {
+		return
+	}
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		chg := false
+		for _, kw := range kws {
+			chg = pi.AddKeyword(kw) || chg
+		}
+		return chg
+	})
+}
+
+// RemoveKeywordsSel removes given keywords (separated by commas or semicolons)
+// from selected images, including any more specific keywords under them,
+// and saves the updated metadata.
+func (pv *PixView) RemoveKeywordsSel(keywords string) {
+	kws := picinfo.ParseKeywords(keywords)
+	if len(kws) == 0 {
+		return
+	}
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		chg := false
+		for _, kw := range kws {
+			chg = pi.RemoveKeyword(kw) || chg
+		}
+		return chg
+	})
+}
+
+// EditMetaSel calls given function on selected images to edit their
+// metadata, saving the metadata of those that it reports as changed.
+func (pv *PixView) EditMetaSel(fun func(pi *picinfo.Info) bool) {
+	pv.UpdtMu.Lock()
+	defer pv.UpdtMu.Unlock()
+
+	pis := pv.CheckSel()
+	n := len(pis)
+	if n == 0 {
+		return
+	}
+	pv.PProg.Start(len(pis))
+	for _, pi := range pis {
+		if fun(pi) {
+			pv.SaveExifFile(pi)
+		}
+		pv.PProg.ProgStep()
+	}
+	pv.FolderFiles = nil
+	pv.DirInfo(false) // update -- also saves updated info
+}
+
+// SetLocationSel sets the GPS location of selected images, and saves the
+// updated metadata.  The location can be given as decimal degrees, e.g.,
+// 37.7749, -122.4194 (as copied from most maps), or degrees, minutes and
+// seconds, e.g., 37°46'29.6"N 122°25'9.8"W, optionally followed by a comma
+// and the altitude in meters.  Use ClearLocationSel to remove the location.
+func (pv *PixView) SetLocationSel(location string) error {
+	loc, err := picinfo.ParseGPSCoord(location)
+	if err != nil {
+		log.Println(err)
+		gi.PromptDialog(nil, gi.DlgOpts{Title: "Invalid Location", Prompt: err.Error()}, gi.AddOk, gi.NoCancel, nil, nil)
+		return err
+	}
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		return pi.SetGPSLoc(loc)
+	})
+	return nil
+}
+
+// ClearLocationSel removes all GPS info from selected images, and saves the
+// updated metadata.  For formats using an XMP sidecar, any GPS info embedded
+// in the original file is not changed, but it is marked as cleared in the
+// sidecar, so it is no longer used.
+func (pv *PixView) ClearLocationSel() {
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		return pi.ClearGPS()
+	})
+}
+
+// GeotagGPXSel sets the GPS location of selected images from given GPX
+// track log file, by matching their DateTaken against the track, with the
+// location interpolated between track points.  clockOffSecs is added to
+// the DateTaken to correct for the camera clock, e.g., -60 if the camera
+// is a minute fast, or -3600 for a camera set to local time one hour ahead
+// of the time zone of its pictures.  Images more than maxGapMins away from
+// the track are not matched.  If dryRun, the matches are only reported,
+// and no metadata is saved.
+func (pv *PixView) GeotagGPXSel(gpxFile gi.FileName, clockOffSecs int, maxGapMins int, dryRun bool) {
+	tr, err := picinfo.OpenGPX(string(gpxFile))
+	if err != nil {
+		log.Println(err)
+		gi.PromptDialog(nil, gi.DlgOpts{Title: "GPX Open Error", Prompt: err.Error()}, gi.AddOk, gi.NoCancel, nil, nil)
+		return
+	}
+	off := time.Duration(clockOffSecs) * time.Second
+	maxGap := time.Duration(maxGapMins) * time.Minute
+	var matched, unmatched strings.Builder
+	nmatch, nunmatch := 0, 0
+	geotag := func(pi *picinfo.Info) bool {
+		dt := pi.DateTaken.Add(off)
+		loc, ok := tr.LocAt(dt, maxGap)
+		if !ok {
+			nunmatch++
+			fmt.Fprintf(&unmatched, "%s\t%s<br>\n", filepath.Base(pi.File), dt.Format("2006-01-02 15:04:05 -07:00"))
+			return false
+		}
+		nmatch++
+		fmt.Fprintf(&matched, "%s\t%.6f, %.6f<br>\n", filepath.Base(pi.File), loc.Lat, loc.Long)
+		if dryRun {
+			return false
+		}
+		return pi.SetGPSLoc(loc)
+	}
+	if dryRun {
+		for _, pi := range pv.CheckSel() {
+			geotag(pi)
+		}
+	} else {
+		pv.EditMetaSel(geotag)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Track: %s to %s<br>\n", tr.Start().Format("2006-01-02 15:04:05 MST"), tr.End().Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(&b, "<br>\n<b>Matched: %d</b><br>\n%s", nmatch, matched.String())
+	fmt.Fprintf(&b, "<br>\n<b>Unmatched: %d</b><br>\n%s", nunmatch, unmatched.String())
+	ttl := "Geotag GPX: " + filepath.Base(tr.File)
+	if dryRun {
+		ttl += " (dry run)"
+	}
+	gi.PromptDialog(nil, gi.DlgOpts{Title: ttl, Prompt: b.String()}, gi.AddOk, gi.NoCancel, nil, nil)
+}
+
+// BorrowGPSSel sets the GPS location of selected images that don't have one
+// from the geotagged pictures in the whole library taken closest in time,
+// e.g., with a phone, interpolating between the ones before and after if
+// both are within windowMins of each other, or else using the nearest one
+// within windowMins.  The pictures that would change are listed first,
+// and the metadata is only saved if that is accepted.
+func (pv *PixView) BorrowGPSSel(windowMins int) {
+	pv.AllMu.Lock()
+	all := make(picinfo.Pics, 0, len(pv.AllInfo))
+	for _, pi := range pv.AllInfo {
+		all = append(all, pi)
+	}
+	pv.AllMu.Unlock()
+	tr := all.GPSTrack()
+	if tr == nil {
+		gi.PromptDialog(nil, gi.DlgOpts{Title: "Borrow GPS", Prompt: "There are no geotagged pictures in the library"}, gi.AddOk, gi.NoCancel, nil, nil)
+		return
+	}
+	window := time.Duration(windowMins) * time.Minute
+	locs := make(map[*picinfo.Info]picinfo.GPSCoord)
+	var b strings.Builder
+	nnone := 0
+	for _, pi := range pv.CheckSel() {
+		if pi.HasGPS() {
+			continue
+		}
+		loc, ok := tr.LocAt(pi.DateTaken, window)
+		if !ok {
+			nnone++
+			continue
+		}
+		locs[pi] = loc
+		fmt.Fprintf(&b, "%s\t%.6f, %.6f<br>\n", filepath.Base(pi.File), loc.Lat, loc.Long)
+	}
+	if len(locs) == 0 {
+		gi.PromptDialog(nil, gi.DlgOpts{Title: "Borrow GPS", Prompt: fmt.Sprintf("No geotagged pictures found within %d minutes of the %d selected pictures without a location", windowMins, nnone)}, gi.AddOk, gi.NoCancel, nil, nil)
+		return
+	}
+	prompt := fmt.Sprintf("<b>Set location of %d pictures:</b><br>\n%s<br>\n%d pictures without a location have no geotagged pictures within %d minutes", len(locs), b.String(), nnone, windowMins)
+	gi.PromptDialog(nil, gi.DlgOpts{Title: "Borrow GPS", Prompt: prompt}, gi.AddOk, gi.AddCancel, pv.This(), func(recv, send ki.Ki, sig int64, data any) {
+		if sig != int64(gi.DialogAccepted) {
+			return
+		}
+		pv.EditMetaSel(func(pi *picinfo.Info) bool {
+			loc, has := locs[pi]
+			if !has {
+				return false
+			}
+			return pi.SetGPSLoc(loc)
+		})
+	})
+}
+
+// SetRatingSel sets the star rating (0-5, 0 = unrated) for selected images,
+// and saves the updated metadata.
+func (pv *PixView) SetRatingSel(rating int) {
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		return pi.SetRating(rating)
+	})
+}
+
+// SetPickSel sets the pick / reject flag for selected images,
+// and saves the updated metadata.
+func (pv *PixView) SetPickSel(pick picinfo.Picks) {
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		return pi.SetPick(pick)
+	})
+}
+
+// SetLabelSel sets the color label for selected images,
+// and saves the updated metadata.
+func (pv *PixView) SetLabelSel(label picinfo.Labels) {
+	pv.EditMetaSel(func(pi *picinfo.Info) bool {
+		return pi.SetLabel(label)
+	})
+}
+
+// RatingKeys handles the keys for setting ratings, picks and labels on the
+// selected images, in ImgGrid and ImgView: 0-5 = star rating,
+// 6-9 = red, yellow, green, blue label (toggles if current image already has it),
+// P = pick, X = reject, U = unflag.  Sets the event as processed if handled.
+func (pv *PixView) RatingKeys(kt *key.ChordEvent) {
+	ch := kt.Chord()
+	switch {
+	case len(ch) == 1 && ch[0] >= '0' && ch[0] <= '5':
+		kt.SetProcessed()
+		pv.SetRatingSel(int(ch[0] - '0'))
+	case len(ch) == 1 && ch[0] >= '6' && ch[0] <= '9':
+		kt.SetProcessed()
+		lb := picinfo.RedLabel + picinfo.Labels(ch[0]-'6')
+		pv.AllMu.Lock()
+		pi, has := pv.AllInfo[pv.CurFile]
+		pv.AllMu.Unlock()
+		if has && pi.Label == lb {
+			lb = picinfo.NoLabel
+		}
+		pv.SetLabelSel(lb)
+	case ch == "p" || ch == "P" || ch == "Shift+P":
+		kt.SetProcessed()
+		pv.SetPickSel(picinfo.Picked)
+	case ch == "x" || ch == "X" || ch == "Shift+X":
+		kt.SetProcessed()
+		pv.SetPickSel(picinfo.Rejected)
+	case ch == "u" || ch == "U" || ch == "Shift+U":
+		kt.SetProcessed()
+		pv.SetPickSel(picinfo.Unflagged)
+	}
+}
+
 // ImgGridMoveDates moves image dates based on an insert event from ImgGrid
 func (pv *PixView) ImgGridMoveDates(idx int) {
 	pv.UpdtMu.Lock()
@@ -1036,6 +1707,16 @@ var PixViewProps = ki.Props{
 			"shortcut": "Command+R",
 			"desc":     "rotate selected images 90 degrees right",
 		}},
+		{"FlipHSel", ki.Props{
+			"icon":  "rotate-3d",
+			"label": "Flip H",
+			"desc":  "flip (mirror) selected images horizontally, left to right -- e.g., for selfie camera images",
+		}},
+		{"FlipVSel", ki.Props{
+			"icon":  "rotate-3d",
+			"label": "Flip V",
+			"desc":  "flip (mirror) selected images vertically, top to bottom",
+		}},
 		{"RotateSel", ki.Props{
 			"icon":  "rotate-right",
 			"label": "Rotate",
@@ -1044,6 +1725,36 @@ var PixViewProps = ki.Props{
 				{"Degrees", ki.Props{}},
 			},
 		}},
+		{"sep-edit", ki.BlankProp{}},
+		{"EditCur", ki.Props{
+			"icon":  "edit",
+			"label": "Edit",
+			"desc":  "edit the crop, straighten, tone and color of the current image (last selected) -- edits are saved in its metadata and applied whenever it is shown, and the original image is never changed",
+		}},
+		{"CropCur", ki.Props{
+			"icon":  "pan",
+			"label": "Crop",
+			"desc":  "crop and straighten the current image (last selected) interactively, by dragging the crop rectangle, with a choice of aspect ratios and a straighten slider -- Enter applies and Escape cancels -- saved in its edits as for Edit",
+		}},
+		{"AdjustCur", ki.Props{
+			"icon":  "color",
+			"label": "Adjust",
+			"desc":  "adjust the tone and color of the current image (last selected) in a panel beside it: levels (with auto levels), exposure, contrast, highlights, shadows, saturation, temperature and tint -- previewed quickly at screen size, and saved in its edits as for Edit",
+		}},
+		{"RevertSel", ki.Props{
+			"icon":    "undo",
+			"label":   "Revert",
+			"desc":    "revert selected images to their originals, removing all of their edits",
+			"confirm": true,
+		}},
+		{"ExportSel", ki.Props{
+			"icon":  "file-save",
+			"label": "Export",
+			"desc":  "save selected images with their edits applied to given directory, with the same names -- HEIC and camera RAW images are saved as Jpeg -- the originals are not changed",
+			"Args": ki.PropSlice{
+				{"Directory", ki.Props{}},
+			},
+		}},
 		{"sep-fold", ki.BlankProp{}},
 		{"NewFolder", ki.Props{
 			"icon": "folder-plus",
@@ -1070,7 +1781,7 @@ var PixViewProps = ki.Props{
 		}},
 		{"SaveExifSel", ki.Props{
 			"icon":  "file-save",
-			"desc":  "save any updated exif image metadata for currently selected file(s) if they've been edited -- this will automatically change file to a Jpeg format if it is not already, as that is the only supported exif type (for now)",
+			"desc":  "save any updated image metadata for currently selected file(s) if they've been edited -- Jpeg, Png and Tiff files are updated in place, and other formats store metadata in an XMP sidecar file next to the original, which is never re-encoded",
 			"label": "Save Exif",
 		}},
 		{"SetDateTakenSel", ki.Props{
@@ -1083,6 +1794,62 @@ var PixViewProps = ki.Props{
 				{"Minute Increment", ki.Props{}},
 			},
 		}},
+		{"SetLocationSel", ki.Props{
+			"icon":  "edit",
+			"desc":  "set the GPS location of selected images -- enter decimal degrees, e.g., 37.7749, -122.4194 (as copied from most maps), or degrees, minutes and seconds, e.g., 37°46'29.6\"N 122°25'9.8\"W -- optionally followed by a comma and the altitude in meters",
+			"label": "Set Location",
+			"Args": ki.PropSlice{
+				{"Location", ki.Props{}},
+			},
+		}},
+		{"ClearLocationSel", ki.Props{
+			"icon":    "close",
+			"desc":    "remove all GPS info from selected images -- for formats using an XMP sidecar, GPS info embedded in the original file is marked as cleared in the sidecar",
+			"label":   "Clear Location",
+			"confirm": true,
+		}},
+		{"sep-rate", ki.BlankProp{}},
+		{"SetRatingSel", ki.Props{
+			"icon":  "star",
+			"desc":  "set the star rating (0-5, 0 = unrated) for selected images -- keys 0-5 also set the rating",
+			"label": "Rating",
+			"Args": ki.PropSlice{
+				{"Rating", ki.Props{}},
+			},
+		}},
+		{"SetPickSel", ki.Props{
+			"icon":  "heart",
+			"desc":  "set the pick / reject flag for selected images -- keys P = pick, X = reject, U = unflag",
+			"label": "Pick",
+			"Args": ki.PropSlice{
+				{"Pick", ki.Props{}},
+			},
+		}},
+		{"SetLabelSel", ki.Props{
+			"icon":  "color",
+			"desc":  "set the color label for selected images -- keys 6-9 = red, yellow, green, blue",
+			"label": "Label",
+			"Args": ki.PropSlice{
+				{"Label", ki.Props{}},
+			},
+		}},
+		{"sep-kw", ki.BlankProp{}},
+		{"AddKeywordsSel", ki.Props{
+			"icon":  "plus",
+			"desc":  "add keywords to selected images -- separate multiple keywords with commas, and use | for hierarchical keywords, e.g., Family|Kids|Anna",
+			"label": "Add Keywords",
+			"Args": ki.PropSlice{
+				{"Keywords", ki.Props{}},
+			},
+		}},
+		{"RemoveKeywordsSel", ki.Props{
+			"icon":  "minus",
+			"desc":  "remove keywords from selected images -- separate multiple keywords with commas -- also removes any more specific keywords under the given ones",
+			"label": "Remove Keywords",
+			"Args": ki.PropSlice{
+				{"Keywords", ki.Props{}},
+			},
+		}},
 	},
 	"MainMenu": ki.PropSlice{
 		{"AppMenu", ki.BlankProp{}},
@@ -1092,6 +1859,53 @@ var PixViewProps = ki.Props{
 				"desc":    "Rename files by their date taken -- be sure to click on All first to ensure current files are loaded.",
 				"confirm": true,
 			}},
+			{"CameraStats", ki.Props{
+				"desc": "Show the number of pictures in the current folder taken with each camera and lens",
+			}},
+			{"SortByCamera", ki.Props{
+				"desc": "Sort the pictures in the current folder by camera and then date taken -- lasts until the folder is updated",
+			}},
+			{"BorrowGPSSel", ki.Props{
+				"label": "Borrow GPS...",
+				"desc":  "set the location of selected pictures that don't have one from the geotagged pictures in the library (e.g., taken with a phone) closest in time, within the given window in minutes -- the pictures that would change are listed before anything is saved",
+				"Args": ki.PropSlice{
+					{"Window Mins", ki.Props{
+						"default": 30,
+					}},
+				},
+			}},
+			{"PlaceStats", ki.Props{
+				"desc": "Show the number of pictures in the current folder taken in each country and place",
+			}},
+			{"SortByPlace", ki.Props{
+				"desc": "Sort the pictures in the current folder by place and then date taken -- lasts until the folder is updated",
+			}},
+			{"FilterByPlace", ki.Props{
+				"desc": "Show only the pictures in the current folder whose place name (country, region, city) contains given text -- lasts until the folder is updated",
+				"Args": ki.PropSlice{
+					{"Place", ki.Props{}},
+				},
+			}},
+			{"GeotagGPXSel", ki.Props{
+				"label": "Geotag from GPX...",
+				"desc":  "set the GPS location of selected images from a GPX track log, matching their date taken against the track -- the clock offset in seconds is added to the date taken to correct the camera clock, and images more than the max gap in minutes away from the track are not matched -- use dry run to see the matches without saving",
+				"Args": ki.PropSlice{
+					{"GPX File", ki.Props{
+						"ext": ".gpx",
+					}},
+					{"Clock Offset Secs", ki.Props{}},
+					{"Max Gap Mins", ki.Props{
+						"default": 10,
+					}},
+					{"Dry Run", ki.Props{
+						"default": true,
+					}},
+				},
+			}},
+			{"EditPrefs", ki.Props{
+				"label": "Preferences...",
+				"desc":  "Edit the GoPix preferences, including the gazetteer file used for place names",
+			}},
 			{"CleanAllInfo", ki.Props{
 				"desc": "Clean the info.json list of all files -- be sure to click on All dir first to make sure everything is loaded first.  Dry Run does not do anything -- just reports what would be done.",
 				"Args": ki.PropSlice{
@@ -1119,5 +1933,21 @@ var PixViewProps = ki.Props{
 				{"Date", ki.Props{}},
 			},
 		}},
+		{"AddKeywordsSel", ki.Props{
+			"icon":  "plus",
+			"desc":  "add keywords to selected images -- separate multiple keywords with commas, and use | for hierarchical keywords, e.g., Family|Kids|Anna",
+			"label": "Add Keywords",
+			"Args": ki.PropSlice{
+				{"Keywords", ki.Props{}},
+			},
+		}},
+		{"RemoveKeywordsSel", ki.Props{
+			"icon":  "minus",
+			"desc":  "remove keywords from selected images -- separate multiple keywords with commas -- also removes any more specific keywords under the given ones",
+			"label": "Remove Keywords",
+			"Args": ki.PropSlice{
+				{"Keywords", ki.Props{}},
+			},
+		}},
 	},
 }
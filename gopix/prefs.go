@@ -0,0 +1,77 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/goki/gi/gi"
+	"github.com/goki/gi/oswin"
+	"goki.dev/gopix/picinfo"
+)
+
+// Preferences are the overall user preferences for GoPix
+type Preferences struct {
+
+	// GeoNames-format gazetteer file used for looking up place names from GPS locations, e.g., cities15000.txt from https://download.geonames.org/export/dump/ -- country and region names are read from countryInfo.txt and admin1CodesASCII.txt in the same directory
+	Gazetteer gi.FileName `ext:".txt"`
+
+	// maximum distance in kilometers to the nearest place in the gazetteer -- locations farther than this have no place
+	PlaceMaxKm float64
+
+	// options for saving images when they are re-encoded, e.g., when rotated by an arbitrary angle, or converted from HEIC to Jpeg
+	SaveOpts picinfo.SaveOptions
+
+	// rotate and flip Jpeg images only by setting their orientation metadata, instead of transforming the image data losslessly so it displays correctly in apps that ignore the metadata -- the lossless transform is only possible if the image size is a multiple of the 8 or 16 pixel Jpeg blocks along the flipped edges, otherwise only the metadata is set (see JpegOrientReencode)
+	JpegOrientMeta bool
+
+	// when a Jpeg image cannot be rotated or flipped losslessly, re-encode it with the orientation applied, which loses some quality, instead of only setting its orientation metadata
+	JpegOrientReencode bool
+}
+
+// Prefs are the overall GoPix preferences
+var Prefs = Preferences{}
+
+// PrefsFileName is the name of the preferences file in the GoPix prefs directory
+var PrefsFileName = "prefs.json"
+
+// Defaults sets the default preferences
+func (pf *Preferences) Defaults() {
+	pf.Gazetteer = gi.FileName(filepath.Join(oswin.TheApp.AppPrefsDir(), "cities15000.txt"))
+	pf.PlaceMaxKm = picinfo.GazetteerMaxKm
+	pf.SaveOpts.Defaults()
+}
+
+// Open opens the preferences from the GoPix prefs directory
+func (pf *Preferences) Open() error {
+	pnm := filepath.Join(oswin.TheApp.AppPrefsDir(), PrefsFileName)
+	b, err := os.ReadFile(pnm)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(b, pf)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// Save saves the preferences to the GoPix prefs directory
+func (pf *Preferences) Save() error {
+	pnm := filepath.Join(oswin.TheApp.AppPrefsDir(), PrefsFileName)
+	b, err := json.MarshalIndent(pf, "", "  ")
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = os.WriteFile(pnm, b, 0644)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
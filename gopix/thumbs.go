@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/draw"
 	"log"
 	"os"
 	"path/filepath"
@@ -21,13 +22,13 @@ import (
 	"github.com/goki/gi/girl"
 	"github.com/goki/ki/dirs"
 	"github.com/goki/mat32"
-	"github.com/goki/pi/filecat"
 	"goki.dev/gopix/picinfo"
 )
 
 const ThumbMaxSize = 256
 
-// DateFileFmt is the Time format for naming files by their timestamp
+// DateFileFmt is the Time format for naming files by their timestamp,
+// which is formatted as the local time in the time zone where taken
 var DateFileFmt = "2006_01_02_15_04_05"
 
 // ThumbDir returns the cache dir to use for storing thumbnails
@@ -71,14 +72,18 @@ func (pv *PixView) DirInfo(reset bool) {
 	// first pass fill in from existing info -- no locking
 	for i := nfl - 1; i >= 0; i-- {
 		fn := filepath.Base(imgs[i])
+		if picinfo.IsSidecar(fn) { // shares base name with image
+			imgs = append(imgs[:i], imgs[i+1:]...)
+			pv.Info = append(pv.Info[:i], pv.Info[i+1:]...)
+			continue
+		}
 		fnext, _ := dirs.SplitExt(fn)
 		pi, has := pv.AllInfo[fnext]
 		if has {
 			pv.Info[i] = pi
 			continue
 		}
-		typ := filecat.SupportedFromFile(imgs[i])
-		if typ.Cat() != filecat.Image { // todo: movies!
+		if !picinfo.IsImage(imgs[i]) { // todo: movies!
 			imgs = append(imgs[:i], imgs[i+1:]...)
 			pv.Info = append(pv.Info[:i], pv.Info[i+1:]...)
 		} else {
@@ -88,6 +93,8 @@ func (pv *PixView) DirInfo(reset bool) {
 
 	nfl = len(imgs)
 	pv.PProg.Start(nfl)
+	picinfo.ReadStats.Reset()
+	stt := time.Now()
 
 	ncp := runtime.NumCPU()
 	nper := nfl / ncp
@@ -102,7 +109,11 @@ func (pv *PixView) DirInfo(reset bool) {
 		st = ed
 	}
 	pv.WaitGp.Wait()
+	if picinfo.ReadStats.Files > 0 {
+		fmt.Printf("Metadata read: %v in %v\n", &picinfo.ReadStats, time.Since(stt))
+	}
 	pv.InfoClean()
+	pv.UpdatePlaces(pv.Info)
 	// fmt.Printf("second pass done\n")
 	pv.Info.SortByDate(true)
 	// fmt.Printf("sort done\n")
@@ -203,14 +214,38 @@ func (pv *PixView) ThumbGenIfNeeded(pi *picinfo.Info) error {
 }
 
 // ThumbGen generates a thumb file for given image file (picinfo.Info)
-// and saves it in the Thumb file.
+// and saves it in the Thumb file.  The thumbnail embedded in the file
+// is used if it is big enough, which is much faster than decoding the
+// full image.  The picture Edits are applied.
 func (pv *PixView) ThumbGen(pi *picinfo.Info) error {
-	img, err := picinfo.OpenImage(pi.File)
+	msz := ThumbMaxSize
+	if crop := pi.Edits.Crop; !crop.Empty() { // so the cropped part is thumb size
+		osz := pi.GetSizeOrient()
+		cmx, omx := crop.Dx(), osz.X
+		if crop.Dy() > cmx {
+			cmx = crop.Dy()
+		}
+		if osz.Y > omx {
+			omx = osz.Y
+		}
+		if cmx < omx {
+			msz = ThumbMaxSize * omx / cmx
+		}
+	}
+	img, err := pi.OpenThumb(msz)
 	if err != nil {
-		return err
+		if err != picinfo.ErrNoThumb {
+			log.Printf("File: %s embedded thumbnail err: %v\n", pi.File, err)
+		}
+		img, err = picinfo.OpenImage(pi.File)
+		if err != nil {
+			return err
+		}
 	}
-	img = gi.ImageResizeMax(img, ThumbMaxSize)
+	img = gi.ImageResizeMax(img, msz)
+	img = pi.ToSRGB(img)
 	img = picinfo.OrientImage(img, pi.Orient)
+	img = pi.Edits.Apply(img, pi.GetSizeOrient())
 	isz := img.Bounds().Size()
 	rgb, ok := img.(*image.RGBA)
 	if !ok {
@@ -221,6 +256,15 @@ func (pv *PixView) ThumbGen(pi *picinfo.Info) error {
 	rs.Init(isz.X, isz.Y, rgb)
 	rs.Bounds.Max = isz
 	ds := pi.DateTaken.Format("2006:01:02")
+	switch {
+	case pi.Pick == picinfo.Rejected:
+		ds += " X"
+	case pi.Rating > 0:
+		ds += " " + strings.Repeat("*", pi.Rating)
+	}
+	if pi.Label != picinfo.NoLabel {
+		draw.Draw(rgb, image.Rect(0, isz.Y-6, isz.X, isz.Y), &image.Uniform{pi.Label.Color()}, image.Point{}, draw.Src)
+	}
 	avg := AvgImgGrey(rgb, image.Rect(5, 5, 100, 25))
 	if avg < .5 {
 		pv.Sty.Font.Color.SetUInt8(0xff, 0xff, 0xff, 0xff)
@@ -229,7 +273,7 @@ func (pv *PixView) ThumbGen(pi *picinfo.Info) error {
 	}
 	tr.SetString(ds, &pv.Sty.Font, &pv.Sty.UnContext, &pv.Sty.Text, true, 0, 1)
 	tr.RenderTopPos(rs, mat32.V2(5, 5))
-	err = picinfo.SaveImage(pi.Thumb, rgb)
+	err = picinfo.SaveImage(pi.Thumb, rgb, nil)
 	return err
 }
 
@@ -300,6 +344,10 @@ func (pv *PixView) UniquifyBaseNames() {
 	bmap := make(map[string][]string) // base map of all versions
 	for _, img := range imgs {
 		fn := filepath.Base(img)
+		if picinfo.IsSidecar(fn) { // moves with its image
+			pv.PProg.ProgStep()
+			continue
+		}
 		fnext, _ := dirs.SplitExt(fn)
 		fl, has := bmap[fnext]
 		if has {
@@ -435,6 +483,8 @@ func (pv *PixView) CleanAllInfo(dryRun bool) {
 
 	nfl := len(imgs)
 	pv.PProg.Start(nfl)
+	picinfo.ReadStats.Reset()
+	stt := time.Now()
 
 	ncp := runtime.NumCPU()
 	nper := nfl / ncp
@@ -449,6 +499,7 @@ func (pv *PixView) CleanAllInfo(dryRun bool) {
 		st = ed
 	}
 	pv.WaitGp.Wait()
+	fmt.Printf("Metadata read: %v in %v\n", &picinfo.ReadStats, time.Since(stt))
 	for fnext, pi := range pv.AllInfo {
 		if pi.Flagged {
 			pi.Flagged = false
@@ -468,8 +519,7 @@ func (pv *PixView) CleanAllInfo(dryRun bool) {
 func (pv *PixView) CleanAllInfoThr(dryRun bool, imgs []string, st, ed int) {
 	for i := st; i < ed; i++ {
 		img := imgs[i]
-		typ := filecat.SupportedFromFile(img)
-		if typ.Cat() != filecat.Image { // todo: movies!
+		if !picinfo.IsImage(img) { // todo: movies!
 			pv.PProg.ProgStep()
 			continue
 		}
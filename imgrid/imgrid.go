@@ -39,6 +39,9 @@ type ImgGrid struct {
 	// function for displaying context menu for item at given index -- if not set then a basic standard one is used
 	CtxtMenuFunc func(m *gi.Menu, idx int)
 
+	// function for handling key events that are not otherwise processed by the grid, e.g., for setting ratings -- it should call SetProcessed on events that it handles
+	KeyFunc func(kt *key.ChordEvent)
+
 	// if true, drag-n-drop and paste actions actually result in insertion -- otherwise they just drive signals to be managed externally
 	InsertOk bool
 
@@ -1275,6 +1278,9 @@ func (ig *ImgGrid) KeyInputActive(kt *key.ChordEvent) {
 		ig.SelectMode = false
 		kt.SetProcessed()
 	}
+	if !kt.IsProcessed() && ig.KeyFunc != nil {
+		ig.KeyFunc(kt)
+	}
 }
 
 var ImgGridProps = ki.Props{
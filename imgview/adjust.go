@@ -0,0 +1,89 @@
+// Copyright (c) 2020, The gide / Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgview
+
+import (
+	"image"
+
+	"github.com/anthonynsimon/bild/transform"
+	"goki.dev/gopix/picinfo"
+)
+
+// StartAdjust starts previewing the tone and color adjustments of the
+// Edits of the Info, which are set with SetAdjustEdits.  The preview is
+// rendered from a copy of the image at the current scale, so it is fast,
+// and the full resolution image is only made when the Edits are applied
+// to the Info.  Use EndAdjust or CancelAdjust to stop.
+func (iv *ImgView) StartAdjust() {
+	if iv.Info == nil || iv.OrigImg == nil {
+		return
+	}
+	iv.EndCrop()
+	iv.Adjusting = true
+	iv.AdjustEdits = iv.Info.Edits
+	iv.adjBase = nil
+	iv.UpdateImage()
+}
+
+// SetAdjustEdits sets the Edits that are previewed while adjusting,
+// updating the image -- the crop and straighten are not changed
+func (iv *ImgView) SetAdjustEdits(ed picinfo.Edits) {
+	ed.Crop = iv.AdjustEdits.Crop
+	ed.Straighten = iv.AdjustEdits.Straighten
+	iv.AdjustEdits = ed
+	iv.UpdateImage()
+}
+
+// AutoLevels sets the levels of the Edits being adjusted from the
+// histogram of the preview image, updating the image
+func (iv *ImgView) AutoLevels() {
+	if !iv.Adjusting {
+		return
+	}
+	iv.AdjustEdits.AutoLevels(iv.adjustBase())
+	iv.UpdateImage()
+}
+
+// EndAdjust stops previewing the adjustments, without updating the image,
+// e.g., after setting the Edits of the Info from AdjustEdits, which is
+// then shown with ApplyEdits
+func (iv *ImgView) EndAdjust() {
+	iv.Adjusting = false
+	iv.adjBase = nil
+}
+
+// CancelAdjust stops previewing the adjustments, showing the image with
+// the Edits of the Info as they were
+func (iv *ImgView) CancelAdjust() {
+	iv.EndAdjust()
+	iv.ApplyEdits()
+}
+
+// adjustBase returns the image that the adjustments are previewed on:
+// the original image at the current scale, cropped and straightened.
+// It is cached until the scale changes.
+func (iv *ImgView) adjustBase() image.Image {
+	osz := iv.OrigImg.Bounds().Size()
+	nsz := image.Pt(int(float32(osz.X)*iv.Scale), int(float32(osz.Y)*iv.Scale))
+	if nsz.X < 1 || nsz.Y < 1 {
+		nsz = image.Pt(1, 1)
+	}
+	if iv.adjBase == nil || iv.adjSize != nsz {
+		geom := iv.AdjustEdits.Geometry()
+		iv.adjBase = geom.Apply(transform.Resize(iv.OrigImg, nsz.X, nsz.Y, transform.Linear), osz)
+		iv.adjSize = nsz
+	}
+	return iv.adjBase
+}
+
+// renderAdjust returns the image shown while adjusting: the preview
+// image with the adjustments being edited
+func (iv *ImgView) renderAdjust() image.Image {
+	img := iv.adjustBase()
+	if iv.AdjustEdits.HasTone() {
+		img = iv.AdjustEdits.AdjustTone(img)
+	}
+	return img
+}
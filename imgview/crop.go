@@ -0,0 +1,467 @@
+// Copyright (c) 2020, The gide / Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imgview
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/goki/ki/kit"
+	"goki.dev/gopix/picinfo"
+)
+
+// CropAspects are the aspect ratio constraints for the crop rectangle
+type CropAspects int
+
+const (
+	// CropFree does not constrain the aspect ratio
+	CropFree CropAspects = iota
+
+	// CropOriginal keeps the aspect ratio of the image
+	CropOriginal
+
+	// Crop1x1 is square
+	Crop1x1
+
+	// Crop4x3 is 4:3, or 3:4 for a portrait crop
+	Crop4x3
+
+	// Crop3x2 is 3:2, or 2:3 for a portrait crop
+	Crop3x2
+
+	// Crop16x9 is 16:9, or 9:16 for a portrait crop
+	Crop16x9
+
+	CropAspectsN
+)
+
+//go:generate stringer -type=CropAspects
+
+var KiT_CropAspects = kit.Enums.AddEnum(CropAspectsN, kit.NotBitFlag, nil)
+
+func (ev CropAspects) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *CropAspects) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// Label returns the label for choosing the aspect, e.g., 4:3
+func (ca CropAspects) Label() string {
+	switch ca {
+	case CropFree:
+		return "Free"
+	case CropOriginal:
+		return "Original"
+	case Crop1x1:
+		return "1:1"
+	case Crop4x3:
+		return "4:3"
+	case Crop3x2:
+		return "3:2"
+	case Crop16x9:
+		return "16:9"
+	}
+	return ca.String()
+}
+
+// CropAspectLabels returns the labels of all the CropAspects, in order
+func CropAspectLabels() []string {
+	lbls := make([]string, CropAspectsN)
+	for i := range lbls {
+		lbls[i] = CropAspects(i).Label()
+	}
+	return lbls
+}
+
+// Ratio returns the width / height ratio for an image of given size,
+// in landscape orientation (>= 1) except for CropOriginal, which is
+// the ratio of the size.  Returns 0 for CropFree.
+func (ca CropAspects) Ratio(size image.Point) float64 {
+	switch ca {
+	case CropOriginal:
+		if size.Y == 0 {
+			return 0
+		}
+		return float64(size.X) / float64(size.Y)
+	case Crop1x1:
+		return 1
+	case Crop4x3:
+		return 4.0 / 3.0
+	case Crop3x2:
+		return 3.0 / 2.0
+	case Crop16x9:
+		return 16.0 / 9.0
+	}
+	return 0
+}
+
+// cropHandles are the parts of the crop rectangle that are dragged,
+// as bit flags for its edges, so corners have two bits set
+type cropHandles int
+
+const (
+	cropNone cropHandles = 0
+
+	cropLeft cropHandles = 1 << iota
+	cropTop
+	cropRight
+	cropBottom
+
+	// cropMove moves the whole rectangle
+	cropMove
+)
+
+// cropHandleList are the handles drawn on the crop rectangle: the corners
+// and the middle of the edges
+var cropHandleList = []cropHandles{cropLeft | cropTop, cropTop, cropRight | cropTop, cropRight, cropRight | cropBottom, cropBottom, cropLeft | cropBottom, cropLeft}
+
+// CropHandleSize is the size in pixels of the crop handles drawn on the
+// crop rectangle, which can be grabbed from within this distance
+var CropHandleSize = 8
+
+// cropMinSize is the minimum size of the crop rectangle, in image pixels
+const cropMinSize = 8
+
+// StartCrop starts the crop and straighten tool, showing the whole
+// straightened image with the crop rectangle over it, with rule of thirds
+// guides.  The rectangle is changed by dragging its corners and edges,
+// moved by dragging inside it, and a new one is started by dragging
+// outside of it.  Use SetStraighten and SetCropAspect to set the other
+// parameters, CropEdits to get the result, and EndCrop or CancelCrop to stop.
+func (iv *ImgView) StartCrop() {
+	if iv.Info == nil || iv.OrigImg == nil {
+		return
+	}
+	iv.EndAdjust()
+	iv.Cropping = true
+	iv.Straighten = iv.Info.Edits.Straighten
+	iv.CropRect = iv.Info.Edits.Crop
+	if iv.CropRect.Empty() {
+		iv.CropRect = iv.cropBounds()
+	}
+	iv.cropDrag = cropNone
+	iv.cropBase = nil
+	iv.cropImg = nil
+	iv.ScaleToFit()
+	iv.UpdateImage()
+}
+
+// CropEdits returns the Edits of the Info with the crop and straighten
+// that are being edited
+func (iv *ImgView) CropEdits() picinfo.Edits {
+	ed := iv.Info.Edits
+	ed.Straighten = iv.Straighten
+	ed.Crop = iv.CropRect
+	if ed.Crop == iv.cropBounds() {
+		ed.Crop = image.Rectangle{}
+	}
+	return ed
+}
+
+// EndCrop ends the crop and straighten tool, without updating the image,
+// e.g., after setting the Edits of the Info from CropEdits, which is then
+// shown with ApplyEdits
+func (iv *ImgView) EndCrop() {
+	iv.Cropping = false
+	iv.cropDrag = cropNone
+	iv.cropBase = nil
+	iv.cropImg = nil
+}
+
+// CancelCrop ends the crop and straighten tool, showing the image with
+// the Edits of the Info as they were
+func (iv *ImgView) CancelCrop() {
+	iv.EndCrop()
+	iv.ApplyEdits()
+}
+
+// SetStraighten sets the straighten angle in degrees (+ = clockwise)
+// while cropping, updating the image
+func (iv *ImgView) SetStraighten(deg float64) {
+	if iv.Straighten == deg {
+		return
+	}
+	iv.Straighten = deg
+	iv.cropImg = nil
+	iv.UpdateImage()
+}
+
+// SetCropAspect sets the aspect ratio constraint while cropping,
+// fitting the crop rectangle to it about its center
+func (iv *ImgView) SetCropAspect(ca CropAspects) {
+	iv.CropAspect = ca
+	iv.CropRect = iv.fitCrop(iv.CropRect, cropNone)
+	iv.UpdateImage()
+}
+
+// CropRatio returns the width / height ratio that the crop rectangle is
+// constrained to, or 0 if it is not.  The preset ratios are inverted
+// for a portrait rectangle.
+func (iv *ImgView) CropRatio() float64 {
+	return iv.cropRatio(iv.CropRect)
+}
+
+// cropRatio returns the width / height ratio that given crop rectangle
+// is constrained to, or 0 if it is not
+func (iv *ImgView) cropRatio(r image.Rectangle) float64 {
+	ar := iv.CropAspect.Ratio(iv.cropBounds().Size())
+	if ar > 0 && iv.CropAspect != CropOriginal && r.Dy() > r.Dx() {
+		ar = 1 / ar
+	}
+	return ar
+}
+
+// cropBounds returns the bounds of the image being cropped, at full size
+func (iv *ImgView) cropBounds() image.Rectangle {
+	if iv.OrigImg == nil {
+		return image.Rectangle{}
+	}
+	return image.Rectangle{Max: iv.OrigImg.Bounds().Size()}
+}
+
+// imgToView converts given rectangle in the image at full size to the
+// view, at the current scale
+func (iv *ImgView) imgToView(r image.Rectangle) image.Rectangle {
+	sc := func(v int) int {
+		return int(float32(v) * iv.Scale)
+	}
+	return image.Rect(sc(r.Min.X), sc(r.Min.Y), sc(r.Max.X), sc(r.Max.Y))
+}
+
+// viewToImg converts given point in the view to the image at full size
+func (iv *ImgView) viewToImg(p image.Point) image.Point {
+	return image.Pt(int(float32(p.X)/iv.Scale), int(float32(p.Y)/iv.Scale))
+}
+
+// viewPos returns the position of given window point relative to the view
+func (iv *ImgView) viewPos(wp image.Point) image.Point {
+	iv.BBoxMu.RLock()
+	defer iv.BBoxMu.RUnlock()
+	return wp.Sub(iv.WinBBox.Min)
+}
+
+// cropHandlePos returns the position of given handle on given rectangle
+func cropHandlePos(r image.Rectangle, h cropHandles) image.Point {
+	p := r.Min.Add(r.Max).Div(2)
+	switch {
+	case h&cropLeft != 0:
+		p.X = r.Min.X
+	case h&cropRight != 0:
+		p.X = r.Max.X
+	}
+	switch {
+	case h&cropTop != 0:
+		p.Y = r.Min.Y
+	case h&cropBottom != 0:
+		p.Y = r.Max.Y
+	}
+	return p
+}
+
+// cropHandleAt returns the crop handle at given position in the view:
+// cropMove inside the rectangle, and cropNone outside of it
+func (iv *ImgView) cropHandleAt(p image.Point) cropHandles {
+	r := iv.imgToView(iv.CropRect)
+	for _, h := range cropHandleList {
+		d := p.Sub(cropHandlePos(r, h))
+		if d.X >= -CropHandleSize && d.X <= CropHandleSize && d.Y >= -CropHandleSize && d.Y <= CropHandleSize {
+			return h
+		}
+	}
+	if p.In(r) {
+		return cropMove
+	}
+	return cropNone
+}
+
+// CropPress starts dragging the crop rectangle at given window position:
+// a handle, the whole rectangle, or a new rectangle from outside of it
+func (iv *ImgView) CropPress(wp image.Point) {
+	p := iv.viewPos(wp)
+	iv.cropDrag = iv.cropHandleAt(p)
+	iv.cropStart = iv.CropRect
+	if iv.cropDrag == cropNone {
+		ip := iv.viewToImg(p)
+		iv.cropDrag = cropRight | cropBottom
+		iv.cropStart = image.Rectangle{Min: ip, Max: ip}
+	}
+}
+
+// CropDrag drags the crop rectangle, after CropPress, by the distance
+// from given window start position to the current one
+func (iv *ImgView) CropDrag(start, cur image.Point) {
+	if iv.cropDrag == cropNone {
+		return
+	}
+	d := iv.viewToImg(cur.Sub(start))
+	r := iv.cropStart
+	h := iv.cropDrag
+	if h == cropMove {
+		iv.CropRect = iv.shiftInBounds(r.Add(d))
+		iv.UpdateImage()
+		return
+	}
+	if h&cropLeft != 0 {
+		r.Min.X += d.X
+	}
+	if h&cropRight != 0 {
+		r.Max.X += d.X
+	}
+	if h&cropTop != 0 {
+		r.Min.Y += d.Y
+	}
+	if h&cropBottom != 0 {
+		r.Max.Y += d.Y
+	}
+	if r.Min.X > r.Max.X { // dragged past the opposite edge
+		h ^= cropLeft | cropRight
+	}
+	if r.Min.Y > r.Max.Y {
+		h ^= cropTop | cropBottom
+	}
+	iv.CropRect = iv.fitCrop(r.Canon(), h)
+	iv.UpdateImage()
+}
+
+// CropRelease ends dragging the crop rectangle
+func (iv *ImgView) CropRelease() {
+	iv.cropDrag = cropNone
+}
+
+// fitCrop returns given crop rectangle within the image bounds and
+// the aspect ratio constraint, keeping the edges opposite to the dragged
+// ones fixed, and centered otherwise.
+func (iv *ImgView) fitCrop(r image.Rectangle, h cropHandles) image.Rectangle {
+	bb := iv.cropBounds()
+	r = r.Intersect(bb)
+	w, ht := r.Dx(), r.Dy()
+	if ar := iv.cropRatio(r); ar > 0 {
+		horiz := h&(cropLeft|cropRight) != 0
+		vert := h&(cropTop|cropBottom) != 0
+		switch {
+		case horiz && !vert:
+			ht = int(float64(w)/ar + 0.5)
+		case vert && !horiz:
+			w = int(float64(ht)*ar + 0.5)
+		case float64(w) > float64(ht)*ar:
+			w = int(float64(ht)*ar + 0.5)
+		default:
+			ht = int(float64(w)/ar + 0.5)
+		}
+		if w > bb.Dx() {
+			w = bb.Dx()
+			ht = int(float64(w)/ar + 0.5)
+		}
+		if ht > bb.Dy() {
+			ht = bb.Dy()
+			w = int(float64(ht)*ar + 0.5)
+		}
+	}
+	if w < cropMinSize {
+		w = cropMinSize
+	}
+	if ht < cropMinSize {
+		ht = cropMinSize
+	}
+	var nr image.Rectangle
+	switch {
+	case h&cropLeft != 0:
+		nr.Min.X = r.Max.X - w
+	case h&cropRight != 0:
+		nr.Min.X = r.Min.X
+	default:
+		nr.Min.X = (r.Min.X + r.Max.X - w) / 2
+	}
+	switch {
+	case h&cropTop != 0:
+		nr.Min.Y = r.Max.Y - ht
+	case h&cropBottom != 0:
+		nr.Min.Y = r.Min.Y
+	default:
+		nr.Min.Y = (r.Min.Y + r.Max.Y - ht) / 2
+	}
+	nr.Max = nr.Min.Add(image.Pt(w, ht))
+	return iv.shiftInBounds(nr)
+}
+
+// shiftInBounds returns given rectangle shifted to be within the image
+// bounds, as far as it fits
+func (iv *ImgView) shiftInBounds(r image.Rectangle) image.Rectangle {
+	bb := iv.cropBounds()
+	if r.Max.X > bb.Max.X {
+		r = r.Sub(image.Pt(r.Max.X-bb.Max.X, 0))
+	}
+	if r.Max.Y > bb.Max.Y {
+		r = r.Sub(image.Pt(0, r.Max.Y-bb.Max.Y))
+	}
+	if r.Min.X < bb.Min.X {
+		r = r.Add(image.Pt(bb.Min.X-r.Min.X, 0))
+	}
+	if r.Min.Y < bb.Min.Y {
+		r = r.Add(image.Pt(0, bb.Min.Y-r.Min.Y))
+	}
+	return r
+}
+
+// renderCrop returns the image shown while cropping: the straightened
+// image at the current scale, with the crop rectangle drawn over it.
+// The scaled image is cached, so the straighten angle is previewed quickly.
+func (iv *ImgView) renderCrop() *image.RGBA {
+	nsz := iv.imgToView(iv.cropBounds()).Size()
+	if nsz.X < 1 || nsz.Y < 1 {
+		nsz = image.Pt(1, 1)
+	}
+	if iv.cropBase == nil || iv.cropBase.Bounds().Size() != nsz {
+		ed := iv.Info.Edits // just the tone and color
+		ed.Crop = image.Rectangle{}
+		ed.Straighten = 0
+		iv.cropBase = ed.Apply(transform.Resize(iv.OrigImg, nsz.X, nsz.Y, transform.Linear), image.ZP)
+		iv.cropImg = nil
+	}
+	if iv.cropImg == nil {
+		iv.cropImg = iv.cropBase
+		if iv.Straighten != 0 {
+			iv.cropImg = picinfo.StraightenImage(iv.cropBase, iv.Straighten)
+		}
+	}
+	dst := image.NewRGBA(image.Rectangle{Max: nsz})
+	draw.Draw(dst, dst.Bounds(), iv.cropImg, iv.cropImg.Bounds().Min, draw.Src)
+	iv.drawCropRect(dst)
+	return dst
+}
+
+// drawCropRect draws the crop rectangle on given image at the current
+// scale: shading outside of it, its border, the rule of thirds guides
+// and the handles
+func (iv *ImgView) drawCropRect(dst *image.RGBA) {
+	b := dst.Bounds()
+	r := iv.imgToView(iv.CropRect)
+	fill := func(fr image.Rectangle, c color.Color) {
+		draw.Draw(dst, fr.Intersect(b), image.NewUniform(c), image.ZP, draw.Over)
+	}
+	shade := color.RGBA{A: 160}
+	fill(image.Rect(b.Min.X, b.Min.Y, b.Max.X, r.Min.Y), shade)
+	fill(image.Rect(b.Min.X, r.Max.Y, b.Max.X, b.Max.Y), shade)
+	fill(image.Rect(b.Min.X, r.Min.Y, r.Min.X, r.Max.Y), shade)
+	fill(image.Rect(r.Max.X, r.Min.Y, b.Max.X, r.Max.Y), shade)
+
+	guide := color.RGBA{128, 128, 128, 128} // half transparent white
+	for i := 1; i < 3; i++ {
+		x := r.Min.X + r.Dx()*i/3
+		y := r.Min.Y + r.Dy()*i/3
+		fill(image.Rect(x, r.Min.Y, x+1, r.Max.Y), guide)
+		fill(image.Rect(r.Min.X, y, r.Max.X, y+1), guide)
+	}
+
+	fill(image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1), color.White)
+	fill(image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y), color.White)
+	fill(image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y), color.White)
+	fill(image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y), color.White)
+
+	hs := CropHandleSize / 2
+	for _, h := range cropHandleList {
+		p := cropHandlePos(r, h)
+		fill(image.Rect(p.X-hs, p.Y-hs, p.X+hs, p.Y+hs), color.White)
+	}
+}
@@ -20,18 +20,59 @@ import (
 	"goki.dev/gopix/picinfo"
 )
 
-// ImgView shows a bitmap image with zoom control through keyboard actions
+// ImgView shows a bitmap image with zoom control through keyboard actions,
+// an interactive crop and straighten tool (see StartCrop), and a preview
+// of tone and color adjustments (see StartAdjust)
 type ImgView struct {
 	gi.Bitmap
 
 	// info about the image that is being viewed
 	Info *picinfo.Info
 
-	// cached version of original image
+	// cached version of original image, oriented and converted to sRGB for display
 	OrigImg image.Image
 
+	// OrigImg with the Edits of the Info applied, which is what is shown
+	EditImg image.Image
+
 	// current scale
 	Scale float32
+
+	// true when the crop and straighten tool is active, showing the whole straightened image with the crop rectangle over it
+	Cropping bool
+
+	// crop rectangle being edited, in the straightened oriented image at full size
+	CropRect image.Rectangle
+
+	// straighten angle in degrees (+ = clockwise) being edited
+	Straighten float64
+
+	// aspect ratio constraint on the crop rectangle
+	CropAspect CropAspects
+
+	// crop handle being dragged
+	cropDrag cropHandles
+
+	// crop rectangle at the start of the drag
+	cropStart image.Rectangle
+
+	// OrigImg at the current scale with the tone and color edits, for cropping
+	cropBase image.Image
+
+	// cropBase straightened, as shown while cropping
+	cropImg image.Image
+
+	// true when previewing the tone and color adjustments in AdjustEdits
+	Adjusting bool
+
+	// Edits with the tone and color adjustments being previewed
+	AdjustEdits picinfo.Edits
+
+	// OrigImg at the current scale with the crop and straighten, for adjusting
+	adjBase image.Image
+
+	// size of OrigImg at the scale of adjBase
+	adjSize image.Point
 }
 
 var KiT_ImgView = kit.Types.AddType(&ImgView{}, ImgViewProps)
@@ -44,19 +85,33 @@ func AddNewImgView(parent ki.Ki, name string) *ImgView {
 // SetInfo sets the image info
 func (iv *ImgView) SetInfo(pi *picinfo.Info) {
 	iv.SetCanFocus()
+	iv.EndCrop()
+	iv.EndAdjust()
 	iv.Info = pi
 	var err error
 	iv.OrigImg, err = pi.ImageOriented()
 	if err != nil {
 		return
 	}
+	iv.OrigImg = pi.ToSRGB(iv.OrigImg)
+	iv.EditImg = pi.Edits.Apply(iv.OrigImg, image.ZP)
+	iv.ScaleToFit()
+	iv.UpdateImage()
+}
+
+// ApplyEdits updates the shown image after the Edits of the Info have changed
+func (iv *ImgView) ApplyEdits() {
+	if iv.Info == nil || iv.OrigImg == nil {
+		return
+	}
+	iv.EditImg = iv.Info.Edits.Apply(iv.OrigImg, image.ZP)
 	iv.ScaleToFit()
 	iv.UpdateImage()
 }
 
 // ScaleToFit sets the scale so it fits the current image
 func (iv *ImgView) ScaleToFit() {
-	if iv.Info == nil || iv.OrigImg == nil {
+	if iv.Info == nil || iv.EditImg == nil {
 		iv.Scale = 1
 		return
 	}
@@ -64,7 +119,10 @@ func (iv *ImgView) ScaleToFit() {
 	if alc == image.ZP {
 		iv.Scale = 1
 	} else {
-		isz := iv.OrigImg.Bounds().Size()
+		isz := iv.EditImg.Bounds().Size()
+		if iv.Cropping {
+			isz = iv.cropBounds().Size()
+		}
 		sx := float32(alc.X) / float32(isz.X)
 		sy := float32(alc.Y) / float32(isz.Y)
 		iv.Scale = mat32.Min(sx, sy)
@@ -88,18 +146,27 @@ func (iv *ImgView) ZoomOut() {
 
 // UpdateImage updates the image based on current scale
 func (iv *ImgView) UpdateImage() {
-	if iv.Info == nil || iv.OrigImg == nil {
+	if iv.Info == nil || iv.EditImg == nil {
 		return
 	}
 	updt := iv.UpdateStart()
 	defer iv.UpdateEnd(updt)
 
 	iv.SetFullReRender()
-	isz := iv.OrigImg.Bounds().Size()
-	nsz := isz
-	nsz.X = int(float32(isz.X) * iv.Scale)
-	nsz.Y = int(float32(isz.Y) * iv.Scale)
-	img := transform.Resize(iv.OrigImg, nsz.X, nsz.Y, transform.Linear)
+	var img image.Image
+	switch {
+	case iv.Cropping:
+		img = iv.renderCrop()
+	case iv.Adjusting:
+		img = iv.renderAdjust()
+	default:
+		isz := iv.EditImg.Bounds().Size()
+		nsz := isz
+		nsz.X = int(float32(isz.X) * iv.Scale)
+		nsz.Y = int(float32(isz.Y) * iv.Scale)
+		img = transform.Resize(iv.EditImg, nsz.X, nsz.Y, transform.Linear)
+	}
+	nsz := img.Bounds().Size()
 	iv.SetImage(img, 0, 0)
 	iv.SetMinPrefWidth(units.NewDot(float32(nsz.X)))
 	iv.SetMinPrefHeight(units.NewDot(float32(nsz.Y)))
@@ -127,7 +194,11 @@ func (iv *ImgView) ImgViewMouseEvents() {
 			ivv.ScaleToFit()
 			ivv.UpdateImage()
 			me.SetProcessed()
+		case me.Button == mouse.Left && me.Action == mouse.Press && ivv.Cropping:
+			ivv.CropPress(me.Where)
+			me.SetProcessed()
 		case me.Button == mouse.Left && me.Action == mouse.Release:
+			ivv.CropRelease()
 			ivv.GrabFocus()
 			me.SetProcessed()
 			// case me.Button == mouse.Right && me.Action == mouse.Release: // todo
@@ -135,6 +206,14 @@ func (iv *ImgView) ImgViewMouseEvents() {
 			// 	me.SetProcessed()
 		}
 	})
+	iv.ConnectEvent(oswin.MouseDragEvent, gi.LowRawPri, func(recv, send ki.Ki, sig int64, d any) {
+		me := d.(*mouse.DragEvent)
+		ivv := recv.Embed(KiT_ImgView).(*ImgView)
+		if ivv.Cropping {
+			ivv.CropDrag(me.Start, me.Where)
+			me.SetProcessed()
+		}
+	})
 }
 
 func (iv *ImgView) KeyInput(kt *key.ChordEvent) {
@@ -154,6 +233,15 @@ func (iv *ImgView) KeyInput(kt *key.ChordEvent) {
 	case "-", "Shift+-":
 		kt.SetProcessed()
 		iv.ZoomOut()
+	case "Escape":
+		switch {
+		case iv.Cropping:
+			kt.SetProcessed()
+			iv.CancelCrop()
+		case iv.Adjusting:
+			kt.SetProcessed()
+			iv.CancelAdjust()
+		}
 	}
 	if kt.IsProcessed() {
 		return
@@ -0,0 +1,241 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goki/ki/kit"
+)
+
+// Camera is the camera body that took the picture
+type Camera struct {
+
+	// manufacturer of the camera, e.g., Canon
+	Make string
+
+	// model name of the camera, e.g., Canon EOS R5
+	Model string
+
+	// serial number of the camera body
+	Serial string
+}
+
+// Name returns the display name of the camera, which is the Model,
+// prefixed by the Make if the model does not already include it.
+func (cm *Camera) Name() string {
+	return makeModelName(cm.Make, cm.Model)
+}
+
+// Lens is the lens used to take the picture
+type Lens struct {
+
+	// manufacturer of the lens
+	Make string
+
+	// model name of the lens, e.g., RF24-105mm F4 L IS USM
+	Model string
+
+	// serial number of the lens
+	Serial string
+
+	// minimum focal length in mm
+	MinFocal float64
+
+	// maximum focal length in mm -- same as MinFocal for a prime lens
+	MaxFocal float64
+
+	// maximum aperture (minimum f-stop) at the minimum focal length
+	MinFocalFStop float64
+
+	// maximum aperture (minimum f-stop) at the maximum focal length
+	MaxFocalFStop float64
+}
+
+// Name returns the display name of the lens, which is the Model,
+// prefixed by the Make if the model does not already include it.
+// If there is no model, a name is generated from the focal length
+// and aperture specifications, if available.
+func (ln *Lens) Name() string {
+	if ln.Model == "" && ln.MinFocal > 0 {
+		fl := fmt.Sprintf("%gmm", ln.MinFocal)
+		if ln.MaxFocal > ln.MinFocal {
+			fl = fmt.Sprintf("%g-%gmm", ln.MinFocal, ln.MaxFocal)
+		}
+		if ln.MinFocalFStop > 0 {
+			fl += fmt.Sprintf(" f/%g", ln.MinFocalFStop)
+			if ln.MaxFocalFStop > ln.MinFocalFStop {
+				fl += fmt.Sprintf("-%g", ln.MaxFocalFStop)
+			}
+		}
+		return makeModelName(ln.Make, fl)
+	}
+	return makeModelName(ln.Make, ln.Model)
+}
+
+// SetSpec sets the focal length and aperture specifications from the
+// 4 values of the exif LensSpecification tag
+func (ln *Lens) SetSpec(spec []float64) {
+	if len(spec) < 4 {
+		return
+	}
+	ln.MinFocal, ln.MaxFocal, ln.MinFocalFStop, ln.MaxFocalFStop = spec[0], spec[1], spec[2], spec[3]
+}
+
+// makeModelName returns model prefixed by make unless it already starts with it
+func makeModelName(mk, model string) string {
+	mk = strings.TrimSpace(mk)
+	model = strings.TrimSpace(model)
+	switch {
+	case model == "":
+		return mk
+	case mk == "":
+		return model
+	case strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(mk)[0])):
+		return model
+	}
+	return mk + " " + model
+}
+
+// ExposurePrograms are the exif exposure program modes
+type ExposurePrograms int
+
+const (
+	// ProgramUndef means the exposure program was not defined
+	ProgramUndef ExposurePrograms = iota
+
+	// ProgramManual is manual exposure
+	ProgramManual
+
+	// ProgramNormal is the normal auto program mode
+	ProgramNormal
+
+	// ProgramAperture is aperture priority
+	ProgramAperture
+
+	// ProgramShutter is shutter speed priority
+	ProgramShutter
+
+	// ProgramCreative is a creative program, biased toward depth of field
+	ProgramCreative
+
+	// ProgramAction is an action program, biased toward fast shutter speed
+	ProgramAction
+
+	// ProgramPortrait is portrait mode, with the background out of focus
+	ProgramPortrait
+
+	// ProgramLandscape is landscape mode, with the background in focus
+	ProgramLandscape
+
+	ExposureProgramsN
+)
+
+//go:generate stringer -type=ExposurePrograms
+
+var KiT_ExposurePrograms = kit.Enums.AddEnum(ExposureProgramsN, kit.NotBitFlag, nil)
+
+func (ev ExposurePrograms) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *ExposurePrograms) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// MeteringModes are the exif light metering modes
+type MeteringModes int
+
+const (
+	// MeteringUnknown means the metering mode is unknown
+	MeteringUnknown MeteringModes = iota
+
+	// MeteringAverage is average metering
+	MeteringAverage
+
+	// MeteringCenter is center-weighted average metering
+	MeteringCenter
+
+	// MeteringSpot is spot metering
+	MeteringSpot
+
+	// MeteringMultiSpot is multi-spot metering
+	MeteringMultiSpot
+
+	// MeteringPattern is pattern (matrix, evaluative) metering
+	MeteringPattern
+
+	// MeteringPartial is partial metering
+	MeteringPartial
+
+	// MeteringOther is any other metering mode (exif value 255)
+	MeteringOther
+
+	MeteringModesN
+)
+
+//go:generate stringer -type=MeteringModes
+
+var KiT_MeteringModes = kit.Enums.AddEnum(MeteringModesN, kit.NotBitFlag, nil)
+
+func (ev MeteringModes) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *MeteringModes) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// MeteringFromExif returns the metering mode for given exif value
+func MeteringFromExif(v int) MeteringModes {
+	if v > 0 && v < int(MeteringOther) {
+		return MeteringModes(v)
+	}
+	if v == 0 {
+		return MeteringUnknown
+	}
+	return MeteringOther
+}
+
+// FlashModes are the exif flash firing modes
+type FlashModes int
+
+const (
+	// FlashUnknown means the flash mode is unknown
+	FlashUnknown FlashModes = iota
+
+	// FlashOn means the flash was set to fire
+	FlashOn
+
+	// FlashOff means the flash was set to not fire
+	FlashOff
+
+	// FlashAuto means the flash fires automatically when needed
+	FlashAuto
+
+	FlashModesN
+)
+
+//go:generate stringer -type=FlashModes
+
+var KiT_FlashModes = kit.Enums.AddEnum(FlashModesN, kit.NotBitFlag, nil)
+
+func (ev FlashModes) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *FlashModes) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// Flash is the flash status of a picture, decoded from the exif Flash bits
+type Flash struct {
+
+	// whether the flash fired
+	Fired bool
+
+	// flash firing mode
+	Mode FlashModes
+
+	// whether red-eye reduction was used
+	RedEye bool
+
+	// camera has no flash function
+	NoFlash bool
+}
+
+// SetFromExif sets the flash status from the exif Flash tag value
+func (fl *Flash) SetFromExif(v int) {
+	fl.Fired = v&0x01 != 0
+	fl.Mode = FlashModes((v >> 3) & 0x03)
+	fl.NoFlash = v&0x20 != 0
+	fl.RedEye = v&0x40 != 0
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/anthonynsimon/bild/transform"
+)
+
+// The bild transforms all produce 8 bit image.RGBA images, so 16 bit images,
+// e.g., from TIFF or PNG scans, are transformed here instead, producing
+// images of the same 16 bit type (image.Gray16, image.NRGBA64, otherwise
+// image.RGBA64), which are saved as 16 bit by the PNG and TIFF encoders.
+// Images are only converted to 8 bits for thumbnails and display.
+
+// IsDeep returns true if the image has more than 8 bits per color component
+func IsDeep(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// RotateImage returns the image rotated by given number of degrees
+// (+ = clockwise), with the bounds enlarged to hold the entire rotated image.
+// 16 bit images are kept at 16 bits.
+func RotateImage(img image.Image, deg float64) image.Image {
+	if !IsDeep(img) {
+		return transform.Rotate(img, deg, &transform.RotationOptions{ResizeBounds: true})
+	}
+	return rotateDeep(img, deg)
+}
+
+// FlipImageH returns the image flipped horizontally, keeping 16 bit images at 16 bits
+func FlipImageH(img image.Image) image.Image {
+	if !IsDeep(img) {
+		return transform.FlipH(img)
+	}
+	return remapDeep(img, img.Bounds().Size(), func(x, y int, sz image.Point) (int, int) {
+		return sz.X - 1 - x, y
+	})
+}
+
+// FlipImageV returns the image flipped vertically, keeping 16 bit images at 16 bits
+func FlipImageV(img image.Image) image.Image {
+	if !IsDeep(img) {
+		return transform.FlipV(img)
+	}
+	return remapDeep(img, img.Bounds().Size(), func(x, y int, sz image.Point) (int, int) {
+		return x, sz.Y - 1 - y
+	})
+}
+
+// rgba64At returns the premultiplied 16 bit color at given point
+func rgba64At(img image.Image, x, y int) color.RGBA64 {
+	if ri, ok := img.(image.RGBA64Image); ok {
+		return ri.RGBA64At(x, y)
+	}
+	r, g, b, a := img.At(x, y).RGBA()
+	return color.RGBA64{uint16(r), uint16(g), uint16(b), uint16(a)}
+}
+
+// newDeepLike returns a new 16 bit image of given size, of the same type
+// as given image where possible
+func newDeepLike(img image.Image, sz image.Point) draw.RGBA64Image {
+	r := image.Rectangle{Max: sz}
+	switch img.ColorModel() {
+	case color.Gray16Model:
+		return image.NewGray16(r)
+	case color.NRGBA64Model:
+		return image.NewNRGBA64(r)
+	}
+	return image.NewRGBA64(r)
+}
+
+// remapDeep returns a new 16 bit image of given size, with each pixel copied
+// from the source pixel (relative to its bounds) given by the src function
+func remapDeep(img image.Image, dsz image.Point, src func(x, y int, ssz image.Point) (int, int)) draw.RGBA64Image {
+	sb := img.Bounds()
+	ssz := sb.Size()
+	dst := newDeepLike(img, dsz)
+	for y := 0; y < dsz.Y; y++ {
+		for x := 0; x < dsz.X; x++ {
+			sx, sy := src(x, y, ssz)
+			dst.Set(x, y, img.At(sb.Min.X+sx, sb.Min.Y+sy)) // exact for same type
+		}
+	}
+	return dst
+}
+
+// rotateDeep rotates a 16 bit image by given degrees clockwise, with
+// resized bounds.  Multiples of 90 degrees are exact, and other angles
+// use bilinear interpolation.
+func rotateDeep(img image.Image, deg float64) draw.RGBA64Image {
+	ssz := img.Bounds().Size()
+	steps := int(math.Round(deg))
+	if float64(steps) == deg && steps%90 == 0 {
+		switch (steps/90%4 + 4) % 4 {
+		case 0:
+			return remapDeep(img, ssz, func(x, y int, sz image.Point) (int, int) { return x, y })
+		case 1:
+			return remapDeep(img, image.Point{ssz.Y, ssz.X}, func(x, y int, sz image.Point) (int, int) { return y, sz.Y - 1 - x })
+		case 2:
+			return remapDeep(img, ssz, func(x, y int, sz image.Point) (int, int) { return sz.X - 1 - x, sz.Y - 1 - y })
+		case 3:
+			return remapDeep(img, image.Point{ssz.Y, ssz.X}, func(x, y int, sz image.Point) (int, int) { return sz.X - 1 - y, x })
+		}
+	}
+	rad := deg * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	sw, sh := float64(ssz.X), float64(ssz.Y)
+	dw := int(math.Abs(sw*cos) + math.Abs(sh*sin) + 0.5)
+	dh := int(math.Abs(sw*sin) + math.Abs(sh*cos) + 0.5)
+	dst := newDeepLike(img, image.Point{dw, dh})
+	sb := img.Bounds()
+	for y := 0; y < dh; y++ {
+		dy := float64(y) + 0.5 - float64(dh)/2
+		for x := 0; x < dw; x++ {
+			dx := float64(x) + 0.5 - float64(dw)/2
+			// inverse rotation of the destination pixel center into the source
+			sx := cos*dx + sin*dy + sw/2 - 0.5
+			sy := -sin*dx + cos*dy + sh/2 - 0.5
+			if sx < -0.5 || sy < -0.5 || sx > sw-0.5 || sy > sh-0.5 {
+				continue
+			}
+			dst.SetRGBA64(x, y, bilinearDeep(img, sb, sx, sy))
+		}
+	}
+	return dst
+}
+
+// bilinearDeep returns the bilinear interpolated color at given source
+// location, relative to the bounds
+func bilinearDeep(img image.Image, sb image.Rectangle, sx, sy float64) color.RGBA64 {
+	x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+	fx, fy := sx-float64(x0), sy-float64(y0)
+	var sum [4]float64
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 2; i++ {
+			w := (1 - fx) * (1 - fy)
+			switch {
+			case i == 1 && j == 0:
+				w = fx * (1 - fy)
+			case i == 0 && j == 1:
+				w = (1 - fx) * fy
+			case i == 1 && j == 1:
+				w = fx * fy
+			}
+			px, py := x0+i, y0+j
+			if px < 0 {
+				px = 0
+			} else if px >= sb.Dx() {
+				px = sb.Dx() - 1
+			}
+			if py < 0 {
+				py = 0
+			} else if py >= sb.Dy() {
+				py = sb.Dy() - 1
+			}
+			c := rgba64At(img, sb.Min.X+px, sb.Min.Y+py)
+			sum[0] += w * float64(c.R)
+			sum[1] += w * float64(c.G)
+			sum[2] += w * float64(c.B)
+			sum[3] += w * float64(c.A)
+		}
+	}
+	return color.RGBA64{uint16(sum[0] + 0.5), uint16(sum[1] + 0.5), uint16(sum[2] + 0.5), uint16(sum[3] + 0.5)}
+}
@@ -0,0 +1,446 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/anthonynsimon/bild/adjust"
+	"github.com/anthonynsimon/bild/histogram"
+	"github.com/anthonynsimon/bild/parallel"
+	"github.com/goki/pi/filecat"
+)
+
+// Edits is a non-destructive edit recipe for a picture, which is applied
+// whenever it is rendered (see Apply), leaving the original image data
+// untouched.  It is stored in the XMP metadata, embedded in the file or in
+// the sidecar file, as gopix: properties.
+type Edits struct {
+
+	// crop rectangle in the straightened, oriented image at full size -- the whole image if empty
+	Crop image.Rectangle
+
+	// straighten rotation in degrees (+ = clockwise) about the center, keeping the image size -- applied before the crop
+	Straighten float64 `min:"-45" max:"45"`
+
+	// black level: the original level that is made black, from 0 to 0.5 -- see AutoLevels
+	Black float64 `min:"0" max:"0.5"`
+
+	// white level: the amount below full white of the original level that is made white, from 0 to 0.5 -- see AutoLevels
+	White float64 `min:"0" max:"0.5"`
+
+	// exposure adjustment in stops (EV) -- each stop doubles or halves the light
+	Exposure float64 `min:"-5" max:"5"`
+
+	// contrast adjustment, from -1 (flat) to 1 (double)
+	Contrast float64 `min:"-1" max:"1"`
+
+	// highlights adjustment, from -1 (darker, recovering detail) to 1 (brighter), affecting the bright tones
+	Highlights float64 `min:"-1" max:"1"`
+
+	// shadows adjustment, from -1 (darker) to 1 (brighter, opening up detail), affecting the dark tones
+	Shadows float64 `min:"-1" max:"1"`
+
+	// saturation adjustment, from -1 (grayscale) to 1 (double)
+	Saturation float64 `min:"-1" max:"1"`
+
+	// white balance color temperature adjustment, from -1 (cooler, bluer) to 1 (warmer, more yellow)
+	Temp float64 `min:"-1" max:"1"`
+
+	// white balance tint adjustment, from -1 (greener) to 1 (more magenta)
+	Tint float64 `min:"-1" max:"1"`
+}
+
+// IsZero returns true if there are no edits
+func (ed *Edits) IsZero() bool {
+	return *ed == Edits{}
+}
+
+// HasTone returns true if there are any tone or color adjustments
+func (ed *Edits) HasTone() bool {
+	return ed.Black != 0 || ed.White != 0 || ed.Exposure != 0 || ed.Contrast != 0 || ed.Highlights != 0 || ed.Shadows != 0 || ed.Saturation != 0 || ed.Temp != 0 || ed.Tint != 0
+}
+
+// Geometry returns just the crop and straighten of the edits,
+// without the tone and color adjustments
+func (ed *Edits) Geometry() Edits {
+	return Edits{Crop: ed.Crop, Straighten: ed.Straighten}
+}
+
+// Reorient updates the edits for a change in the orientation of the image
+// from given orientation to another, with given size of the image data
+// (before orientation), so they apply to the same part of the image: the
+// Crop is transformed along with the image, and the Straighten angle is
+// negated if the image is mirrored.
+func (ed *Edits) Reorient(from, to Orientations, size image.Point) {
+	if from == to {
+		return
+	}
+	if !ed.Crop.Empty() {
+		r := from.Inverse().OrientRect(ed.Crop, from.OrientSize(size))
+		ed.Crop = to.OrientRect(r, size)
+	}
+	_, ffl := from.Transform()
+	_, tfl := to.Transform()
+	if ffl != tfl {
+		ed.Straighten = -ed.Straighten
+	}
+}
+
+// xmpFloats returns the float valued edits keyed by XMP property
+func (ed *Edits) xmpFloats() map[string]*float64 {
+	return map[string]*float64{
+		"gopix:Straighten": &ed.Straighten,
+		"gopix:Black":      &ed.Black,
+		"gopix:White":      &ed.White,
+		"gopix:Exposure":   &ed.Exposure,
+		"gopix:Contrast":   &ed.Contrast,
+		"gopix:Highlights": &ed.Highlights,
+		"gopix:Shadows":    &ed.Shadows,
+		"gopix:Saturation": &ed.Saturation,
+		"gopix:Temp":       &ed.Temp,
+		"gopix:Tint":       &ed.Tint,
+	}
+}
+
+// SetFromXMP sets the edits from any corresponding properties present in given XMP
+func (ed *Edits) SetFromXMP(x *XMP) {
+	if cs, has := x.Get("gopix:Crop"); has {
+		var r image.Rectangle
+		_, err := fmt.Sscanf(cs, "%d,%d,%d,%d", &r.Min.X, &r.Min.Y, &r.Max.X, &r.Max.Y)
+		if err == nil {
+			ed.Crop = r.Canon()
+		}
+	}
+	for prop, fp := range ed.xmpFloats() {
+		if vs, has := x.Get(prop); has {
+			if v, err := strconv.ParseFloat(vs, 64); err == nil {
+				*fp = v
+			}
+		}
+	}
+}
+
+// UpdateXMP updates given XMP with the edits, deleting the properties
+// for any that are not set.  Returns true if anything changed.
+func (ed *Edits) UpdateXMP(x *XMP) bool {
+	chg := false
+	if !ed.Crop.Empty() {
+		r := ed.Crop
+		chg = x.Set("gopix:Crop", fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y))
+	} else {
+		chg = x.Delete("gopix:Crop")
+	}
+	for prop, fp := range ed.xmpFloats() {
+		if *fp != 0 {
+			chg = x.Set(prop, strconv.FormatFloat(*fp, 'g', -1, 64)) || chg
+		} else {
+			chg = x.Delete(prop) || chg
+		}
+	}
+	return chg
+}
+
+// Apply returns the image with the edits applied: straightened, cropped,
+// and then the tone and color adjustments.  The image is the oriented
+// image, which can be reduced in size (e.g., a thumbnail), and size is the
+// full size of the oriented image, which the Crop applies to (the size of
+// the image is used if size is zero).  Returns the image as is if there
+// are no edits.  16 bit images are kept at 16 bits.
+func (ed *Edits) Apply(img image.Image, size image.Point) image.Image {
+	if ed.IsZero() {
+		return img
+	}
+	isz := img.Bounds().Size()
+	if size == image.ZP {
+		size = isz
+	}
+	if ed.Straighten != 0 {
+		img = StraightenImage(img, ed.Straighten)
+	}
+	if !ed.Crop.Empty() && ed.Crop != image.Rect(0, 0, size.X, size.Y) {
+		r := ed.Crop
+		if isz != size { // scale to image
+			r.Min.X = r.Min.X * isz.X / size.X
+			r.Max.X = r.Max.X * isz.X / size.X
+			r.Min.Y = r.Min.Y * isz.Y / size.Y
+			r.Max.Y = r.Max.Y * isz.Y / size.Y
+		}
+		img = CropImage(img, r)
+	}
+	if ed.HasTone() {
+		img = ed.AdjustTone(img)
+	}
+	return img
+}
+
+// StraightenImage returns the image rotated by given number of degrees
+// (+ = clockwise) about its center, keeping the same size, so the corners
+// are cut off and the edges are transparent.  16 bit images are kept at 16 bits.
+func StraightenImage(img image.Image, deg float64) image.Image {
+	isz := img.Bounds().Size()
+	rimg := RotateImage(img, deg)
+	rsz := rimg.Bounds().Size()
+	off := image.Pt((rsz.X-isz.X)/2, (rsz.Y-isz.Y)/2)
+	return CropImage(rimg, image.Rectangle{Min: off, Max: off.Add(isz)})
+}
+
+// CropImage returns the part of the image within given rectangle, relative
+// to its bounds, as a new image with bounds at the origin.  16 bit images
+// are kept at 16 bits.
+func CropImage(img image.Image, r image.Rectangle) image.Image {
+	sb := img.Bounds()
+	r = r.Intersect(image.Rectangle{Max: sb.Size()})
+	if IsDeep(img) {
+		return remapDeep(img, r.Size(), func(x, y int, ssz image.Point) (int, int) {
+			return x + r.Min.X, y + r.Min.Y
+		})
+	}
+	dst := image.NewRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(dst, dst.Bounds(), img, sb.Min.Add(r.Min), draw.Src)
+	return dst
+}
+
+// toneRange is the maximum change in encoded value made by the Highlights
+// and Shadows adjustments, which keeps the tone curve monotonic
+const toneRange = 0.14
+
+// AutoLevelsClip is the proportion of the darkest and of the brightest
+// color values that are clipped to black and white by AutoLevels
+var AutoLevelsClip = 0.001
+
+// toneLUTs returns the lookup tables for the per-channel adjustments,
+// for encoded color values from 0 to n-1: the levels are applied to the
+// original values, the white balance and exposure to linear values, and
+// then the highlights, shadows and contrast to the encoded values.
+func (ed *Edits) toneLUTs(n int) [3][]float64 {
+	wb := [3]float64{math.Exp2(ed.Temp / 2), math.Exp2(-ed.Tint / 2), math.Exp2(-ed.Temp / 2)}
+	ev := math.Exp2(ed.Exposure)
+	lr := 1 - ed.Black - ed.White
+	var luts [3][]float64
+	for c := range luts {
+		luts[c] = make([]float64, n)
+		for i := range luts[c] {
+			e := float64(i) / float64(n-1)
+			if lr > 0 && lr != 1 {
+				e = math.Max(0, math.Min(1, (e-ed.Black)/lr))
+			}
+			v := srgbToLinear(e) * wb[c] * ev
+			if v > 1 {
+				v = 1
+			}
+			e = linearToSRGB(v)
+			// curves peaking at 1/3 and 2/3, normalized to 1
+			e += toneRange * 6.75 * (ed.Shadows*e*(1-e)*(1-e) + ed.Highlights*e*e*(1-e))
+			luts[c][i] = 0.5 + (e-0.5)*(1+ed.Contrast)
+		}
+	}
+	return luts
+}
+
+// AutoLevels sets the Black and White levels from the histogram of given
+// image, so that its darkest and brightest color values (see AutoLevelsClip)
+// become black and white.  The image should have the other edits applied,
+// except for the tone and color adjustments, which the levels come before,
+// and it can be reduced in size (e.g., a preview).  Transparent pixels,
+// e.g., the corners cut off by Straighten, are not counted.
+func (ed *Edits) AutoLevels(img image.Image) {
+	h := histogram.NewRGBAHistogram(img)
+	var bins [256]int
+	tot := 0
+	for i := range bins {
+		bins[i] = h.R.Bins[i] + h.G.Bins[i] + h.B.Bins[i]
+		if i == 0 {
+			bins[i] -= 3 * h.A.Bins[0]
+		}
+		tot += bins[i]
+	}
+	if tot == 0 {
+		return
+	}
+	clip := int(float64(tot) * AutoLevelsClip)
+	lo, hi := 0, 255
+	for sum := bins[lo]; sum <= clip && lo < 255; sum += bins[lo] {
+		lo++
+	}
+	for sum := bins[hi]; sum <= clip && hi > 0; sum += bins[hi] {
+		hi--
+	}
+	if hi <= lo {
+		return
+	}
+	ed.Black = math.Min(float64(lo)/255, 0.5)
+	ed.White = math.Min(float64(255-hi)/255, 0.5)
+}
+
+// toneAdjuster returns a function that applies the tone and color
+// adjustments to a premultiplied color with given alpha, for color values
+// from 0 to amax, using lookup tables with n steps.  It is safe for
+// concurrent use.
+func (ed *Edits) toneAdjuster(n, amax int) func(in [3]int, a int) [3]int {
+	luts := ed.toneLUTs(n)
+	sat := 1 + ed.Saturation
+	return func(in [3]int, a int) [3]int {
+		if a == 0 {
+			return in
+		}
+		var out [3]float64
+		for c, v := range in {
+			if a != amax { // un-premultiply
+				v = v * amax / a
+				if v > amax {
+					v = amax
+				}
+			}
+			out[c] = luts[c][v*(n-1)/amax]
+		}
+		if sat != 1 {
+			l := 0.2126*out[0] + 0.7152*out[1] + 0.0722*out[2]
+			for c := range out {
+				out[c] = l + (out[c]-l)*sat
+			}
+		}
+		var o [3]int
+		for c, v := range out {
+			switch {
+			case v < 0:
+				v = 0
+			case v > 1:
+				v = 1
+			}
+			o[c] = int(v*float64(amax)+0.5) * a / amax // premultiply
+		}
+		return o
+	}
+}
+
+// AdjustTone returns the image with the tone and color adjustments
+// (levels, Exposure, Contrast, Highlights, Shadows, Saturation, Temp, Tint)
+// applied, as an image.RGBA, or image.RGBA64 for 16 bit images.
+// The adjustments are combined into one pass, as the white balance and
+// exposure are done in linear light, which the separate bild/adjust
+// functions do not support, and 16 bit images are kept at 16 bits.
+func (ed *Edits) AdjustTone(img image.Image) image.Image {
+	if !IsDeep(img) {
+		px := ed.toneAdjuster(256, 0xff)
+		return adjust.Apply(img, func(c color.RGBA) color.RGBA {
+			o := px([3]int{int(c.R), int(c.G), int(c.B)}, int(c.A))
+			return color.RGBA{uint8(o[0]), uint8(o[1]), uint8(o[2]), c.A}
+		})
+	}
+	px := ed.toneAdjuster(iccLinearSteps, 0xffff)
+	sb := img.Bounds()
+	dst := image.NewRGBA64(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, sb.Min, draw.Src)
+	parallel.Line(sb.Dy(), func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < sb.Dx(); x++ {
+				po := dst.PixOffset(x, y)
+				pix := dst.Pix[po : po+8 : po+8]
+				var in [3]int
+				for c := range in {
+					in[c] = int(pix[2*c])<<8 | int(pix[2*c+1])
+				}
+				o := px(in, int(pix[6])<<8|int(pix[7]))
+				for c := range o {
+					pix[2*c] = uint8(o[c] >> 8)
+					pix[2*c+1] = uint8(o[c])
+				}
+			}
+		}
+	})
+	return dst
+}
+
+// ImageEdited returns the opened image for this file, oriented according
+// to the Orient setting, with the Edits applied, at full size, in its own
+// color space (see ToSRGB).  Errors are logged.
+func (pi *Info) ImageEdited() (image.Image, error) {
+	img, err := pi.ImageOriented()
+	if err != nil {
+		return img, err
+	}
+	return pi.Edits.Apply(img, image.ZP), nil
+}
+
+// ExportEdited saves the picture with its Edits applied to the given file,
+// in the format given by its extension, leaving the original file untouched.
+// The metadata is kept, with the orientation reset, as it is applied to the
+// saved image.  Uses DefaultSaveOptions if opts is nil.
+func (pi *Info) ExportEdited(fname string, opts *SaveOptions) error {
+	img, err := pi.ImageEdited()
+	if err != nil {
+		return err
+	}
+	so := DefaultSaveOptions
+	if opts != nil {
+		so = *opts
+	}
+	so.KeepMeta = false
+	epi := *pi
+	epi.File = fname
+	epi.Sup = filecat.SupportedFromFile(fname)
+	epi.Orient = Rotated0
+	epi.Size = img.Bounds().Size()
+	epi.Edits = Edits{}
+	err = SaveImage(fname, img, &so)
+	if err == nil {
+		err = epi.copyMetaFrom(pi)
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	epi.UpdateFileMod()
+	return epi.SaveMeta()
+}
+
+// copyMetaFrom copies the metadata from the file of given Info into this
+// file, which has just been saved: all of it for the same format, and
+// the exif data and ICC profile for Jpeg files from other formats.
+func (pi *Info) copyMetaFrom(opi *Info) error {
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		return err
+	}
+	switch {
+	case pi.Sup == opi.Sup:
+		odata, err := OpenBytes(opi.File)
+		if err != nil {
+			return err
+		}
+		data, err = CopyMeta(pi.Sup, data, odata)
+		if err != nil {
+			return err
+		}
+	case pi.Sup == filecat.Jpeg: // e.g., from HEIC or RAW
+		rm, _ := OpenRawMeta(opi.File)
+		if rm == nil {
+			return nil
+		}
+		if rm.Exif != nil {
+			data, err = SetJpegExif(data, rm.Exif)
+			if err != nil {
+				return err
+			}
+		}
+		if rm.ICC != nil {
+			data, err = SetJpegICC(data, rm.ICC)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	return os.WriteFile(pi.File, data, 0664)
+}
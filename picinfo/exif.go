@@ -12,8 +12,10 @@ import (
 	"image/jpeg"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/dsoprea/go-exif/v3"
@@ -25,15 +27,11 @@ import (
 // reference for all defined tags:
 // https://www.exiv2.org/tags.html
 
-// todo: support exif for other filetypes:
-// PNG: https://stackoverflow.com/questions/9542359/does-png-contain-exif-data-like-jpg
-// TIFF: this is a basic tiff thing -- but std go package does not support exif:
-// https://godoc.org/golang.org/x/image/tiff
-
 // OpenNewInfo opens file and reads the exif info for given file, returning
-// a new Info with that info all set.
+// a new Info with that info all set.  Any XMP sidecar file is merged over
+// the embedded metadata.
 func OpenNewInfo(fn string) (*Info, error) {
-	rawExif, err := OpenRawExif(fn)
+	rm, err := OpenRawMeta(fn)
 	if err != nil && err != exif.ErrNoExif {
 		log.Println(err)
 		return nil, err
@@ -43,7 +41,10 @@ func OpenNewInfo(fn string) (*Info, error) {
 		log.Println(err)
 		return nil, err
 	}
-	pi.ParseRawExif(rawExif)
+	pi.SetFromRawMeta(rm)
+	if x, serr := OpenSidecar(fn); serr == nil {
+		pi.SetFromXMP(x)
+	}
 	return pi, err
 }
 
@@ -62,57 +63,15 @@ func NewInfoForFile(fn string) (*Info, error) {
 	return pi, err
 }
 
-// OpenRawExif opens the raw exif data bytes from given file.
-// This is very crude and must parse and re-generate the exif before re-saving
-// to another file.
+// OpenRawExif opens the raw exif data bytes from given file, using the
+// format-specific container structure where supported (see OpenRawMeta).
+// The exif must be parsed and re-generated before re-saving to another file.
 func OpenRawExif(fn string) ([]byte, error) {
-	data, err := OpenBytes(fn)
-	if err != nil {
+	rm, err := OpenRawMeta(fn)
+	if rm == nil {
 		return nil, err
 	}
-	return exif.SearchAndExtractExif(data)
-	/*
-		sup := filecat.SupportedFromFile(fn)
-		switch sup {
-			// this is not working --
-		// case filecat.Heic:
-		// 	f, err := os.Open(fn)
-		// 	defer f.Close()
-		// 	if err != nil {
-		// 		return nil, err
-		// 	}
-		// 	return goheif.ExtractExif(f)
-		case filecat.Jpeg:
-			data, err := OpenBytes(fn)
-			if err != nil {
-				return nil, err
-			}
-			jmp := jpegstructure.NewJpegMediaParser()
-			intfc, err := jmp.ParseBytes(data)
-			if err != nil {
-				return exif.SearchAndExtractExif(data)
-			}
-			sl := intfc.(*jpegstructure.SegmentList)
-			_, s, err := sl.FindExif()
-			if err == exif.ErrNoExif {
-				return exif.SearchAndExtractExif(data)
-			}
-			if err != nil {
-				return exif.SearchAndExtractExif(data)
-			}
-			_, rawExif, err := s.Exif()
-			if err != nil {
-				return exif.SearchAndExtractExif(data)
-			}
-			return rawExif, err
-		default:
-			data, err := OpenBytes(fn)
-			if err != nil {
-				return nil, err
-			}
-			return exif.SearchAndExtractExif(data)
-		}
-	*/
+	return rm.Exif, err
 }
 
 // ParseRawExif parses the raw Exif data into our Info structure
@@ -169,10 +128,12 @@ func (pi *Info) ParseRawExif(rawExif []byte) {
 	lat := [4]float64{}
 	long := [4]float64{}
 	var gpstime []float64
+	altBelow := false
 	pi.Tags = make(map[string]string)
 	var dto time.Time
 	var dtd time.Time
 	var dtp time.Time
+	var ofo, ofd, ofp string // OffsetTime tags for each date
 	for _, e := range entries {
 		valString := e.FormattedFirst
 		// fmt.Printf("Tag: %s  Value: %s\n", e.TagName, valString)
@@ -195,6 +156,12 @@ func (pi *Info) ParseRawExif(rawExif []byte) {
 				log.Printf("File: %s err: %v\n", fnbase, err)
 				dtp = time.Time{}
 			}
+		case "OffsetTimeOriginal":
+			ofo = valString
+		case "OffsetTimeDigitized":
+			ofd = valString
+		case "OffsetTime":
+			ofp = valString
 		case "ImageNumber":
 			pi.Number = EntryToInt(&e)
 		case "PixelYDimension":
@@ -217,6 +184,34 @@ func (pi *Info) ParseRawExif(rawExif []byte) {
 			pi.Exposure.FocalLen = EntryToFloat(&e)
 		case "FNumber":
 			pi.Exposure.FStop = EntryToFloat(&e)
+		case "ExposureBiasValue":
+			pi.Exposure.Bias = EntryToFloat(&e)
+		case "ExposureProgram":
+			if ep := EntryToInt(&e); ep >= 0 && ep < int(ExposureProgramsN) {
+				pi.Exposure.Program = ExposurePrograms(ep)
+			}
+		case "MeteringMode":
+			pi.Exposure.Metering = MeteringFromExif(EntryToInt(&e))
+		case "Flash":
+			pi.Exposure.Flash.SetFromExif(EntryToInt(&e))
+		case "WhiteBalance":
+			pi.Exposure.ManualWB = EntryToInt(&e) == 1
+		case "Make":
+			pi.Camera.Make = strings.TrimSpace(valString)
+		case "Model":
+			pi.Camera.Model = strings.TrimSpace(valString)
+		case "BodySerialNumber":
+			pi.Camera.Serial = strings.TrimSpace(valString)
+		case "Software":
+			pi.Software = strings.TrimSpace(valString)
+		case "LensMake":
+			pi.Lens.Make = strings.TrimSpace(valString)
+		case "LensModel":
+			pi.Lens.Model = strings.TrimSpace(valString)
+		case "LensSerialNumber":
+			pi.Lens.Serial = strings.TrimSpace(valString)
+		case "LensSpecification":
+			pi.Lens.SetSpec(EntryToFloats(&e))
 		case "GPSLatitudeRef":
 			if valString == "N" {
 				lat[3] = 1
@@ -242,6 +237,7 @@ func (pi *Info) ParseRawExif(rawExif []byte) {
 		case "GPSAltitude":
 			pi.GPSLoc.Alt = EntryToFloat(&e)
 		case "GPSAltitudeRef":
+			altBelow = EntryToInt(&e) == 1
 		case "GPSBearing":
 			pi.GPSMisc.DestBearing = EntryToFloat(&e)
 		case "GPSDestBearing":
@@ -280,12 +276,45 @@ func (pi *Info) ParseRawExif(rawExif []byte) {
 			pi.Tags[e.TagName] = valString
 		}
 	}
+	if gpstime != nil {
+		durf := gpstime[0]*3600 + gpstime[1]*60 + gpstime[2]
+		// fmt.Printf("gpstime: %v  durf: %g\n", gpstime, durf)
+		pi.GPSDate = pi.GPSDate.Add(time.Duration(float64(time.Second) * durf))
+	}
+
+	ofs := ""
 	if !dto.IsZero() {
 		pi.DateTaken = dto
+		ofs = ofo
 	} else if !dtd.IsZero() {
 		pi.DateTaken = dtd
+		ofs = ofd
 	} else if !dtp.IsZero() {
 		pi.DateTaken = dtp
+		ofs = ofp
+	}
+	if !dto.IsZero() || !dtd.IsZero() || !dtp.IsZero() {
+		pi.ZoneSrc = NoZone
+	}
+	if ofs != "" {
+		off, err := ExifOffsetParser(ofs)
+		if err != nil {
+			log.Printf("File: %s err: %v\n", fnbase, err)
+		} else {
+			pi.SetZone(off, ZoneMeta)
+		}
+	}
+	if !pi.HasZone() && gpstime != nil && (!dto.IsZero() || !dtd.IsZero()) {
+		if off, ok := GPSZoneOffset(pi.DateTaken, pi.GPSDate); ok {
+			pi.SetZone(off, ZoneGPS)
+		}
+	}
+	if !dtp.IsZero() {
+		if off, err := ExifOffsetParser(ofp); ofp != "" && err == nil {
+			dtp = WallClockIn(dtp, FixedZone(off))
+		} else if pi.HasZone() { // same camera clock
+			dtp = WallClockIn(dtp, pi.DateTaken.Location())
+		}
 	}
 	if !dtp.IsZero() && !pi.DateTaken.Equal(dtp) {
 		pi.DateMod = dtp
@@ -305,111 +334,144 @@ func (pi *Info) ParseRawExif(rawExif []byte) {
 	}
 	pi.GPSLoc.Lat = DecDegFromDMS(lat[0], lat[1], lat[2])
 	pi.GPSLoc.Long = DecDegFromDMS(long[0], long[1], long[2])
-	if gpstime != nil {
-		durf := gpstime[0]*3600 + gpstime[1]*60 + gpstime[2]
-		// fmt.Printf("gpstime: %v  durf: %g\n", gpstime, durf)
-		pi.GPSDate = pi.GPSDate.Add(time.Duration(float64(time.Second) * durf))
+	if altBelow {
+		pi.GPSLoc.Alt = -pi.GPSLoc.Alt
 	}
 }
 
+// Standard exif tag ids used when deleting tags from an IfdBuilder
+const (
+	exifTagImageDescription = 0x010e
+	exifTagGPSIFD           = 0x8825
+)
+
 // UpdateExif reads the exif from file, and generates a new exif incorporating
 // changes from given Info.  if rootIfd != nil it is used as a starting point
 // otherwise it is generated from the rawExif, which also can be nil if starting fresh.
-// returns true if data was different and requires saving.
-func (pi *Info) UpdateExif(rawExif []byte, rootIfd *exif.Ifd) (ib *exif.IfdBuilder, updt bool, err error) {
-	return
-	/*
-		defer func() {
-			if state := recover(); state != nil {
-				err = state.(error)
-			}
-		}()
-		ci, err := NewInfoForFile(pi.File)
-		ci.ParseRawExif(rawExif)
-
-		if rootIfd == nil && rawExif != nil {
-			im := exif.NewIfdMappingWithStandard()
-			ti := exif.NewTagIndex()
-			_, index, err := exif.Collect(im, ti, rawExif)
-			if err != nil {
-				return nil, false, err
+// All existing tags not managed by Info (including the MakerNote) are retained
+// as-is.  Returns the list of Info fields that were different and require saving
+// (empty if nothing changed).
+func (pi *Info) UpdateExif(rawExif []byte, rootIfd *exif.Ifd) (ib *exif.IfdBuilder, updts []string, err error) {
+	// the exif library uses panics for many errors
+	defer func() {
+		if state := recover(); state != nil {
+			if serr, ok := state.(error); ok {
+				err = serr
+			} else {
+				err = fmt.Errorf("picinfo.UpdateExif: %v", state)
 			}
-			rootIfd = index.RootIfd
 		}
+	}()
+	ci := &Info{File: pi.File} // current info as recorded in the exif
+	ci.ParseRawExif(rawExif)
 
-		if rootIfd != nil {
-			ib = exif.NewIfdBuilderFromExistingChain(rootIfd)
-		} else {
-			im := exif.NewIfdMappingWithStandard()
-			ti := exif.NewTagIndex()
-			ib = exif.NewIfdBuilder(im, ti, exifcommon.IfdPathStandard, binary.BigEndian)
-		}
+	im, err := exifcommon.NewIfdMappingWithStandard()
+	if err != nil {
+		return nil, nil, err
+	}
+	ti := exif.NewTagIndex()
 
-		ifchld, err := exif.GetOrCreateIbFromRootIb(ib, "IFD")
-		if err != nil {
-			log.Printf("create path %s err: %s\n", "IFD", err)
-		}
-		exchld, err := exif.GetOrCreateIbFromRootIb(ib, "IFD/Exif")
+	if rootIfd == nil && rawExif != nil {
+		_, index, err := exif.Collect(im, ti, rawExif)
 		if err != nil {
-			log.Printf("create path %s err: %s\n", "IFD/Exif", err)
+			return nil, nil, err
 		}
+		rootIfd = index.RootIfd
+	}
 
-		if !ci.DateTaken.Equal(pi.DateTaken) {
-			err = ifchld.SetStandardWithName("DateTimeOriginal", exif.ExifFullTimestampString(pi.DateTaken))
-			if err != nil {
-				log.Printf("date set err: %s\n", err)
+	if rootIfd != nil {
+		ib = exif.NewIfdBuilderFromExistingChain(rootIfd)
+	} else {
+		ib = exif.NewIfdBuilder(im, ti, exifcommon.IfdStandardIfdIdentity, binary.BigEndian)
+	}
+
+	ifchld, err := exif.GetOrCreateIbFromRootIb(ib, "IFD")
+	if err != nil {
+		return nil, nil, fmt.Errorf("picinfo.UpdateExif: create path IFD: %w", err)
+	}
+	exchld, err := exif.GetOrCreateIbFromRootIb(ib, "IFD/Exif")
+	if err != nil {
+		return nil, nil, fmt.Errorf("picinfo.UpdateExif: create path IFD/Exif: %w", err)
+	}
+
+	set := func(cib *exif.IfdBuilder, field, tag string, val any) {
+		serr := cib.SetStandardWithName(tag, val)
+		if serr != nil {
+			log.Printf("File: %s set %s err: %s\n", pi.File, tag, serr)
+			if err == nil {
+				err = serr
 			}
-			updt = true
+			return
 		}
-		if ci.Number != pi.Number {
-			err = ifchld.SetStandardWithName("ImageNumber", intToLong(pi.Number))
-			if err != nil {
-				log.Printf("number set err: %s\n", err)
-			}
-			updt = true
+		if field != "" {
+			updts = append(updts, field)
 		}
-		if ci.Size.Y != pi.Size.Y {
-			err = exchld.SetStandardWithName("PixelYDimension", intToLong(pi.Size.Y))
-			if err != nil {
-				log.Printf("pix set err: %s\n", err)
-			}
-			updt = true
+	}
+
+	if !pi.DateTaken.IsZero() && (!ci.DateTaken.Equal(pi.DateTaken) || pi.zoneDiffers(ci)) {
+		set(exchld, "DateTaken", "DateTimeOriginal", ExifDateString(pi.DateTaken))
+		if pi.HasZone() {
+			set(exchld, "ZoneSrc", "OffsetTimeOriginal", pi.DateTaken.Format(ExifOffsetFmt))
 		}
-		if ci.Size.X != pi.Size.X {
-			err = exchld.SetStandardWithName("PixelXDimension", intToLong(pi.Size.X))
-			if err != nil {
-				log.Printf("pix set err: %s\n", err)
-			}
-			updt = true
+	}
+	if pi.HasGPS() && !ci.GPSLoc.Near(pi.GPSLoc) {
+		gpschld, gerr := exif.GetOrCreateIbFromRootIb(ib, "IFD/GPSInfo")
+		if gerr != nil {
+			return nil, nil, fmt.Errorf("picinfo.UpdateExif: create path IFD/GPSInfo: %w", gerr)
 		}
-		if ci.Orient != pi.Orient {
-			err = ifchld.SetStandardWithName("Orientation", intToShort(int(pi.Orient)))
-			if err != nil {
-				log.Printf("orient set err: %s\n", err)
-			}
-			updt = true
+		if ci.GPSLoc == (GPSCoord{}) {
+			set(gpschld, "", "GPSVersionID", gpsVersion)
 		}
-		if ci.Desc != pi.Desc {
-			err = ifchld.SetStandardWithName("ImageDescription", pi.Desc)
-			if err != nil {
-				log.Printf("desc set err: %s\n", err)
-			}
-			updt = true
-		}
-		// if ci.GPSLoc.Lat != pi.GPSLoc.Lat {
-		// 	childIb.SetStandardWithName("Orientation", uint16(pi.Orient))
-		// 	updt = true
-		// }
-		//
-		if updt {
-			pi.DateMod = time.Now()
-			err = ifchld.SetStandardWithName("DateTime", exif.ExifFullTimestampString(pi.DateMod))
-			if err != nil {
-				log.Printf("datetime set err: %s\n", err)
-			}
+		ar := uint8(0)
+		if pi.GPSLoc.Alt < 0 {
+			ar = 1
 		}
-		return ib, updt, err
-	*/
+		set(gpschld, "", "GPSLatitudeRef", GPSRef(pi.GPSLoc.Lat, "N", "S"))
+		set(gpschld, "", "GPSLatitude", exifRationals(GPSDMSRationals(pi.GPSLoc.Lat)...))
+		set(gpschld, "", "GPSLongitudeRef", GPSRef(pi.GPSLoc.Long, "E", "W"))
+		set(gpschld, "", "GPSLongitude", exifRationals(GPSDMSRationals(pi.GPSLoc.Long)...))
+		set(gpschld, "", "GPSAltitudeRef", []uint8{ar})
+		set(gpschld, "GPSLoc", "GPSAltitude", exifRationals([2]uint32{uint32(math.Round(math.Abs(pi.GPSLoc.Alt) * 1000)), 1000}))
+	}
+	if !pi.HasGPS() && ci.HasGPS() {
+		if _, derr := ifchld.DeleteAll(exifTagGPSIFD); derr != nil {
+			log.Printf("File: %s delete GPS err: %s\n", pi.File, derr)
+			err = derr
+		}
+		updts = append(updts, "GPSLoc")
+	}
+	if ci.Number != pi.Number {
+		set(ifchld, "Number", "ImageNumber", intToLong(pi.Number))
+	}
+	if pi.Size.X != 0 && ci.Size.X != pi.Size.X {
+		set(exchld, "Size.X", "PixelXDimension", intToLong(pi.Size.X))
+	}
+	if pi.Size.Y != 0 && ci.Size.Y != pi.Size.Y {
+		set(exchld, "Size.Y", "PixelYDimension", intToLong(pi.Size.Y))
+	}
+	if pi.Orient != NoOrient && ci.Orient != pi.Orient {
+		set(ifchld, "Orient", "Orientation", intToShort(int(pi.Orient)))
+	}
+	if ci.Desc != pi.Desc {
+		if pi.Desc == "" {
+			_, err = ifchld.DeleteAll(exifTagImageDescription)
+			updts = append(updts, "Desc")
+		} else {
+			set(ifchld, "Desc", "ImageDescription", pi.Desc)
+		}
+	}
+	if err != nil {
+		return ib, updts, err
+	}
+
+	if len(updts) > 0 {
+		pi.DateMod = time.Now()
+		err = ifchld.SetStandardWithName("DateTime", ExifDateString(pi.DateMod))
+		if err != nil {
+			log.Printf("File: %s set DateTime err: %s\n", pi.File, err)
+		}
+	}
+	return ib, updts, err
 }
 
 // UpdateFileMod updates the modification time on the file
@@ -447,39 +509,50 @@ func (pi *Info) SaveJpegUpdated() error {
 		}
 	}
 	if pi.Size == image.ZP {
-		img, err := jpeg.Decode(bytes.NewBuffer(data))
+		cfg, err := jpeg.DecodeConfig(bytes.NewBuffer(data))
 		if err == nil {
-			pi.Size = img.Bounds().Size()
+			pi.Size = image.Point{cfg.Width, cfg.Height}
 		}
 	}
 
-	ib, updt, err := pi.UpdateExif(rawExif, rootIfd)
+	ib, updts, err := pi.UpdateExif(rawExif, rootIfd)
 	if err != nil {
+		log.Printf("File: %s UpdateExif err: %v -- trying failsafe\n", pi.File, err)
 		return pi.SaveJpegUpdatedFailsafe()
 	}
-	if !updt {
-		fmt.Printf("File: %s had no updates to Exif data\n", pi.File)
+	if len(updts) > 0 {
+		err = sl.SetExif(ib)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	sl, xupdts, iupdts := pi.UpdateJpegSegments(sl)
+	if len(updts) == 0 && xupdts == nil && iupdts == nil {
+		fmt.Printf("File: %s had no updates to metadata\n", pi.File)
 		return nil
 	}
-	sl.SetExif(ib)
+	fmt.Printf("File: %s updating Exif: %v  XMP: %v  IPTC: %v\n", pi.File, updts, xupdts, iupdts)
+
+	// encode fully before touching the file, so failures don't clobber it
+	var b bytes.Buffer
+	err = sl.Write(&b)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-
-	f, err := os.Create(pi.File)
+	err = os.WriteFile(pi.File, b.Bytes(), 0664)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-
-	err = sl.Write(f)
-	f.Close()
 	pi.UpdateFileMod()
 	return nil
 }
 
-// SaveJpegUpdatedFailsafe is a more robust version of jpeg updating when jpegstructure fails
+// SaveJpegUpdatedFailsafe is a more robust version of jpeg updating when jpegstructure fails.
+// The updated exif data is spliced into the file in place of the old, and
+// only if that fails is the image decoded and re-encoded, which is lossy.
 func (pi *Info) SaveJpegUpdatedFailsafe() error {
 	data, err := OpenBytes(pi.File)
 	if err != nil {
@@ -489,16 +562,45 @@ func (pi *Info) SaveJpegUpdatedFailsafe() error {
 	if err != nil {
 		return err
 	}
+	if pi.Size == image.ZP {
+		cfg, err := jpeg.DecodeConfig(bytes.NewBuffer(data))
+		if err == nil {
+			pi.Size = image.Point{cfg.Width, cfg.Height}
+		}
+	}
+	ib, _, err := pi.UpdateExif(rawExif, nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	ibe := exif.NewIfdByteEncoder()
+	exifData, err := ibe.EncodeToExif(ib)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	ndata, err := SetJpegExif(data, exifData)
+	if err == nil {
+		err = os.WriteFile(pi.File, ndata, 0664)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		pi.UpdateFileMod()
+		return nil
+	}
+	log.Printf("File: %s SetJpegExif err: %v -- re-encoding\n", pi.File, err)
 	// this is the problem with this approach: decoding and recoding is lossy over time..
 	img, err := jpeg.Decode(bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
-	return pi.SaveJpegUpdatedExif(rawExif, img)
+	return pi.SaveJpegExif(exifData, img, nil)
 }
 
-// SaveJpegNew saves a new Jpeg encoded file with exif data generated from current info
-func (pi *Info) SaveJpegNew(img image.Image) error {
+// SaveJpegNew saves a new Jpeg encoded file with exif data generated from current info.
+// Uses DefaultSaveOptions if opts is nil.
+func (pi *Info) SaveJpegNew(img image.Image, opts *SaveOptions) error {
 	ib, _, err := pi.UpdateExif(nil, nil)
 	if err != nil {
 		log.Println(err)
@@ -512,7 +614,7 @@ func (pi *Info) SaveJpegNew(img image.Image) error {
 		return err
 	}
 
-	return pi.SaveJpegExif(exifData, img)
+	return pi.SaveJpegExif(exifData, img, opts)
 }
 
 // AddExifPrefix adds the standard Exif00 prefix to given encoded exif data
@@ -534,7 +636,8 @@ func AddExifPrefix(exifData []byte) []byte {
 
 // SaveJpegUpdatedExif saves a new Jpeg encoded file with given raw bytes of exif data,
 // which is updated to current Info settings prior to saving.
-func (pi *Info) SaveJpegUpdatedExif(rawExif []byte, img image.Image) error {
+// Uses DefaultSaveOptions if opts is nil.
+func (pi *Info) SaveJpegUpdatedExif(rawExif []byte, img image.Image, opts *SaveOptions) error {
 	if pi.Size == image.ZP {
 		pi.Size = img.Bounds().Size()
 	}
@@ -549,12 +652,16 @@ func (pi *Info) SaveJpegUpdatedExif(rawExif []byte, img image.Image) error {
 		log.Println(err)
 		return err
 	}
-	return pi.SaveJpegExif(exifData, img)
+	return pi.SaveJpegExif(exifData, img, opts)
 }
 
 // SaveJpegExif saves a new Jpeg encoded file with given raw bytes of exif data
 // Note: rawExif does NOT have to have the standard Exif00 prefix already -- will be added
-func (pi *Info) SaveJpegExif(rawExif []byte, img image.Image) error {
+// Uses DefaultSaveOptions if opts is nil.
+func (pi *Info) SaveJpegExif(rawExif []byte, img image.Image, opts *SaveOptions) error {
+	if opts == nil {
+		opts = &DefaultSaveOptions
+	}
 	f, err := os.Create(pi.File)
 	if err != nil {
 		log.Println(err)
@@ -565,7 +672,7 @@ func (pi *Info) SaveJpegExif(rawExif []byte, img image.Image) error {
 	rawExif = AddExifPrefix(rawExif)
 
 	w, _ := newWriterExif(f, rawExif)
-	err = jpeg.Encode(w, img, &jpeg.Options{Quality: JpegEncodeQuality})
+	err = EncodeJpeg(w, img, opts)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -584,19 +691,29 @@ func intToShort(val int) []uint16 {
 	return []uint16{uint16(val)}
 }
 
+func exifRationals(vals ...[2]uint32) []exifcommon.Rational {
+	rs := make([]exifcommon.Rational, len(vals))
+	for i, v := range vals {
+		rs[i] = exifcommon.Rational{Numerator: v[0], Denominator: v[1]}
+	}
+	return rs
+}
+
+// ExifDateParser parses an Exif date string, which is a local wall-clock
+// time, as a time in DefaultZone (see SetZone for setting the actual zone).
 func ExifDateParser(ds string) (time.Time, error) {
-	dt, err := time.Parse("2006:01:02 15:04:05", ds)
+	dt, err := time.ParseInLocation(ExifDateFmt, ds, DefaultZone)
 	if err == nil {
 		return dt, err
 	}
 	if len(ds) == 11 { // some weird ones 2014:09:268
-		return time.Parse("2006:01:02", ds[:10])
+		return time.ParseInLocation("2006:01:02", ds[:10], DefaultZone)
 	}
 	if len(ds) == 10 {
-		return time.Parse("2006:01:02", ds)
+		return time.ParseInLocation("2006:01:02", ds, DefaultZone)
 	}
 	if len(ds) == 19 { // 2006:11:27:21:33:00
-		return time.Parse("2006:01:02:15:04:05", ds)
+		return time.ParseInLocation("2006:01:02:15:04:05", ds, DefaultZone)
 	}
 	return dt, err
 }
@@ -669,6 +786,9 @@ type IfdEntry struct {
 
 func EntryToInt(e *exif.ExifTag) int {
 	switch e.TagTypeId {
+	case exifcommon.TypeByte:
+		vl := e.Value.([]uint8)
+		return int(vl[0])
 	case exifcommon.TypeLong:
 		vl := e.Value.([]uint32)
 		return int(vl[0])
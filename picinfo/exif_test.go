@@ -0,0 +1,85 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-exif/v3"
+)
+
+// exifRoundTrip updates given raw exif (nil for new) from pi, returning the
+// encoded exif, the updated fields, and the Info read back from it
+func exifRoundTrip(t *testing.T, pi *Info, rawExif []byte) ([]byte, []string, *Info) {
+	ib, updts, err := pi.UpdateExif(rawExif, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := exif.NewIfdByteEncoder().EncodeToExif(ib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	npi := &Info{}
+	npi.ParseRawExif(raw)
+	return raw, updts, npi
+}
+
+func TestUpdateExif(t *testing.T) {
+	pi := &Info{
+		DateTaken: time.Date(2019, 7, 4, 13, 14, 15, 0, DefaultZone),
+		Number:    42,
+		Size:      image.Pt(640, 480),
+		Orient:    Rotated90R,
+		Desc:      "a picture",
+	}
+	raw, _, npi := exifRoundTrip(t, pi, nil)
+	if !npi.DateTaken.Equal(pi.DateTaken) || npi.Number != pi.Number || npi.Size != pi.Size ||
+		npi.Orient != pi.Orient || npi.Desc != pi.Desc {
+		t.Fatalf("new exif read back as %v %d %v %v %q", npi.DateTaken, npi.Number, npi.Size, npi.Orient, npi.Desc)
+	}
+	if d := npi.DateMod.Sub(pi.DateMod); d < -time.Second || d > time.Second {
+		t.Errorf("DateMod read back as %v, want %v", npi.DateMod, pi.DateMod)
+	}
+
+	// each field changed on its own in the existing exif
+	tests := []struct {
+		field string
+		set   func(pi *Info)
+		check func(npi *Info) bool
+	}{
+		{"DateTaken", func(pi *Info) { pi.DateTaken = pi.DateTaken.Add(time.Hour) },
+			func(npi *Info) bool { return npi.DateTaken.Equal(pi.DateTaken) }},
+		{"Number", func(pi *Info) { pi.Number = 7 },
+			func(npi *Info) bool { return npi.Number == 7 }},
+		{"Size.X", func(pi *Info) { pi.Size.X = 320 },
+			func(npi *Info) bool { return npi.Size.X == 320 }},
+		{"Size.Y", func(pi *Info) { pi.Size.Y = 240 },
+			func(npi *Info) bool { return npi.Size.Y == 240 }},
+		{"Orient", func(pi *Info) { pi.Orient = Rotated90L },
+			func(npi *Info) bool { return npi.Orient == Rotated90L }},
+		{"Desc", func(pi *Info) { pi.Desc = "another picture" },
+			func(npi *Info) bool { return npi.Desc == "another picture" }},
+		{"Desc", func(pi *Info) { pi.Desc = "" },
+			func(npi *Info) bool { return npi.Desc == "" }},
+	}
+	for _, tt := range tests {
+		tt.set(pi)
+		var updts []string
+		raw, updts, npi = exifRoundTrip(t, pi, raw)
+		if len(updts) != 1 || updts[0] != tt.field {
+			t.Errorf("%s: updated fields %v", tt.field, updts)
+		}
+		if !tt.check(npi) {
+			t.Errorf("%s: not read back: %+v", tt.field, npi)
+		}
+	}
+
+	// no changes
+	if _, updts, _ := exifRoundTrip(t, pi, raw); len(updts) != 0 {
+		t.Errorf("unchanged info updated fields %v", updts)
+	}
+}
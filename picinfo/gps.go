@@ -0,0 +1,128 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ParseGPSCoord parses a GPS location as entered by the user, which can
+// be decimal degrees, e.g., 37.7749, -122.4194 (as copied from most maps),
+// or degrees, minutes and seconds with N/S E/W references, e.g.,
+// 37°46'29.6"N 122°25'9.8"W, or 37 46 29.6 N, 122 25 9.8 W.
+// An optional altitude in meters can follow the longitude, separated by a comma.
+func ParseGPSCoord(s string) (GPSCoord, error) {
+	var gc GPSCoord
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return gc, fmt.Errorf("picinfo.ParseGPSCoord: empty location")
+	}
+	// symbols become spaces, keeping only numbers and references
+	ns := strings.Map(func(r rune) rune {
+		switch {
+		case r == ',' || r == ';':
+			return ','
+		case r == '-' || r == '+' || r == '.' || unicode.IsDigit(r):
+			return r
+		case strings.ContainsRune("NSEWnsew", r):
+			return unicode.ToUpper(r)
+		}
+		return ' '
+	}, s)
+	var parts []string
+	li := strings.IndexAny(ns, "NS")
+	if li >= 0 {
+		var rest string
+		if strings.Trim(ns[:li], " ,") == "" { // references before the numbers: N 37 46 29.6 W 122 25 9.8
+			gi := strings.IndexAny(ns, "EW")
+			if gi < li {
+				return gc, fmt.Errorf("picinfo.ParseGPSCoord: missing E/W longitude in: %q", s)
+			}
+			parts = append(parts, ns[:gi])
+			rest = ns[gi:]
+		} else { // references after the numbers: 37 46 29.6 N 122 25 9.8 W
+			parts = append(parts, ns[:li+1])
+			rest = ns[li+1:]
+		}
+		parts = append(parts, strings.Split(strings.TrimLeft(rest, " ,"), ",")...)
+	} else if strings.Contains(ns, ",") {
+		parts = strings.Split(ns, ",")
+	} else { // decimal degrees separated by spaces
+		parts = strings.Fields(ns)
+	}
+	for i := range parts {
+		parts[i] = strings.Trim(parts[i], " ,")
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return gc, fmt.Errorf("picinfo.ParseGPSCoord: expected latitude, longitude in: %q", s)
+	}
+	var err error
+	gc.Lat, err = parseGPSDeg(parts[0], 'N', 'S', 90)
+	if err != nil {
+		return gc, fmt.Errorf("picinfo.ParseGPSCoord: latitude: %w in: %q", err, s)
+	}
+	gc.Long, err = parseGPSDeg(parts[1], 'E', 'W', 180)
+	if err != nil {
+		return gc, fmt.Errorf("picinfo.ParseGPSCoord: longitude: %w in: %q", err, s)
+	}
+	if len(parts) == 3 {
+		gc.Alt, err = strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil {
+			return gc, fmt.Errorf("picinfo.ParseGPSCoord: altitude: %w in: %q", err, s)
+		}
+	}
+	return gc, nil
+}
+
+// parseGPSDeg parses one coordinate as decimal degrees or degrees, minutes
+// and seconds, with an optional pos or neg reference, within +/- max degrees
+func parseGPSDeg(s string, pos, neg byte, max float64) (float64, error) {
+	sign := 1.0
+	s = strings.TrimSpace(s)
+	for _, ref := range []byte{pos, neg} {
+		if i := strings.IndexByte(s, ref); i >= 0 {
+			s = s[:i] + s[i+1:]
+			if ref == neg {
+				sign = -1
+			}
+		}
+	}
+	fs := strings.Fields(s)
+	if len(fs) == 0 || len(fs) > 3 {
+		return 0, fmt.Errorf("invalid value")
+	}
+	var dms [3]float64
+	for i, f := range fs {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 && (v < 0 || v >= 60) {
+			return 0, fmt.Errorf("minutes and seconds must be in 0..60")
+		}
+		dms[i] = v
+	}
+	if dms[0] < 0 {
+		sign = -sign
+		dms[0] = -dms[0]
+	}
+	deg := sign * DecDegFromDMS(dms[0], dms[1], dms[2])
+	if deg < -max || deg > max {
+		return 0, fmt.Errorf("out of range +/-%g", max)
+	}
+	return deg, nil
+}
+
+// ClearGPS clears all the GPS info, returning true if there was any
+func (pi *Info) ClearGPS() bool {
+	had := pi.HasGPS()
+	pi.GPSLoc = GPSCoord{}
+	pi.GPSMisc = GPSMisc{}
+	pi.Place = Place{}
+	return had
+}
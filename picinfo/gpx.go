@@ -0,0 +1,210 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reference for the GPX format: https://www.topografix.com/GPX/1/1/
+
+// GPXPoint is one point of a GPX track log
+type GPXPoint struct {
+
+	// time of the point, in UTC
+	Time time.Time
+
+	// location of the point
+	Loc GPSCoord
+
+	// index of the track segment the point is in -- positions are
+	// not interpolated between segments
+	Seg int
+}
+
+// GPXTrack is a GPX track log, with all the timed points of all of
+// its tracks and segments, sorted by time
+type GPXTrack struct {
+
+	// file the track was read from
+	File string
+
+	// track points, sorted by time
+	Points []GPXPoint
+}
+
+// gpxFile is the part of the GPX file structure that is used
+type gpxFile struct {
+	Trks []struct {
+		Segs []struct {
+			Pts []struct {
+				Lat  float64 `xml:"lat,attr"`
+				Lon  float64 `xml:"lon,attr"`
+				Ele  float64 `xml:"ele"`
+				Time string  `xml:"time"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ParseGPX parses the track points of GPX file data.  Points without
+// a time are skipped, as they can't be matched to pictures.
+func ParseGPX(data []byte) (*GPXTrack, error) {
+	var gf gpxFile
+	err := xml.Unmarshal(data, &gf)
+	if err != nil {
+		return nil, fmt.Errorf("picinfo.ParseGPX: %w", err)
+	}
+	tr := &GPXTrack{}
+	seg := 0
+	for _, trk := range gf.Trks {
+		for _, sg := range trk.Segs {
+			for _, pt := range sg.Pts {
+				t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(pt.Time))
+				if err != nil {
+					continue
+				}
+				tr.Points = append(tr.Points, GPXPoint{Time: t.UTC(), Loc: GPSCoord{Lat: pt.Lat, Long: pt.Lon, Alt: pt.Ele}, Seg: seg})
+			}
+			seg++
+		}
+	}
+	if len(tr.Points) == 0 {
+		return nil, errors.New("picinfo.ParseGPX: no timed track points found")
+	}
+	sort.SliceStable(tr.Points, func(i, j int) bool {
+		return tr.Points[i].Time.Before(tr.Points[j].Time)
+	})
+	return tr, nil
+}
+
+// OpenGPX opens a GPX track log file
+func OpenGPX(fn string) (*GPXTrack, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := ParseGPX(data)
+	if err != nil {
+		return nil, err
+	}
+	tr.File = fn
+	return tr, nil
+}
+
+// GPSTrack returns a track made from the pictures that have a GPS location,
+// e.g., taken with a phone, which can be used to find the location of other
+// pictures taken around the same time -- nil if there are none.
+func (pc Pics) GPSTrack() *GPXTrack {
+	tr := &GPXTrack{}
+	for _, pi := range pc {
+		if pi.HasGPS() && !pi.DateTaken.IsZero() {
+			tr.Points = append(tr.Points, GPXPoint{Time: pi.DateTaken.UTC(), Loc: pi.GPSLoc})
+		}
+	}
+	if len(tr.Points) == 0 {
+		return nil
+	}
+	sort.SliceStable(tr.Points, func(i, j int) bool {
+		return tr.Points[i].Time.Before(tr.Points[j].Time)
+	})
+	return tr
+}
+
+// Start returns the time of the first track point
+func (tr *GPXTrack) Start() time.Time {
+	return tr.Points[0].Time
+}
+
+// End returns the time of the last track point
+func (tr *GPXTrack) End() time.Time {
+	return tr.Points[len(tr.Points)-1].Time
+}
+
+// LocAt returns the location at given time, linearly interpolated between
+// the track points before and after it if they are in the same segment and
+// no more than maxGap apart.  Otherwise the location of the nearest point
+// is used if it is within maxGap of the time.  Returns false if there is
+// no such point.
+func (tr *GPXTrack) LocAt(t time.Time, maxGap time.Duration) (GPSCoord, bool) {
+	n := len(tr.Points)
+	i := sort.Search(n, func(i int) bool {
+		return !tr.Points[i].Time.Before(t)
+	})
+	if i < n && tr.Points[i].Time.Equal(t) {
+		return tr.Points[i].Loc, true
+	}
+	if i > 0 && i < n {
+		p0, p1 := &tr.Points[i-1], &tr.Points[i]
+		span := p1.Time.Sub(p0.Time)
+		if p0.Seg == p1.Seg && span <= maxGap {
+			return InterpGPSCoord(p0.Loc, p1.Loc, float64(t.Sub(p0.Time))/float64(span)), true
+		}
+	}
+	var near *GPXPoint
+	var dist time.Duration
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= n {
+			continue
+		}
+		d := tr.Points[j].Time.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if near == nil || d < dist {
+			near, dist = &tr.Points[j], d
+		}
+	}
+	if near == nil || dist > maxGap {
+		return GPSCoord{}, false
+	}
+	return near.Loc, true
+}
+
+// InterpGPSCoord returns the location the given proportion of the way
+// from a to b, taking the shorter way across the 180 degree meridian.
+func InterpGPSCoord(a, b GPSCoord, p float64) GPSCoord {
+	dlong := b.Long - a.Long
+	if dlong > 180 {
+		dlong -= 360
+	} else if dlong < -180 {
+		dlong += 360
+	}
+	long := a.Long + p*dlong
+	if long > 180 {
+		long -= 360
+	} else if long < -180 {
+		long += 360
+	}
+	return GPSCoord{Lat: a.Lat + p*(b.Lat-a.Lat), Long: long, Alt: a.Alt + p*(b.Alt-a.Alt)}
+}
+
+// HasGPS returns true if the image has a GPS location
+func (pi *Info) HasGPS() bool {
+	return pi.GPSLoc.Lat != 0 || pi.GPSLoc.Long != 0
+}
+
+// SetGPSLoc sets the GPS location, returning true if it changed by more
+// than the precision with which it is stored (about a centimeter).
+func (pi *Info) SetGPSLoc(loc GPSCoord) bool {
+	if pi.HasGPS() && pi.GPSLoc.Near(loc) {
+		return false
+	}
+	pi.GPSLoc = loc
+	return true
+}
+
+// Near returns true if the coordinates are the same to within the precision
+// with which they are stored in the metadata
+func (gc GPSCoord) Near(oc GPSCoord) bool {
+	return math.Abs(gc.Lat-oc.Lat) < 1e-7 && math.Abs(gc.Long-oc.Long) < 1e-7 && math.Abs(gc.Alt-oc.Alt) < 0.01
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"testing"
+	"time"
+)
+
+var gpxTestData = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+ <trk><name>walk</name>
+  <trkseg>
+   <trkpt lat="45.5" lon="-122.6"><ele>30</ele><time>2019-07-04T20:00:00Z</time></trkpt>
+   <trkpt lat="45.6" lon="-122.4"><ele>50</ele><time>2019-07-04T20:10:00Z</time></trkpt>
+   <trkpt lat="45.7" lon="-122.3"><ele>60</ele></trkpt>
+   <trkpt lat="45.5" lon="-122.5"><ele>40</ele><time>2019-07-04T20:05:00.000Z</time></trkpt>
+  </trkseg>
+  <trkseg>
+   <trkpt lat="46" lon="-121"><time>2019-07-04T22:20:00+02:00</time></trkpt>
+   <trkpt lat="46.5" lon="-121"><time>2019-07-04T20:30:00Z</time></trkpt>
+  </trkseg>
+ </trk>
+</gpx>
+`
+
+func TestParseGPX(t *testing.T) {
+	tr, err := ParseGPX([]byte(gpxTestData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []GPXPoint{
+		{time.Date(2019, 7, 4, 20, 0, 0, 0, time.UTC), GPSCoord{45.5, -122.6, 30}, 0},
+		{time.Date(2019, 7, 4, 20, 5, 0, 0, time.UTC), GPSCoord{45.5, -122.5, 40}, 0},
+		{time.Date(2019, 7, 4, 20, 10, 0, 0, time.UTC), GPSCoord{45.6, -122.4, 50}, 0},
+		{time.Date(2019, 7, 4, 20, 20, 0, 0, time.UTC), GPSCoord{46, -121, 0}, 1},
+		{time.Date(2019, 7, 4, 20, 30, 0, 0, time.UTC), GPSCoord{46.5, -121, 0}, 1},
+	}
+	if len(tr.Points) != len(want) {
+		t.Fatalf("read %d points, want %d", len(tr.Points), len(want))
+	}
+	for i, p := range want {
+		if np := tr.Points[i]; !np.Time.Equal(p.Time) || np.Loc != p.Loc || np.Seg != p.Seg {
+			t.Errorf("point %d read as %+v, want %+v", i, np, p)
+		}
+	}
+
+	bad := []struct {
+		name string
+		data string
+	}{
+		{"truncated", gpxTestData[:len(gpxTestData)/2]},
+		{"truncated at end", gpxTestData[:len(gpxTestData)-12]},
+		{"empty", ""},
+		{"no times", `<gpx><trk><trkseg><trkpt lat="1" lon="2"></trkpt></trkseg></trk></gpx>`},
+		{"no points", `<gpx><wpt lat="1" lon="2"><time>2019-07-04T20:30:00Z</time></wpt></gpx>`},
+	}
+	for _, tt := range bad {
+		if _, err := ParseGPX([]byte(tt.data)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestGPXLocAt(t *testing.T) {
+	tr, err := ParseGPX([]byte(gpxTestData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(min, sec int) time.Time {
+		return time.Date(2019, 7, 4, 20, min, sec, 0, time.UTC)
+	}
+	tests := []struct {
+		name   string
+		t      time.Time
+		maxGap time.Duration
+		want   GPSCoord
+		ok     bool
+	}{
+		{"exact", at(0, 0), time.Minute, GPSCoord{45.5, -122.6, 30}, true},
+		{"interpolated", at(2, 30), 10 * time.Minute, GPSCoord{45.5, -122.55, 35}, true},
+		{"gap too large", at(2, 0), time.Minute, GPSCoord{}, false},
+		{"nearest", at(0, 30), time.Minute, GPSCoord{45.5, -122.6, 30}, true},
+		{"before start", at(0, 0).Add(-30 * time.Second), time.Minute, GPSCoord{45.5, -122.6, 30}, true},
+		{"long before start", at(0, 0).Add(-time.Hour), time.Minute, GPSCoord{}, false},
+		{"after end", at(31, 0), 2 * time.Minute, GPSCoord{46.5, -121, 0}, true},
+		{"between segments", at(14, 0), time.Hour, GPSCoord{45.6, -122.4, 50}, true},
+		{"in segment", at(28, 0), time.Hour, GPSCoord{46.4, -121, 0}, true},
+	}
+	for _, tt := range tests {
+		loc, ok := tr.LocAt(tt.t, tt.maxGap)
+		if ok != tt.ok || !loc.Near(tt.want) {
+			t.Errorf("%s: located at %v %v, want %v %v", tt.name, loc, ok, tt.want, tt.ok)
+		}
+	}
+
+	// across the 180 degree meridian
+	if c := InterpGPSCoord(GPSCoord{Long: 179}, GPSCoord{Long: -179}, 0.75); !c.Near(GPSCoord{Long: -179.5}) {
+		t.Errorf("interpolated across the meridian as %v", c)
+	}
+}
+
+func TestGPSRoundTrip(t *testing.T) {
+	locs := []GPSCoord{
+		{Lat: 45.5231, Long: -122.6765, Alt: 15.2},
+		{Lat: -33.856784, Long: 151.215297, Alt: 3.5},
+		{Lat: 31.5590, Long: 35.4732, Alt: -430.5}, // below sea level
+		{Lat: -0.000001, Long: 179.9999999, Alt: 0},
+	}
+	for _, loc := range locs {
+		pi := &Info{GPSLoc: loc}
+		_, updts, npi := exifRoundTrip(t, pi, nil)
+		if len(updts) != 1 || updts[0] != "GPSLoc" {
+			t.Errorf("%v: exif updated fields %v", loc, updts)
+		}
+		if !npi.GPSLoc.Near(loc) {
+			t.Errorf("%v: exif read back as %v", loc, npi.GPSLoc)
+		}
+
+		_, data, _ := newTestTiff(t)
+		data, updts, err := pi.UpdateTiff(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(updts) == 0 {
+			t.Errorf("%v: tiff not updated", loc)
+		}
+		npi = &Info{}
+		npi.ParseRawExif(data)
+		if !npi.GPSLoc.Near(loc) {
+			t.Errorf("%v: tiff read back as %v", loc, npi.GPSLoc)
+		}
+	}
+}
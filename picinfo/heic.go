@@ -0,0 +1,679 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// reference for the HEIF container, which is based on the ISO base media
+// file format (ISOBMFF, ISO/IEC 14496-12), with items described in ISO/IEC 23008-12:
+// https://nokiatech.github.io/heif/technical.html
+// All metadata is found through the item info (iinf) and item location (iloc)
+// boxes in the top-level meta box, without scanning the file data.
+
+// HeifBox is one ISOBMFF box
+type HeifBox struct {
+
+	// 4 letter box type, e.g., ftyp, meta, iloc
+	Type string
+
+	// box payload, not including the size and type header
+	Data []byte
+}
+
+// HeifExtent is one extent of item data in the file
+type HeifExtent struct {
+
+	// offset of the data, relative to the item base offset
+	Off uint64
+
+	// length of the data -- 0 means to the end of the file
+	Len uint64
+}
+
+// HeifItem is one item in a HEIF file, e.g., an image tile, the Exif
+// metadata, or the thumbnail image.
+type HeifItem struct {
+
+	// unique item id
+	ID uint32
+
+	// 4 letter item type, e.g., hvc1, grid, Exif, mime
+	Type string
+
+	// optional item name
+	Name string
+
+	// content (mime) type for mime items, e.g., application/rdf+xml for XMP
+	ContentType string
+
+	// construction method: 0 = file offset, 1 = idat box offset
+	Method int
+
+	// base offset for the extents
+	BaseOff uint64
+
+	// extents of item data
+	Extents []HeifExtent
+
+	// indexes into HeifMeta.Props of properties associated with this item
+	Props []int
+}
+
+// HeifMeta is the item metadata from the meta box of a HEIF file
+type HeifMeta struct {
+
+	// id of the primary item, which is the main image
+	Primary uint32
+
+	// all items, in order of the iinf box
+	Items []*HeifItem
+
+	// item references by type (thmb, cdsc, dimg, auxl), as from item id -> to item ids
+	Refs map[string]map[uint32][]uint32
+
+	// item property boxes from the ipco box, in order -- associations are 1-based
+	Props []HeifBox
+
+	// item data stored in the idat box
+	Idat []byte
+}
+
+// HeifXMPType is the content type of XMP mime items
+const HeifXMPType = "application/rdf+xml"
+
+// IsAvif returns true if given file is an AVIF file, which is a HEIF file
+// with AV1 instead of HEVC coded images, and the same metadata items
+func IsAvif(fn string) bool {
+	return strings.ToLower(filepath.Ext(fn)) == ".avif"
+}
+
+// ParseHeifBoxes parses the sequence of boxes in given data
+func ParseHeifBoxes(data []byte) ([]HeifBox, error) {
+	var boxes []HeifBox
+	pos := 0
+	for pos+8 <= len(data) {
+		sz := uint64(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		hdr := 8
+		switch sz {
+		case 0: // to end
+			sz = uint64(len(data) - pos)
+		case 1:
+			if pos+16 > len(data) {
+				return boxes, fmt.Errorf("picinfo.ParseHeifBoxes: box %s truncated", typ)
+			}
+			sz = binary.BigEndian.Uint64(data[pos+8:])
+			hdr = 16
+		}
+		if sz < uint64(hdr) || uint64(pos)+sz > uint64(len(data)) {
+			return boxes, fmt.Errorf("picinfo.ParseHeifBoxes: box %s truncated", typ)
+		}
+		boxes = append(boxes, HeifBox{Type: typ, Data: data[pos+hdr : pos+int(sz)]})
+		pos += int(sz)
+	}
+	return boxes, nil
+}
+
+// HeifBoxByType returns the first box of given type, nil if not found
+func HeifBoxByType(boxes []HeifBox, typ string) *HeifBox {
+	for i := range boxes {
+		if boxes[i].Type == typ {
+			return &boxes[i]
+		}
+	}
+	return nil
+}
+
+// heifReader reads big-endian values from box data, recording any
+// overrun as an error instead of panicking.
+type heifReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *heifReader) bytes(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.data) {
+		r.err = errors.New("picinfo: HEIF box data truncated")
+		return make([]byte, n)
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *heifReader) u8() uint8   { return r.bytes(1)[0] }
+func (r *heifReader) u16() uint16 { return binary.BigEndian.Uint16(r.bytes(2)) }
+func (r *heifReader) u32() uint32 { return binary.BigEndian.Uint32(r.bytes(4)) }
+
+// uN reads an unsigned value of given byte size: 0, 2, 4 or 8
+func (r *heifReader) uN(n int) uint64 {
+	switch n {
+	case 2:
+		return uint64(r.u16())
+	case 4:
+		return uint64(r.u32())
+	case 8:
+		return binary.BigEndian.Uint64(r.bytes(8))
+	}
+	return 0
+}
+
+// fullBox reads the version and flags of a full box
+func (r *heifReader) fullBox() (version int, flags uint32) {
+	vf := r.u32()
+	return int(vf >> 24), vf & 0xffffff
+}
+
+// cstring reads a null-terminated string
+func (r *heifReader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	i := bytes.IndexByte(r.data[r.pos:], 0)
+	if i < 0 {
+		s := string(r.data[r.pos:])
+		r.pos = len(r.data)
+		return s
+	}
+	s := string(r.data[r.pos : r.pos+i])
+	r.pos += i + 1
+	return s
+}
+
+func (r *heifReader) rest() []byte {
+	if r.err != nil || r.pos > len(r.data) {
+		return nil
+	}
+	return r.data[r.pos:]
+}
+
+// ParseHeifMeta parses the item metadata from the top-level meta box of
+// HEIF file data.
+func ParseHeifMeta(data []byte) (*HeifMeta, error) {
+	boxes, err := ParseHeifBoxes(data)
+	mb := HeifBox{}
+	if b := HeifBoxByType(boxes, "meta"); b != nil {
+		mb = *b
+	} else {
+		if err == nil {
+			err = errors.New("picinfo.ParseHeifMeta: no meta box found")
+		}
+		return nil, err
+	}
+	if ft := HeifBoxByType(boxes, "ftyp"); ft == nil {
+		return nil, errors.New("picinfo.ParseHeifMeta: not an ISOBMFF file")
+	}
+	if len(mb.Data) < 4 {
+		return nil, errors.New("picinfo.ParseHeifMeta: meta box truncated")
+	}
+	mboxes, err := ParseHeifBoxes(mb.Data[4:]) // full box
+	if err != nil {
+		log.Println(err)
+	}
+	hm := &HeifMeta{Refs: make(map[string]map[uint32][]uint32)}
+	for i := range mboxes {
+		b := &mboxes[i]
+		r := &heifReader{data: b.Data}
+		switch b.Type {
+		case "pitm":
+			if v, _ := r.fullBox(); v == 0 {
+				hm.Primary = uint32(r.u16())
+			} else {
+				hm.Primary = r.u32()
+			}
+		case "iinf":
+			hm.parseIinf(r)
+		case "iloc":
+			hm.parseIloc(r)
+		case "iref":
+			hm.parseIref(r)
+		case "iprp":
+			hm.parseIprp(b.Data)
+		case "idat":
+			hm.Idat = b.Data
+		}
+		if r.err != nil {
+			log.Printf("picinfo.ParseHeifMeta: %s box: %v\n", b.Type, r.err)
+		}
+	}
+	return hm, nil
+}
+
+// ReadHeifMeta reads the item metadata from a HEIF file of given size,
+// reading only the top-level box headers and the ftyp and meta boxes,
+// skipping over the media data.
+func ReadHeifMeta(r io.ReaderAt, size int64) (*HeifMeta, error) {
+	var data []byte // ftyp and meta boxes
+	pos := int64(0)
+	nbox := 0
+	for pos+8 <= size && nbox < 2 {
+		hdr, err := readAt(r, size, pos, 8)
+		if err != nil {
+			return nil, err
+		}
+		sz := int64(binary.BigEndian.Uint32(hdr))
+		typ := string(hdr[4:8])
+		hl := int64(8)
+		switch sz {
+		case 0: // to end
+			sz = size - pos
+		case 1:
+			xs, err := readAt(r, size, pos+8, 8)
+			if err != nil {
+				return nil, fmt.Errorf("picinfo.ReadHeifMeta: box %s truncated", typ)
+			}
+			sz = int64(binary.BigEndian.Uint64(xs))
+			hl = 16
+		}
+		if sz < hl || pos+sz > size {
+			return nil, fmt.Errorf("picinfo.ReadHeifMeta: box %s truncated", typ)
+		}
+		if typ == "ftyp" || typ == "meta" {
+			if sz-hl > math.MaxUint32-8 {
+				return nil, fmt.Errorf("picinfo.ReadHeifMeta: box %s too large", typ)
+			}
+			bd, err := readAt(r, size, pos+hl, int(sz-hl))
+			if err != nil {
+				return nil, err
+			}
+			bh := make([]byte, 8)
+			binary.BigEndian.PutUint32(bh, uint32(8+len(bd)))
+			copy(bh[4:], typ)
+			data = append(data, bh...)
+			data = append(data, bd...)
+			nbox++
+		}
+		pos += sz
+	}
+	return ParseHeifMeta(data)
+}
+
+// Item returns the item with given id, nil if not found
+func (hm *HeifMeta) Item(id uint32) *HeifItem {
+	for _, it := range hm.Items {
+		if it.ID == id {
+			return it
+		}
+	}
+	return nil
+}
+
+// item returns existing item with given id or adds a new one
+func (hm *HeifMeta) item(id uint32) *HeifItem {
+	if it := hm.Item(id); it != nil {
+		return it
+	}
+	it := &HeifItem{ID: id}
+	hm.Items = append(hm.Items, it)
+	return it
+}
+
+func (hm *HeifMeta) parseIinf(r *heifReader) {
+	v, _ := r.fullBox()
+	if v == 0 {
+		r.u16()
+	} else {
+		r.u32()
+	}
+	boxes, err := ParseHeifBoxes(r.rest())
+	if err != nil {
+		log.Println(err)
+	}
+	for i := range boxes {
+		b := &boxes[i]
+		if b.Type != "infe" {
+			continue
+		}
+		ir := &heifReader{data: b.Data}
+		iv, _ := ir.fullBox()
+		var it *HeifItem
+		switch {
+		case iv >= 2:
+			var id uint32
+			if iv == 2 {
+				id = uint32(ir.u16())
+			} else {
+				id = ir.u32()
+			}
+			ir.u16() // protection index
+			it = hm.item(id)
+			it.Type = string(ir.bytes(4))
+			it.Name = ir.cstring()
+			if it.Type == "mime" {
+				it.ContentType = ir.cstring()
+			}
+		default:
+			it = hm.item(uint32(ir.u16()))
+			ir.u16() // protection index
+			it.Name = ir.cstring()
+			it.ContentType = ir.cstring()
+			it.Type = "mime"
+		}
+		if ir.err != nil {
+			log.Printf("picinfo.ParseHeifMeta: infe box: %v\n", ir.err)
+		}
+	}
+}
+
+func (hm *HeifMeta) parseIloc(r *heifReader) {
+	v, _ := r.fullBox()
+	szs := r.u16()
+	offSz := int(szs >> 12)
+	lenSz := int((szs >> 8) & 0xf)
+	baseSz := int((szs >> 4) & 0xf)
+	idxSz := 0
+	if v == 1 || v == 2 {
+		idxSz = int(szs & 0xf)
+	}
+	var n uint32
+	if v < 2 {
+		n = uint32(r.u16())
+	} else {
+		n = r.u32()
+	}
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		var id uint32
+		if v < 2 {
+			id = uint32(r.u16())
+		} else {
+			id = r.u32()
+		}
+		it := hm.item(id)
+		if v == 1 || v == 2 {
+			it.Method = int(r.u16() & 0xf)
+		}
+		r.u16() // data reference index
+		it.BaseOff = r.uN(baseSz)
+		ne := int(r.u16())
+		it.Extents = make([]HeifExtent, ne)
+		for e := 0; e < ne; e++ {
+			r.uN(idxSz)
+			it.Extents[e].Off = r.uN(offSz)
+			it.Extents[e].Len = r.uN(lenSz)
+		}
+	}
+}
+
+func (hm *HeifMeta) parseIref(r *heifReader) {
+	v, _ := r.fullBox()
+	boxes, err := ParseHeifBoxes(r.rest())
+	if err != nil {
+		log.Println(err)
+	}
+	for i := range boxes {
+		b := &boxes[i]
+		br := &heifReader{data: b.Data}
+		for br.pos < len(br.data) && br.err == nil {
+			var from uint32
+			if v == 0 {
+				from = uint32(br.u16())
+			} else {
+				from = br.u32()
+			}
+			n := int(br.u16())
+			tos := make([]uint32, n)
+			for j := range tos {
+				if v == 0 {
+					tos[j] = uint32(br.u16())
+				} else {
+					tos[j] = br.u32()
+				}
+			}
+			rm := hm.Refs[b.Type]
+			if rm == nil {
+				rm = make(map[uint32][]uint32)
+				hm.Refs[b.Type] = rm
+			}
+			rm[from] = append(rm[from], tos...)
+		}
+	}
+}
+
+func (hm *HeifMeta) parseIprp(data []byte) {
+	boxes, err := ParseHeifBoxes(data)
+	if err != nil {
+		log.Println(err)
+	}
+	if pb := HeifBoxByType(boxes, "ipco"); pb != nil {
+		hm.Props, err = ParseHeifBoxes(pb.Data)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	for i := range boxes {
+		b := &boxes[i]
+		if b.Type != "ipma" {
+			continue
+		}
+		r := &heifReader{data: b.Data}
+		v, flags := r.fullBox()
+		n := r.u32()
+		for j := uint32(0); j < n && r.err == nil; j++ {
+			var id uint32
+			if v < 1 {
+				id = uint32(r.u16())
+			} else {
+				id = r.u32()
+			}
+			it := hm.item(id)
+			na := int(r.u8())
+			for a := 0; a < na; a++ {
+				var idx int
+				if flags&1 != 0 {
+					idx = int(r.u16() & 0x7fff)
+				} else {
+					idx = int(r.u8() & 0x7f)
+				}
+				if idx > 0 { // 0 = no property
+					it.Props = append(it.Props, idx-1)
+				}
+			}
+		}
+	}
+}
+
+// ItemData returns the data for given item, from the file data
+func (hm *HeifMeta) ItemData(data []byte, it *HeifItem) ([]byte, error) {
+	return hm.ItemDataAt(bytes.NewReader(data), int64(len(data)), it)
+}
+
+// ItemDataAt returns the data for given item, read from a file of given size
+func (hm *HeifMeta) ItemDataAt(r io.ReaderAt, size int64, it *HeifItem) ([]byte, error) {
+	if it.Method == 1 {
+		r = bytes.NewReader(hm.Idat)
+		size = int64(len(hm.Idat))
+	} else if it.Method != 0 {
+		return nil, fmt.Errorf("picinfo.HeifMeta.ItemData: item %d construction method %d not supported", it.ID, it.Method)
+	}
+	var out []byte
+	for _, ex := range it.Extents {
+		st := it.BaseOff + ex.Off
+		ed := st + ex.Len
+		if ex.Len == 0 {
+			ed = uint64(size)
+		}
+		if st > ed || ed > uint64(size) {
+			return nil, fmt.Errorf("picinfo.HeifMeta.ItemData: item %d extent out of range", it.ID)
+		}
+		b, err := readAt(r, size, int64(st), int(ed-st))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// ItemProp returns the property box of given type associated with the item,
+// nil if none.
+func (hm *HeifMeta) ItemProp(it *HeifItem, typ string) *HeifBox {
+	for _, idx := range it.Props {
+		if idx < len(hm.Props) && hm.Props[idx].Type == typ {
+			return &hm.Props[idx]
+		}
+	}
+	return nil
+}
+
+// ItemSize returns the image size of given item from its ispe property
+func (hm *HeifMeta) ItemSize(it *HeifItem) image.Point {
+	pb := hm.ItemProp(it, "ispe")
+	if pb == nil {
+		return image.Point{}
+	}
+	r := &heifReader{data: pb.Data}
+	r.fullBox()
+	w := int(r.u32())
+	h := int(r.u32())
+	if r.err != nil {
+		return image.Point{}
+	}
+	return image.Point{w, h}
+}
+
+// ItemDepth returns the number of bits per channel of given item from its
+// pixi property, 0 if not available
+func (hm *HeifMeta) ItemDepth(it *HeifItem) int {
+	pb := hm.ItemProp(it, "pixi")
+	if pb == nil {
+		return 0
+	}
+	r := &heifReader{data: pb.Data}
+	r.fullBox()
+	if nc := r.u8(); nc == 0 || r.err != nil {
+		return 0
+	}
+	return int(r.u8())
+}
+
+// ItemICC returns the ICC color profile of given item from its colr
+// property, nil if none -- there can also be a colr property with nclx
+// (coded) color info, which is not a profile.
+func (hm *HeifMeta) ItemICC(it *HeifItem) []byte {
+	for _, idx := range it.Props {
+		if idx >= len(hm.Props) || hm.Props[idx].Type != "colr" {
+			continue
+		}
+		d := hm.Props[idx].Data
+		if len(d) > 4 && (string(d[:4]) == "prof" || string(d[:4]) == "rICC") {
+			return d[4:]
+		}
+	}
+	return nil
+}
+
+// ItemsByType returns all items of given type
+func (hm *HeifMeta) ItemsByType(typ string) []*HeifItem {
+	var its []*HeifItem
+	for _, it := range hm.Items {
+		if it.Type == typ {
+			its = append(its, it)
+		}
+	}
+	return its
+}
+
+// ExifItem returns the Exif metadata item, nil if none
+func (hm *HeifMeta) ExifItem() *HeifItem {
+	its := hm.ItemsByType("Exif")
+	if len(its) == 0 {
+		return nil
+	}
+	return its[0]
+}
+
+// XMPItem returns the XMP metadata item, nil if none
+func (hm *HeifMeta) XMPItem() *HeifItem {
+	for _, it := range hm.ItemsByType("mime") {
+		if it.ContentType == HeifXMPType {
+			return it
+		}
+	}
+	return nil
+}
+
+// ThumbItem returns the thumbnail image item for the primary item, nil if none.
+// If there are multiple, the largest is returned.
+func (hm *HeifMeta) ThumbItem() *HeifItem {
+	var thumb *HeifItem
+	tsz := 0
+	for from, tos := range hm.Refs["thmb"] {
+		for _, to := range tos {
+			if to != hm.Primary {
+				continue
+			}
+			it := hm.Item(from)
+			if it == nil {
+				continue
+			}
+			sz := hm.ItemSize(it)
+			if thumb == nil || sz.X > tsz {
+				thumb = it
+				tsz = sz.X
+			}
+		}
+	}
+	return thumb
+}
+
+// HeifExifData returns the raw exif data, starting with the TIFF header,
+// from the data of an Exif item, which starts with the offset to the header.
+func HeifExifData(idata []byte) ([]byte, error) {
+	if len(idata) < 4 {
+		return nil, errors.New("picinfo.HeifExifData: Exif item truncated")
+	}
+	off := binary.BigEndian.Uint32(idata)
+	if uint64(off)+4 > uint64(len(idata)) {
+		return nil, errors.New("picinfo.HeifExifData: Exif item offset out of range")
+	}
+	return bytes.TrimPrefix(idata[4+off:], []byte("Exif\x00\x00")), nil
+}
+
+// ParseHeic parses the metadata from HEIC file data into RawMeta
+func (rm *RawMeta) ParseHeic(data []byte) error {
+	return rm.ReadHeic(bytes.NewReader(data), int64(len(data)))
+}
+
+// ReadHeic reads the metadata from a HEIC file of given size into RawMeta,
+// reading only the meta box and the metadata items
+func (rm *RawMeta) ReadHeic(r io.ReaderAt, size int64) error {
+	hm, err := ReadHeifMeta(r, size)
+	if err != nil {
+		return err
+	}
+	if pit := hm.Item(hm.Primary); pit != nil {
+		rm.Size = hm.ItemSize(pit)
+		rm.Depth = hm.ItemDepth(pit)
+		rm.ICC = hm.ItemICC(pit)
+	}
+	if it := hm.ExifItem(); it != nil {
+		idata, err := hm.ItemDataAt(r, size, it)
+		if err == nil {
+			rm.Exif, err = HeifExifData(idata)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	if it := hm.XMPItem(); it != nil {
+		rm.XMP, err = hm.ItemDataAt(r, size, it)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+// heifTestBox returns an ISOBMFF box of given type with the payloads
+func heifTestBox(typ string, payload ...[]byte) []byte {
+	b := make([]byte, 8)
+	copy(b[4:], typ)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	return b
+}
+
+// heifTestBytes returns the big-endian encoding of the values, which must
+// be uint8, uint16 or uint32, or strings, written with a null terminator
+func heifTestBytes(vals ...interface{}) []byte {
+	var b []byte
+	for _, v := range vals {
+		switch v := v.(type) {
+		case uint8:
+			b = append(b, v)
+		case uint16:
+			b = append(b, byte(v>>8), byte(v))
+		case uint32:
+			b = append(b, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(b[len(b)-4:], v)
+		case string:
+			b = append(append(b, v...), 0)
+		}
+	}
+	return b
+}
+
+var heifTestICC = []byte("not really an icc profile")
+
+// newTestHeic returns a generated HEIC file, with a primary image item,
+// a thumbnail for it, and Exif and XMP items, along with the item data,
+// by item id, which is stored in the mdat box after the meta box.
+func newTestHeic(t *testing.T) ([]byte, map[uint32][]byte) {
+	pi := &Info{Desc: "a heic picture", Number: 12}
+	exifData, _, _ := exifRoundTrip(t, pi, nil)
+	idata := map[uint32][]byte{
+		1: []byte("primary image coded data"),
+		2: []byte("thumbnail coded data"),
+		3: append(heifTestBytes(uint32(6)), append([]byte("Exif\x00\x00"), exifData...)...),
+		4: []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`),
+	}
+	ftyp := heifTestBox("ftyp", []byte("heic"), heifTestBytes(uint32(0)), []byte("mif1heic"))
+	meta := func(off uint32) []byte {
+		iloc := heifTestBytes(uint32(0), uint16(0x4400), uint16(4))
+		for id := uint32(1); id <= 4; id++ {
+			ln := uint32(len(idata[id]))
+			iloc = append(iloc, heifTestBytes(uint16(id), uint16(0), uint16(1), off, ln)...)
+			off += ln
+		}
+		return heifTestBox("meta", heifTestBytes(uint32(0)),
+			heifTestBox("hdlr", heifTestBytes(uint32(0), uint32(0)), []byte("pict"), make([]byte, 12), heifTestBytes("")),
+			heifTestBox("pitm", heifTestBytes(uint32(0), uint16(1))),
+			heifTestBox("iinf", heifTestBytes(uint32(0), uint16(4)),
+				heifTestBox("infe", heifTestBytes(uint32(2<<24), uint16(1), uint16(0)), []byte("hvc1"), heifTestBytes("")),
+				heifTestBox("infe", heifTestBytes(uint32(2<<24), uint16(2), uint16(0)), []byte("hvc1"), heifTestBytes("")),
+				heifTestBox("infe", heifTestBytes(uint32(2<<24), uint16(3), uint16(0)), []byte("Exif"), heifTestBytes("")),
+				heifTestBox("infe", heifTestBytes(uint32(2<<24), uint16(4), uint16(0)), []byte("mime"), heifTestBytes("XMP", HeifXMPType))),
+			heifTestBox("iloc", iloc),
+			heifTestBox("iref", heifTestBytes(uint32(0)),
+				heifTestBox("thmb", heifTestBytes(uint16(2), uint16(1), uint16(1))),
+				heifTestBox("cdsc", heifTestBytes(uint16(3), uint16(1), uint16(1), uint16(4), uint16(1), uint16(1)))),
+			heifTestBox("iprp",
+				heifTestBox("ipco",
+					heifTestBox("ispe", heifTestBytes(uint32(0), uint32(4032), uint32(3024))),
+					heifTestBox("pixi", heifTestBytes(uint32(0), uint8(3), uint8(10), uint8(10), uint8(10))),
+					heifTestBox("colr", []byte("nclx"), make([]byte, 7)),
+					heifTestBox("colr", []byte("prof"), heifTestICC),
+					heifTestBox("ispe", heifTestBytes(uint32(0), uint32(320), uint32(240)))),
+				heifTestBox("ipma", heifTestBytes(uint32(0), uint32(2),
+					uint16(1), uint8(4), uint8(0x81), uint8(2), uint8(3), uint8(4),
+					uint16(2), uint8(1), uint8(0x85)))))
+	}
+	ml := len(meta(0))
+	data := append(ftyp, meta(uint32(len(ftyp)+ml+8))...)
+	var mdat []byte
+	for id := uint32(1); id <= 4; id++ {
+		mdat = append(mdat, idata[id]...)
+	}
+	return append(data, heifTestBox("mdat", mdat)...), idata
+}
+
+func TestHeifMeta(t *testing.T) {
+	data, idata := newTestHeic(t)
+	rhm, err := ReadHeifMeta(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hm, err := ParseHeifMeta(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rhm.Items) != len(hm.Items) || len(rhm.Props) != len(hm.Props) {
+		t.Errorf("read %d items, %d props, parsed %d, %d", len(rhm.Items), len(rhm.Props), len(hm.Items), len(hm.Props))
+	}
+	if hm.Primary != 1 || len(hm.Items) != 4 || len(hm.Props) != 5 {
+		t.Fatalf("parsed primary %d, %d items, %d props", hm.Primary, len(hm.Items), len(hm.Props))
+	}
+	for id, want := range idata {
+		it := hm.Item(id)
+		if it == nil {
+			t.Errorf("item %d not found", id)
+			continue
+		}
+		if d, err := hm.ItemData(data, it); err != nil || !bytes.Equal(d, want) {
+			t.Errorf("item %d data read as %q %v", id, d, err)
+		}
+	}
+	items := []struct {
+		it    *HeifItem
+		id    uint32
+		typ   string
+		size  image.Point
+		depth int
+	}{
+		{hm.Item(hm.Primary), 1, "hvc1", image.Pt(4032, 3024), 10},
+		{hm.ThumbItem(), 2, "hvc1", image.Pt(320, 240), 0},
+		{hm.ExifItem(), 3, "Exif", image.Point{}, 0},
+		{hm.XMPItem(), 4, "mime", image.Point{}, 0},
+	}
+	for _, tt := range items {
+		if tt.it == nil || tt.it.ID != tt.id || tt.it.Type != tt.typ {
+			t.Errorf("item %d %s found as %+v", tt.id, tt.typ, tt.it)
+			continue
+		}
+		if sz, d := hm.ItemSize(tt.it), hm.ItemDepth(tt.it); sz != tt.size || d != tt.depth {
+			t.Errorf("item %d size, depth read as %v %d", tt.id, sz, d)
+		}
+	}
+	if icc := hm.ItemICC(hm.Item(1)); !bytes.Equal(icc, heifTestICC) {
+		t.Errorf("ICC read as %q", icc)
+	}
+	if tos := hm.Refs["cdsc"][4]; len(tos) != 1 || tos[0] != 1 {
+		t.Errorf("cdsc refs read as %v", hm.Refs["cdsc"])
+	}
+}
+
+func TestReadHeic(t *testing.T) {
+	data, idata := newTestHeic(t)
+	metaEnd := len(data) - 8
+	for _, id := range []uint32{1, 2, 3, 4} {
+		metaEnd -= len(idata[id])
+	}
+	tests := []struct {
+		n    int
+		err  bool
+		exif bool
+		xmp  bool
+		size bool
+	}{
+		{len(data), false, true, true, true},
+		{len(data) - len(idata[4]), false, true, false, true}, // XMP truncated
+		{metaEnd + 8, false, false, false, true},              // mdat header only
+		{metaEnd, false, false, false, true},
+		{metaEnd - 10, true, false, false, false}, // meta truncated
+		{30, true, false, false, false},
+		{4, true, false, false, false},
+		{0, true, false, false, false},
+	}
+	for _, tt := range tests {
+		rm := &RawMeta{}
+		err := rm.ParseHeic(data[:tt.n])
+		if (err != nil) != tt.err {
+			t.Errorf("truncated to %d: error %v", tt.n, err)
+		}
+		if (rm.Exif != nil) != tt.exif || (rm.XMP != nil) != tt.xmp || (rm.Size.X != 0) != tt.size {
+			t.Errorf("truncated to %d: read exif %v, xmp %v, size %v", tt.n, rm.Exif != nil, rm.XMP != nil, rm.Size)
+		}
+		if tt.n < len(data) {
+			continue
+		}
+		if rm.Size != image.Pt(4032, 3024) || rm.Depth != 10 || !bytes.Equal(rm.ICC, heifTestICC) {
+			t.Errorf("read size %v, depth %d, icc %q", rm.Size, rm.Depth, rm.ICC)
+		}
+		pi := &Info{}
+		pi.ParseRawExif(rm.Exif)
+		if pi.Desc != "a heic picture" || pi.Number != 12 {
+			t.Errorf("exif read as %q %d", pi.Desc, pi.Number)
+		}
+		if !bytes.Equal(rm.XMP, idata[4]) {
+			t.Errorf("XMP read as %q", rm.XMP)
+		}
+	}
+}
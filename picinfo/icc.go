@@ -0,0 +1,537 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"unicode/utf16"
+)
+
+// Wide-gamut images, e.g., Display P3 from phones and Adobe RGB from
+// cameras and scanners, have an embedded ICC color profile that gives
+// the meaning of their color values.  The image data is always kept as
+// is, with the profile preserved when saving, and it is only converted
+// to sRGB for thumbnails and display.  Only matrix / TRC profiles (RGB
+// and gray) are converted, which covers the profiles used for images --
+// LUT-based profiles, e.g., for CMYK, are left as is.
+// reference: https://www.color.org/specification/ICC.1-2022-05.pdf
+
+// JpegICCPrefix is the prefix of the APP2 segments holding the ICC profile,
+// which is followed by the 1-based sequence number and count of segments
+const JpegICCPrefix = "ICC_PROFILE\x00"
+
+// jpegAPP2 is the Jpeg marker for the ICC profile segments
+const jpegAPP2 = 0xe2
+
+// ICCProfile is a parsed ICC color profile
+type ICCProfile struct {
+
+	// raw profile data
+	Data []byte
+
+	// profile description, e.g., Display P3
+	Desc string
+
+	// 4 letter color space of the image data, e.g., "RGB ", "GRAY", "CMYK"
+	ColorSpace string
+
+	// 4 letter profile connection space, "XYZ " or "Lab "
+	PCS string
+
+	// red, green, blue colorants, as D50 XYZ values -- nil if not a matrix profile
+	Colorants [][3]float64
+
+	// tone reproduction curves for red, green, blue, or the single gray curve
+	TRC []*ICCCurve
+}
+
+// ICCCurve is an ICC tone reproduction curve, which maps encoded color
+// values to linear values, both in the 0..1 range
+type ICCCurve struct {
+
+	// table of values, evenly spaced over the input range -- if empty, Params are used
+	Table []float64
+
+	// parametric curve function type, from 0 to 4
+	Type int
+
+	// parametric curve parameters: g, a, b, c, d, e, f as used by Type
+	Params [7]float64
+}
+
+// Eval returns the linear value for given encoded value
+func (cv *ICCCurve) Eval(x float64) float64 {
+	if n := len(cv.Table); n > 0 {
+		if n == 1 {
+			return x
+		}
+		fi := x * float64(n-1)
+		i := int(fi)
+		if i >= n-1 {
+			return cv.Table[n-1]
+		}
+		if i < 0 {
+			return cv.Table[0]
+		}
+		f := fi - float64(i)
+		return cv.Table[i]*(1-f) + cv.Table[i+1]*f
+	}
+	p := &cv.Params
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	switch cv.Type {
+	case 1, 2:
+		if cv.Type == 1 {
+			c = 0
+		}
+		if a == 0 || x < -b/a {
+			return c
+		}
+		return math.Pow(a*x+b, g) + c
+	case 3, 4:
+		if cv.Type == 3 {
+			e, f = 0, 0
+		}
+		if x < d {
+			return c*x + f
+		}
+		return math.Pow(a*x+b, g) + e
+	}
+	return math.Pow(x, g)
+}
+
+// ParseICC parses the ICC profile data, including the tags needed for
+// converting to sRGB, and the description
+func ParseICC(data []byte) (*ICCProfile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errors.New("picinfo.ParseICC: not an ICC profile")
+	}
+	p := &ICCProfile{Data: data}
+	p.ColorSpace = string(data[16:20])
+	p.PCS = string(data[20:24])
+	tags := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < n; i++ {
+		ti := 132 + i*12
+		if ti+12 > len(data) {
+			return p, errors.New("picinfo.ParseICC: tag table truncated")
+		}
+		off := uint64(binary.BigEndian.Uint32(data[ti+4:]))
+		ln := uint64(binary.BigEndian.Uint32(data[ti+8:]))
+		if ln < 8 || off+ln > uint64(len(data)) {
+			continue
+		}
+		tags[string(data[ti:ti+4])] = data[off : off+ln]
+	}
+	p.Desc = iccText(tags["desc"])
+	switch p.ColorSpace {
+	case "RGB ":
+		for _, nm := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+			xyz, ok := iccXYZ(tags[nm])
+			if !ok {
+				p.Colorants = nil
+				break
+			}
+			p.Colorants = append(p.Colorants, xyz)
+		}
+		for _, nm := range []string{"rTRC", "gTRC", "bTRC"} {
+			cv, err := parseICCCurve(tags[nm])
+			if err != nil {
+				p.TRC = nil
+				break
+			}
+			p.TRC = append(p.TRC, cv)
+		}
+	case "GRAY":
+		if cv, err := parseICCCurve(tags["kTRC"]); err == nil {
+			p.TRC = []*ICCCurve{cv}
+		}
+	}
+	return p, nil
+}
+
+// iccFixed returns the s15Fixed16 number at the start of given data
+func iccFixed(d []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(d))) / 65536
+}
+
+// iccXYZ returns the value of an XYZ type tag
+func iccXYZ(d []byte) ([3]float64, bool) {
+	var xyz [3]float64
+	if len(d) < 20 || string(d[:4]) != "XYZ " {
+		return xyz, false
+	}
+	for i := range xyz {
+		xyz[i] = iccFixed(d[8+4*i:])
+	}
+	return xyz, true
+}
+
+// iccText returns the text of a desc (v2) or mluc (v4) type tag,
+// using the first language for mluc
+func iccText(d []byte) string {
+	if len(d) < 12 {
+		return ""
+	}
+	switch string(d[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(d[8:]))
+		if 12+n > len(d) {
+			return ""
+		}
+		return string(bytes.TrimRight(d[12:12+n], "\x00"))
+	case "mluc":
+		if len(d) < 28 || binary.BigEndian.Uint32(d[8:]) == 0 {
+			return ""
+		}
+		ln := int(binary.BigEndian.Uint32(d[20:]))
+		off := int(binary.BigEndian.Uint32(d[24:]))
+		if off+ln > len(d) {
+			return ""
+		}
+		u := make([]uint16, ln/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(d[off+2*i:])
+		}
+		return string(utf16.Decode(u))
+	}
+	return ""
+}
+
+// parseICCCurve parses a curv or para type tag
+func parseICCCurve(d []byte) (*ICCCurve, error) {
+	if len(d) < 12 {
+		return nil, errors.New("picinfo.ParseICC: curve missing")
+	}
+	cv := &ICCCurve{}
+	switch string(d[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(d[8:]))
+		if 12+2*n > len(d) {
+			return nil, errors.New("picinfo.ParseICC: curve truncated")
+		}
+		switch n {
+		case 0:
+			cv.Params[0] = 1
+		case 1: // u8Fixed8 gamma
+			cv.Params[0] = float64(binary.BigEndian.Uint16(d[12:])) / 256
+		default:
+			cv.Table = make([]float64, n)
+			for i := range cv.Table {
+				cv.Table[i] = float64(binary.BigEndian.Uint16(d[12+2*i:])) / 65535
+			}
+		}
+	case "para":
+		cv.Type = int(binary.BigEndian.Uint16(d[8:]))
+		np := []int{1, 3, 4, 5, 7}
+		if cv.Type >= len(np) || 12+4*np[cv.Type] > len(d) {
+			return nil, fmt.Errorf("picinfo.ParseICC: parametric curve type %d not supported", cv.Type)
+		}
+		for i := 0; i < np[cv.Type]; i++ {
+			cv.Params[i] = iccFixed(d[12+4*i:])
+		}
+	default:
+		return nil, fmt.Errorf("picinfo.ParseICC: curve type %q not supported", string(d[:4]))
+	}
+	return cv, nil
+}
+
+// CanConvert returns true if the profile is a matrix / TRC profile that
+// can be converted to sRGB
+func (p *ICCProfile) CanConvert() bool {
+	if p.PCS != "XYZ " {
+		return false
+	}
+	switch p.ColorSpace {
+	case "RGB ":
+		return len(p.Colorants) == 3 && len(p.TRC) == 3
+	case "GRAY":
+		return len(p.TRC) == 1
+	}
+	return false
+}
+
+// iccSRGBColorants are the D50 adapted red, green, blue colorants of sRGB
+var iccSRGBColorants = [3][3]float64{
+	{0.4361, 0.2225, 0.0139},
+	{0.3851, 0.7169, 0.0971},
+	{0.1431, 0.0606, 0.7141},
+}
+
+// iccXYZToSRGB converts D50 XYZ to linear sRGB (Bradford adapted to D65)
+var iccXYZToSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// IsSRGB returns true if the profile is equivalent to sRGB, so the image
+// does not need to be converted -- gray profiles with the sRGB curve are too.
+func (p *ICCProfile) IsSRGB() bool {
+	if !p.CanConvert() {
+		return false
+	}
+	for _, cv := range p.TRC {
+		if math.Abs(cv.Eval(0.5)-srgbToLinear(0.5)) > 0.005 {
+			return false
+		}
+	}
+	for c, xyz := range p.Colorants {
+		for i := range xyz {
+			if math.Abs(xyz[i]-iccSRGBColorants[c][i]) > 0.003 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// srgbToLinear returns the linear value for an sRGB encoded value
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB returns the sRGB encoded value for a linear value
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbMatrix returns the matrix that converts linear profile color values
+// to linear sRGB values -- the identity for gray
+func (p *ICCProfile) srgbMatrix() [3][3]float64 {
+	var m [3][3]float64
+	if len(p.Colorants) != 3 {
+		m[0][0], m[1][1], m[2][2] = 1, 1, 1
+		return m
+	}
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += iccXYZToSRGB[i][k] * p.Colorants[j][k]
+			}
+		}
+	}
+	return m
+}
+
+// iccLinearSteps is the number of steps in the lookup tables for linear values
+const iccLinearSteps = 4096
+
+// ToSRGB returns the image converted from this profile to sRGB, as an 8 bit
+// image.RGBA for thumbnails and display.  Returns the image as is if the
+// profile cannot be converted.
+func (p *ICCProfile) ToSRGB(img image.Image) image.Image {
+	if !p.CanConvert() {
+		return img
+	}
+	deep := IsDeep(img)
+	nin := 256
+	if deep {
+		nin = iccLinearSteps
+	}
+	var luts [3][]float64
+	for c := range luts {
+		cv := p.TRC[0]
+		if len(p.TRC) == 3 {
+			cv = p.TRC[c]
+		}
+		luts[c] = make([]float64, nin)
+		for i := range luts[c] {
+			luts[c][i] = cv.Eval(float64(i) / float64(nin-1))
+		}
+	}
+	enc := make([]uint8, iccLinearSteps)
+	for i := range enc {
+		enc[i] = uint8(linearToSRGB(float64(i)/(iccLinearSteps-1))*255 + 0.5)
+	}
+	m := p.srgbMatrix()
+	sb := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	if !deep {
+		draw.Draw(dst, dst.Bounds(), img, sb.Min, draw.Src)
+	}
+	var in [3]int
+	for y := 0; y < sb.Dy(); y++ {
+		for x := 0; x < sb.Dx(); x++ {
+			po := dst.PixOffset(x, y)
+			pix := dst.Pix[po : po+4 : po+4]
+			var a, amax int
+			if deep {
+				c := rgba64At(img, sb.Min.X+x, sb.Min.Y+y)
+				in = [3]int{int(c.R), int(c.G), int(c.B)}
+				a, amax = int(c.A), 0xffff
+			} else {
+				in = [3]int{int(pix[0]), int(pix[1]), int(pix[2])}
+				a, amax = int(pix[3]), 0xff
+			}
+			if a == 0 {
+				continue
+			}
+			var lin [3]float64
+			for c := range in {
+				v := in[c]
+				if a != amax { // un-premultiply
+					v = v * amax / a
+					if v > amax {
+						v = amax
+					}
+				}
+				lin[c] = luts[c][v*(nin-1)/amax]
+			}
+			for c := 0; c < 3; c++ {
+				v := m[c][0]*lin[0] + m[c][1]*lin[1] + m[c][2]*lin[2]
+				switch {
+				case v < 0:
+					v = 0
+				case v > 1:
+					v = 1
+				}
+				o := int(enc[int(v*(iccLinearSteps-1)+0.5)])
+				pix[c] = uint8(o * a / amax) // premultiply
+			}
+			pix[3] = uint8(a * 0xff / amax)
+		}
+	}
+	return dst
+}
+
+// JpegICC returns the ICC profile from Jpeg segments, assembled from the
+// APP2 segments it is split over, nil if none.
+func JpegICC(segs []JpegSegment) []byte {
+	pl := len(JpegICCPrefix)
+	var parts [][]byte
+	for i := range segs {
+		sg := &segs[i]
+		if sg.Marker != jpegAPP2 || len(sg.Data) < pl+2 || !bytes.HasPrefix(sg.Data, []byte(JpegICCPrefix)) {
+			continue
+		}
+		seq, n := int(sg.Data[pl]), int(sg.Data[pl+1])
+		if parts == nil {
+			parts = make([][]byte, n)
+		}
+		if seq < 1 || seq > len(parts) {
+			continue
+		}
+		parts[seq-1] = sg.Data[pl+2:]
+	}
+	var icc []byte
+	for _, pt := range parts {
+		if pt == nil {
+			return nil // incomplete
+		}
+		icc = append(icc, pt...)
+	}
+	return icc
+}
+
+// JpegICCSegments returns the APP2 segments for storing given ICC profile
+// in a Jpeg file, split to fit the segment size.
+func JpegICCSegments(icc []byte) []JpegSegment {
+	mx := JpegMaxSegment - len(JpegICCPrefix) - 2
+	n := (len(icc) + mx - 1) / mx
+	segs := make([]JpegSegment, n)
+	for i := range segs {
+		st := i * mx
+		ed := st + mx
+		if ed > len(icc) {
+			ed = len(icc)
+		}
+		d := append([]byte(JpegICCPrefix), byte(i+1), byte(n))
+		segs[i] = JpegSegment{Marker: jpegAPP2, Data: append(d, icc[st:ed]...)}
+	}
+	return segs
+}
+
+// isJpegICC returns true if the segment holds part of the ICC profile
+func isJpegICC(sg *JpegSegment) bool {
+	return sg.Marker == jpegAPP2 && bytes.HasPrefix(sg.Data, []byte(JpegICCPrefix))
+}
+
+// SetJpegICC returns the Jpeg data with given ICC profile stored in it,
+// after the leading APP0 and APP1 (Exif, XMP) segments, replacing any
+// profile it already has.
+func SetJpegICC(data, icc []byte) ([]byte, error) {
+	segs, err := ParseJpegSegments(data)
+	if err != nil {
+		return data, err
+	}
+	var b bytes.Buffer
+	b.Write(data[:2]) // SOI
+	pos := 2
+	for i := range segs {
+		sg := &segs[i]
+		if sg.Marker != 0xe0 && sg.Marker != jpegAPP1 && !isJpegICC(sg) {
+			break
+		}
+		if !isJpegICC(sg) {
+			writeJpegSegment(&b, sg)
+		}
+		pos += 4 + len(sg.Data)
+	}
+	isegs := JpegICCSegments(icc)
+	for i := range isegs {
+		writeJpegSegment(&b, &isegs[i])
+	}
+	b.Write(data[pos:])
+	return b.Bytes(), nil
+}
+
+// SaveJpegICC stores given ICC profile in the Jpeg file, e.g., after the
+// image has been re-encoded from another format.
+func (pi *Info) SaveJpegICC(icc []byte) error {
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	data, err = SetJpegICC(data, icc)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return os.WriteFile(pi.File, data, 0664)
+}
+
+// OpenICCProfile returns the ICC color profile embedded in given file,
+// reading only the metadata parts of the file.  Returns nil if there is no
+// profile.
+func OpenICCProfile(fn string) (*ICCProfile, error) {
+	rm, err := OpenRawMeta(fn)
+	if rm == nil {
+		return nil, err
+	}
+	if rm.ICC == nil {
+		return nil, nil
+	}
+	return ParseICC(rm.ICC)
+}
+
+// ToSRGB returns the image converted to sRGB for thumbnails and display,
+// if the file has an embedded ICC color profile that is not sRGB,
+// and the image as is otherwise.  Errors are logged.
+func (pi *Info) ToSRGB(img image.Image) image.Image {
+	p, err := OpenICCProfile(pi.File)
+	if err != nil {
+		log.Printf("File: %s ICC profile err: %v\n", pi.File, err)
+		return img
+	}
+	if p == nil || p.IsSRGB() {
+		return img
+	}
+	return p.ToSRGB(img)
+}
@@ -5,26 +5,24 @@
 package picinfo
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/gif"
-	"image/jpeg"
 	"image/png"
 	"io/ioutil"
 	"log"
 	"os"
 
 	"github.com/adrium/goheif"
-	"github.com/anthonynsimon/bild/transform"
 	"github.com/goki/pi/filecat"
 	"github.com/spakin/netpbm"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp" // registers the webp decoder
 )
 
-// JpegEncodeQuality is the default encoding quality for Jpeg files
-var JpegEncodeQuality = 90
-
 // GetSize returns the "raw" size of the image, either from info value
 // or directly from image -- this is the non-re-oriented size.
 // In general it is a good idea to ensure that images have their sizes saved!
@@ -71,16 +69,35 @@ func OpenBytes(fn string) ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
+// IsImage returns true if given file is an image file that can be opened,
+// including camera RAW and WebP files that are not otherwise known as
+// images by filecat.  AVIF files are not included, as there is no AVIF
+// decoder, so they could not be shown (see OpenImage).
+func IsImage(fn string) bool {
+	return filecat.SupportedFromFile(fn).Cat() == filecat.Image || IsRaw(fn) || IsWebp(fn)
+}
+
 // OpenImage opens an image from given filename.
-// Supports: png, jpeg, tiff, gif, bmp, pgm, pbm, ppm, pnm, and heic formats.
+// Supports: png, jpeg, tiff, gif, bmp, pgm, pbm, ppm, pnm, webp and heic formats,
+// and the embedded Jpeg preview of camera RAW files (see IsRaw).
+// AVIF files can only be opened if an "avif" image format decoder has been
+// registered with the image package, by importing its package, which is
+// not done here, so they are not included in IsImage.
 func OpenImage(fname string) (image.Image, error) {
 	typ := filecat.SupportedFromFile(fname)
 	// todo: deal with movies?
 	var img image.Image
 	var err error
-	switch typ {
-	case filecat.Heic:
+	switch {
+	case IsRaw(fname):
+		img, err = OpenRawPreview(fname)
+	case typ == filecat.Heic:
 		img, err = OpenHEIC(fname)
+	case IsAvif(fname):
+		img, err = OpenImageAuto(fname)
+		if err == image.ErrFormat {
+			err = errors.New("picinfo.OpenImage: no AVIF decoder is registered")
+		}
 	default:
 		img, err = OpenImageAuto(fname)
 	}
@@ -92,7 +109,7 @@ func OpenImage(fname string) (image.Image, error) {
 
 // OpenImageAuto opens an image from given filename.
 // Format is inferred automatically, using image package decoders registered.
-// Supports: png, jpeg, tiff, gif, bmp, pgm, pbm, ppm, pnm formats.
+// Supports: png, jpeg, tiff, gif, bmp, pgm, pbm, ppm, pnm, webp formats.
 func OpenImageAuto(fname string) (image.Image, error) {
 	file, err := os.Open(fname)
 	if err != nil {
@@ -105,36 +122,51 @@ func OpenImageAuto(fname string) (image.Image, error) {
 
 // SaveImage saves image to file, with format inferred from filename.
 // Supports: png, jpeg, tiff, gif, bmp, pgm, pbm, ppm, pnm formats.
-// Uses standard default options -- use encoder for other options.
-func SaveImage(fname string, im image.Image) error {
-	file, err := os.Create(fname)
-	if err != nil {
-		return err
+// Uses DefaultSaveOptions if opts is nil.  The image is fully encoded before
+// the file is written, so a failure does not clobber an existing file.
+func SaveImage(fname string, im image.Image, opts *SaveOptions) error {
+	if opts == nil {
+		opts = &DefaultSaveOptions
 	}
-	defer file.Close()
 	typ := filecat.SupportedFromFile(fname)
+	var b bytes.Buffer
+	var err error
 	switch typ {
 	case filecat.Png:
-		return png.Encode(file, im)
+		enc := &png.Encoder{CompressionLevel: opts.PngCompression.Level()}
+		err = enc.Encode(&b, im)
 	case filecat.Jpeg:
-		return jpeg.Encode(file, im, &jpeg.Options{Quality: JpegEncodeQuality})
+		err = EncodeJpeg(&b, im, opts)
 	case filecat.Tiff:
-		return tiff.Encode(file, im, &tiff.Options{Compression: tiff.Deflate}) // Deflate = ZIP = best
+		err = tiff.Encode(&b, im, opts.TiffCompression.Options())
 	case filecat.Gif:
-		return gif.Encode(file, im, nil)
+		err = gif.Encode(&b, im, nil)
 	case filecat.Bmp:
-		return bmp.Encode(file, im)
+		err = bmp.Encode(&b, im)
 	case filecat.Pgm:
-		return netpbm.Encode(file, im, &netpbm.EncodeOptions{Format: netpbm.PGM})
+		err = netpbm.Encode(&b, im, &netpbm.EncodeOptions{Format: netpbm.PGM})
 	case filecat.Pbm:
-		return netpbm.Encode(file, im, &netpbm.EncodeOptions{Format: netpbm.PBM})
+		err = netpbm.Encode(&b, im, &netpbm.EncodeOptions{Format: netpbm.PBM})
 	case filecat.Ppm:
-		return netpbm.Encode(file, im, &netpbm.EncodeOptions{Format: netpbm.PPM})
+		err = netpbm.Encode(&b, im, &netpbm.EncodeOptions{Format: netpbm.PPM})
 	case filecat.Pnm:
-		return netpbm.Encode(file, im, &netpbm.EncodeOptions{Format: netpbm.PNM})
+		err = netpbm.Encode(&b, im, &netpbm.EncodeOptions{Format: netpbm.PNM})
 	default:
 		return fmt.Errorf("picinfo.SaveImage: file type: %s not supported", typ.String())
 	}
+	if err != nil {
+		return err
+	}
+	data := b.Bytes()
+	if opts.KeepMeta {
+		if odata, oerr := OpenBytes(fname); oerr == nil {
+			data, err = CopyMeta(typ, data, odata)
+			if err != nil {
+				log.Printf("File: %s metadata not kept: %v\n", fname, err)
+			}
+		}
+	}
+	return os.WriteFile(fname, data, 0664)
 }
 
 // OpenHEIC opens a HEIC formatted file
@@ -153,27 +185,27 @@ func OpenHEIC(fname string) (image.Image, error) {
 	return img, nil
 }
 
-// OrientImage returns an image with the proper orientation as specified
+// OrientImage returns an image with the proper orientation as specified,
+// by applying its Transform.  16 bit images are kept at 16 bits.
 func OrientImage(img image.Image, orient Orientations) image.Image {
 	if orient <= Rotated0 || orient >= OrientUndef {
 		return img
 	}
-	opts := &transform.RotationOptions{ResizeBounds: true}
 	switch orient {
 	case FlippedH:
-		return transform.FlipH(img)
+		return FlipImageH(img)
 	case Rotated180:
-		return transform.Rotate(img, 180, opts)
+		return RotateImage(img, 180)
 	case FlippedV:
-		return transform.FlipV(img)
+		return FlipImageV(img)
 	case FlippedHRotated90L:
-		return transform.Rotate(transform.FlipH(img), 90, opts)
+		return RotateImage(FlipImageH(img), -90)
 	case Rotated90L:
-		return transform.Rotate(img, 90, opts)
+		return RotateImage(img, 90)
 	case FlippedHRotated90R:
-		return transform.Rotate(transform.FlipH(img), -90, opts)
+		return RotateImage(FlipImageH(img), 90)
 	case Rotated90R:
-		return transform.Rotate(img, -90, opts)
+		return RotateImage(img, -90)
 	}
 	return img
 }
@@ -7,7 +7,9 @@ package picinfo
 import (
 	"fmt"
 	"image"
+	"math"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/goki/ki/dirs"
@@ -45,9 +47,15 @@ type Info struct {
 	// orientation of the image using exif standards that include rotation and mirroring
 	Orient Orientations
 
-	// date when the image / video was taken
+	// date when the image / video was taken -- its location is the time zone
+	// where it was taken, so it sorts by the actual time, and formats as the
+	// local time there
 	DateTaken time.Time
 
+	// source of the time zone of DateTaken -- if NoZone, DateTaken is the local
+	// wall-clock time, interpreted in DefaultZone
+	ZoneSrc ZoneSources
+
 	// date when image was last modified / edited
 	DateMod time.Time
 
@@ -60,12 +68,44 @@ type Info struct {
 	// GPS version of the time
 	GPSDate time.Time
 
+	// place where the picture was taken, looked up from the GPS location
+	Place Place
+
+	// camera body that took the picture
+	Camera Camera
+
+	// lens used to take the picture
+	Lens Lens
+
+	// software used to create or last process the image
+	Software string
+
 	// standard exposure info
 	Exposure Exposure
 
+	// star rating from 0 (unrated) to 5 -- stored as xmp:Rating
+	Rating int
+
+	// pick / reject flag -- rejects are stored as xmp:Rating = -1, with the star rating kept in gopix:Rating
+	Pick Picks
+
+	// color label -- stored by name as xmp:Label
+	Label Labels
+
+	// keywords (tags) for people, places, topics etc -- can be hierarchical
+	// with levels separated by | e.g., Family|Kids|Anna
+	Keywords []string
+
 	// full set of name / value tags
 	Tags map[string]string
 
+	// user-defined name / value fields -- only stored in XMP metadata
+	User map[string]string
+
+	// non-destructive edits (crop, straighten, tone and color) applied when
+	// the picture is rendered -- only stored in XMP metadata
+	Edits Edits
+
 	// full path to thumb file name -- e.g., encoded as a .jpg
 	Thumb string `json:"-" view:"-"`
 
@@ -117,6 +157,18 @@ func (pi *Info) DiffsTo(npi *Info) []string {
 	if pi.Desc != npi.Desc {
 		dl = append(dl, fmt.Sprintf("Desc differs: %s != %s\n", pi.Desc, npi.Desc))
 	}
+	if pi.Rating != npi.Rating {
+		dl = append(dl, fmt.Sprintf("Rating differs: %v != %v\n", pi.Rating, npi.Rating))
+	}
+	if pi.Pick != npi.Pick {
+		dl = append(dl, fmt.Sprintf("Pick differs: %v != %v\n", pi.Pick, npi.Pick))
+	}
+	if pi.Label != npi.Label {
+		dl = append(dl, fmt.Sprintf("Label differs: %v != %v\n", pi.Label, npi.Label))
+	}
+	if strings.Join(pi.Keywords, ",") != strings.Join(npi.Keywords, ",") {
+		dl = append(dl, fmt.Sprintf("Keywords differs: %v != %v\n", pi.Keywords, npi.Keywords))
+	}
 	if pi.FileMod != npi.FileMod {
 		dl = append(dl, fmt.Sprintf("FileMod differs: %v != %v\n", pi.FileMod, npi.FileMod))
 	}
@@ -135,9 +187,12 @@ func (pi *Info) DiffsTo(npi *Info) []string {
 	if pi.Orient != npi.Orient {
 		dl = append(dl, fmt.Sprintf("Orient differs: %v != %v\n", pi.Orient, npi.Orient))
 	}
-	if pi.DateTaken != npi.DateTaken {
+	if !pi.DateTaken.Equal(npi.DateTaken) || ZoneOffset(pi.DateTaken) != ZoneOffset(npi.DateTaken) {
 		dl = append(dl, fmt.Sprintf("DateTaken differs: %v != %v\n", pi.DateTaken, npi.DateTaken))
 	}
+	if pi.ZoneSrc != npi.ZoneSrc {
+		dl = append(dl, fmt.Sprintf("ZoneSrc differs: %v != %v\n", pi.ZoneSrc, npi.ZoneSrc))
+	}
 	if pi.DateMod != npi.DateMod {
 		dl = append(dl, fmt.Sprintf("DateMod differs: %v != %v\n", pi.DateMod, npi.DateMod))
 	}
@@ -150,9 +205,24 @@ func (pi *Info) DiffsTo(npi *Info) []string {
 	if pi.GPSDate != npi.GPSDate {
 		dl = append(dl, fmt.Sprintf("GPSDate differs: %v != %v\n", pi.GPSDate, npi.GPSDate))
 	}
+	if pi.Place != npi.Place {
+		dl = append(dl, fmt.Sprintf("Place differs: %v != %v\n", pi.Place, npi.Place))
+	}
+	if pi.Camera != npi.Camera {
+		dl = append(dl, fmt.Sprintf("Camera differs: %v != %v\n", pi.Camera, npi.Camera))
+	}
+	if pi.Lens != npi.Lens {
+		dl = append(dl, fmt.Sprintf("Lens differs: %v != %v\n", pi.Lens, npi.Lens))
+	}
+	if pi.Software != npi.Software {
+		dl = append(dl, fmt.Sprintf("Software differs: %v != %v\n", pi.Software, npi.Software))
+	}
 	if pi.Exposure != npi.Exposure {
 		dl = append(dl, fmt.Sprintf("Exposure differs: %v != %v\n", pi.Exposure, npi.Exposure))
 	}
+	if pi.Edits != npi.Edits {
+		dl = append(dl, fmt.Sprintf("Edits differs: %v != %v\n", pi.Edits, npi.Edits))
+	}
 	return dl
 }
 
@@ -203,48 +273,75 @@ var KiT_Orientations = kit.Enums.AddEnum(OrientationsN, kit.NotBitFlag, nil)
 func (ev Orientations) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
 func (ev *Orientations) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
 
-// Rotate returns orientation updated with given +/-90 or 180 degree rotation.
+// Each orientation is the transform needed to display the image data,
+// which is a horizontal flip (or not) followed by a clockwise rotation in
+// 90 degree steps, as defined by the exif standard: e.g., Rotated90L
+// images are rotated 90 degrees clockwise to display them, and
+// FlippedHRotated90L (exif 5) images are flipped horizontally and then
+// rotated 270 degrees clockwise.  Rotating or flipping the displayed image
+// composes with this transform, giving another of the 8 orientations.
+
+// orientTransforms are the display transforms for each orientation,
+// as the number of clockwise 90 degree rotations after an optional flip
+var orientTransforms = map[Orientations]struct {
+	rot  int
+	flip bool
+}{
+	Rotated0:           {0, false},
+	FlippedH:           {0, true},
+	Rotated180:         {2, false},
+	FlippedV:           {2, true},
+	FlippedHRotated90L: {3, true},
+	Rotated90L:         {1, false},
+	FlippedHRotated90R: {1, true},
+	Rotated90R:         {3, false},
+}
+
+// Transform returns the transform to display the image: whether it is
+// flipped horizontally, followed by the number of clockwise 90 degree
+// rotations (0-3).  NoOrient and OrientUndef are treated as Rotated0.
+func (or Orientations) Transform() (rot int, flip bool) {
+	tr := orientTransforms[or]
+	return tr.rot, tr.flip
+}
+
+// OrientFromTransform returns the orientation for given display transform:
+// whether the image is flipped horizontally, followed by given number of
+// clockwise 90 degree rotations.
+func OrientFromTransform(rot int, flip bool) Orientations {
+	rot = ((rot % 4) + 4) % 4
+	for or, tr := range orientTransforms {
+		if tr.rot == rot && tr.flip == flip {
+			return or
+		}
+	}
+	return Rotated0
+}
+
+// Rotate returns orientation updated with given +/-90 or 180 degree rotation
+// (+ = right, clockwise) of the displayed image, for any orientation,
+// including flipped ones.  Other angles return the orientation as is.
 // In general, it goes the opposite of the name as that is what is done to compensate.
 func (or Orientations) Rotate(deg int) Orientations {
-	switch or {
-	case NoOrient, Rotated0, OrientUndef:
-		switch deg {
-		case 90:
-			return Rotated90L
-		case -90:
-			return Rotated90R
-		case 180:
-			return Rotated180
-		}
-	case Rotated90L:
-		switch deg {
-		case 90:
-			return Rotated180
-		case -90:
-			return Rotated0
-		case 180:
-			return Rotated90R
-		}
-	case Rotated90R:
-		switch deg {
-		case 90:
-			return Rotated0
-		case -90:
-			return Rotated180
-		case 180:
-			return Rotated90L
-		}
-	case Rotated180:
-		switch deg {
-		case 90:
-			return Rotated90R
-		case -90:
-			return Rotated90L
-		case 180:
-			return Rotated0
-		}
+	if deg%90 != 0 {
+		return or
 	}
-	return or
+	rot, flip := or.Transform()
+	return OrientFromTransform(rot+deg/90, flip)
+}
+
+// FlipH returns orientation updated with a horizontal flip (mirroring
+// left to right) of the displayed image
+func (or Orientations) FlipH() Orientations {
+	rot, flip := or.Transform()
+	return OrientFromTransform(-rot, !flip)
+}
+
+// FlipV returns orientation updated with a vertical flip (mirroring
+// top to bottom) of the displayed image
+func (or Orientations) FlipV() Orientations {
+	rot, flip := or.Transform()
+	return OrientFromTransform(2-rot, !flip)
 }
 
 // OrientSize returns the size after image is oriented accordingly
@@ -257,6 +354,31 @@ func (or Orientations) OrientSize(sz image.Point) image.Point {
 	return osz
 }
 
+// Inverse returns the orientation that undoes this one: the flipped
+// orientations are their own inverse, and rotations go the other way
+func (or Orientations) Inverse() Orientations {
+	rot, flip := or.Transform()
+	if flip {
+		return OrientFromTransform(rot, flip)
+	}
+	return OrientFromTransform(-rot, flip)
+}
+
+// OrientRect returns given rectangle in an image of given size,
+// transformed along with the image by the orientation, so that it covers
+// the same part of the oriented image
+func (or Orientations) OrientRect(r image.Rectangle, sz image.Point) image.Rectangle {
+	rot, flip := or.Transform()
+	if flip {
+		r.Min.X, r.Max.X = sz.X-r.Max.X, sz.X-r.Min.X
+	}
+	for i := 0; i < rot; i++ { // 90 clockwise: (x, y) -> (h - y, x)
+		r = image.Rect(sz.Y-r.Max.Y, r.Min.X, sz.Y-r.Min.Y, r.Max.X)
+		sz.X, sz.Y = sz.Y, sz.X
+	}
+	return r
+}
+
 // GPSCoord is a GPS position as decimal degrees
 type GPSCoord struct {
 
@@ -297,6 +419,27 @@ func DecDegFromDMS(degs, mins, secs float64) float64 {
 	return degs + mins/60 + secs/3600
 }
 
+// GPSDMSRationals returns the absolute value of given decimal degrees as
+// degrees, minutes and seconds rationals (numerator, denominator), as
+// stored in the exif GPSLatitude and GPSLongitude tags, with the
+// seconds at a precision of a millionth.
+func GPSDMSRationals(deg float64) [][2]uint32 {
+	us := int64(math.Round(math.Abs(deg) * 3600 * 1e6)) // micro-seconds of arc
+	degs := us / (3600 * 1e6)
+	mins := (us / (60 * 1e6)) % 60
+	secs := us % (60 * 1e6)
+	return [][2]uint32{{uint32(degs), 1}, {uint32(mins), 1}, {uint32(secs), 1e6}}
+}
+
+// GPSRef returns the exif GPS direction reference for given decimal degrees,
+// which is pos for positive values, and neg for negative values
+func GPSRef(deg float64, pos, neg string) string {
+	if deg < 0 {
+		return neg
+	}
+	return pos
+}
+
 // Exposure has standard exposure information
 type Exposure struct {
 
@@ -314,4 +457,19 @@ type Exposure struct {
 
 	// aperture
 	Aperture float64
+
+	// exposure bias (compensation) in EV
+	Bias float64
+
+	// exposure program mode, e.g., aperture priority
+	Program ExposurePrograms
+
+	// light metering mode
+	Metering MeteringModes
+
+	// flash status
+	Flash Flash
+
+	// white balance was set manually, instead of auto
+	ManualWB bool
 }
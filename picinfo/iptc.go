@@ -0,0 +1,245 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf8"
+)
+
+// reference for IPTC-IIM and Photoshop image resources:
+// https://www.iptc.org/std/IIM/4.2/specification/IIMV4.2.pdf
+// https://www.adobe.com/devnet-apps/photoshop/fileformatashtml/#50577409_pgfId-1037504
+
+// PhotoshopIPTCID is the Photoshop image resource id for IPTC-IIM data
+const PhotoshopIPTCID = 0x0404
+
+// PhotoshopResource is one Photoshop image resource block
+type PhotoshopResource struct {
+
+	// resource id
+	ID uint16
+
+	// pascal string name, as raw bytes (typically empty)
+	Name []byte
+
+	// resource data
+	Data []byte
+}
+
+// ParsePhotoshopIRB parses Photoshop image resource blocks
+func ParsePhotoshopIRB(data []byte) []PhotoshopResource {
+	var rs []PhotoshopResource
+	pos := 0
+	for pos+7 <= len(data) && string(data[pos:pos+4]) == "8BIM" {
+		r := PhotoshopResource{ID: binary.BigEndian.Uint16(data[pos+4:])}
+		nl := int(data[pos+6])
+		nsz := nl + 1
+		if nsz%2 != 0 {
+			nsz++
+		}
+		npos := pos + 6
+		if npos+nsz+4 > len(data) {
+			break
+		}
+		r.Name = data[npos+1 : npos+1+nl]
+		dpos := npos + nsz
+		sz := int(binary.BigEndian.Uint32(data[dpos:]))
+		dpos += 4
+		if sz < 0 || dpos+sz > len(data) {
+			break
+		}
+		r.Data = data[dpos : dpos+sz]
+		rs = append(rs, r)
+		pos = dpos + sz
+		if sz%2 != 0 {
+			pos++
+		}
+	}
+	return rs
+}
+
+// PhotoshopIRBBytes encodes the resource blocks
+func PhotoshopIRBBytes(rs []PhotoshopResource) []byte {
+	var b bytes.Buffer
+	for _, r := range rs {
+		b.WriteString("8BIM")
+		binary.Write(&b, binary.BigEndian, r.ID)
+		b.WriteByte(byte(len(r.Name)))
+		b.Write(r.Name)
+		if (len(r.Name)+1)%2 != 0 {
+			b.WriteByte(0)
+		}
+		binary.Write(&b, binary.BigEndian, uint32(len(r.Data)))
+		b.Write(r.Data)
+		if len(r.Data)%2 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes()
+}
+
+// PhotoshopResourceByID returns the resource with given id, nil if not found
+func PhotoshopResourceByID(rs []PhotoshopResource, id uint16) *PhotoshopResource {
+	for i := range rs {
+		if rs[i].ID == id {
+			return &rs[i]
+		}
+	}
+	return nil
+}
+
+// IPTCDataset is one IPTC-IIM dataset
+type IPTCDataset struct {
+
+	// record number, e.g., 2 for the application record
+	Record uint8
+
+	// dataset number within the record, e.g., 25 for Keywords
+	Tag uint8
+
+	// dataset value
+	Data []byte
+}
+
+// IPTC datasets used directly
+const (
+	iptcRecEnvelope   = 1
+	iptcRecApp        = 2
+	iptcTagCharset    = 90 // 1:90
+	iptcTagRecVersion = 0  // 2:00
+	iptcTagKeywords   = 25 // 2:25
+)
+
+// iptcUTF8 is the 1:90 coded character set value for UTF-8
+var iptcUTF8 = []byte("\x1b%G")
+
+// IPTCMaxKeyword is the maximum length of an IPTC keyword
+const IPTCMaxKeyword = 64
+
+// ParseIPTC parses IPTC-IIM data into its datasets
+func ParseIPTC(data []byte) []IPTCDataset {
+	var ds []IPTCDataset
+	pos := 0
+	for pos+5 <= len(data) && data[pos] == 0x1c {
+		d := IPTCDataset{Record: data[pos+1], Tag: data[pos+2]}
+		ln := int(binary.BigEndian.Uint16(data[pos+3:]))
+		pos += 5
+		if ln&0x8000 != 0 { // extended length
+			nl := ln & 0x7fff
+			if nl > 4 || pos+nl > len(data) {
+				break
+			}
+			ln = 0
+			for _, b := range data[pos : pos+nl] {
+				ln = ln<<8 | int(b)
+			}
+			pos += nl
+		}
+		if pos+ln > len(data) {
+			break
+		}
+		d.Data = data[pos : pos+ln]
+		ds = append(ds, d)
+		pos += ln
+	}
+	return ds
+}
+
+// IPTCBytes encodes the datasets as IPTC-IIM data
+func IPTCBytes(ds []IPTCDataset) []byte {
+	var b bytes.Buffer
+	for _, d := range ds {
+		b.Write([]byte{0x1c, d.Record, d.Tag})
+		if len(d.Data) < 0x8000 {
+			binary.Write(&b, binary.BigEndian, uint16(len(d.Data)))
+		} else {
+			binary.Write(&b, binary.BigEndian, uint16(0x8004))
+			binary.Write(&b, binary.BigEndian, uint32(len(d.Data)))
+		}
+		b.Write(d.Data)
+	}
+	return b.Bytes()
+}
+
+// insertIPTC inserts given dataset after all others of the same or lower
+// record number, as datasets must be in record order.
+func insertIPTC(ds []IPTCDataset, d IPTCDataset) []IPTCDataset {
+	i := 0
+	for i < len(ds) && ds[i].Record <= d.Record {
+		i++
+	}
+	return append(ds[:i], append([]IPTCDataset{d}, ds[i:]...)...)
+}
+
+// SetFromIPTC sets Info fields from any corresponding IPTC datasets
+func (pi *Info) SetFromIPTC(ds []IPTCDataset) {
+	var kws []string
+	for _, d := range ds {
+		if d.Record == iptcRecApp && d.Tag == iptcTagKeywords {
+			if kw := CleanKeyword(string(d.Data)); kw != "" {
+				kws = append(kws, kw)
+			}
+		}
+	}
+	if len(kws) > 0 {
+		pi.setKeywords(kws)
+	}
+}
+
+// UpdateIPTC returns the datasets updated with the current Info values,
+// retaining all other datasets, and the list of Info fields that changed.
+// IPTC keywords are flat, so the leaf name of each keyword is used.
+func (pi *Info) UpdateIPTC(ds []IPTCDataset) ([]IPTCDataset, []string) {
+	var cur, nds []IPTCDataset
+	hasCharset, hasVersion := false, false
+	for _, d := range ds {
+		switch {
+		case d.Record == iptcRecApp && d.Tag == iptcTagKeywords:
+			cur = append(cur, d)
+			continue
+		case d.Record == iptcRecEnvelope && d.Tag == iptcTagCharset:
+			hasCharset = true
+		case d.Record == iptcRecApp && d.Tag == iptcTagRecVersion:
+			hasVersion = true
+		}
+		nds = append(nds, d)
+	}
+	ascii := len(ds) > 0 && !hasCharset // unknown charset: stick to ascii
+	var kds []IPTCDataset
+	for _, lf := range pi.KeywordLeaves() {
+		if ascii {
+			lf = strings.Map(func(r rune) rune {
+				if r > 0x7e {
+					return '_'
+				}
+				return r
+			}, lf)
+		}
+		for len(lf) > IPTCMaxKeyword || !utf8.ValidString(lf) {
+			lf = lf[:len(lf)-1]
+		}
+		kds = append(kds, IPTCDataset{Record: iptcRecApp, Tag: iptcTagKeywords, Data: []byte(lf)})
+	}
+	chg := len(kds) != len(cur)
+	for i := 0; !chg && i < len(kds); i++ {
+		chg = !bytes.Equal(kds[i].Data, cur[i].Data)
+	}
+	if !chg {
+		return ds, nil
+	}
+	if len(ds) == 0 { // new data: declare utf-8
+		nds = append(nds, IPTCDataset{Record: iptcRecEnvelope, Tag: iptcTagCharset, Data: iptcUTF8})
+	}
+	if !hasVersion {
+		nds = insertIPTC(nds, IPTCDataset{Record: iptcRecApp, Tag: iptcTagRecVersion, Data: []byte{0, 4}})
+	}
+	for _, kd := range kds {
+		nds = insertIPTC(nds, kd)
+	}
+	return nds, []string{"Keywords"}
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var iptcTestDatasets = []IPTCDataset{
+	{Record: iptcRecEnvelope, Tag: iptcTagCharset, Data: iptcUTF8},
+	{Record: iptcRecApp, Tag: iptcTagRecVersion, Data: []byte{0, 4}},
+	{Record: iptcRecApp, Tag: iptcTagKeywords, Data: []byte("Anna")},
+	{Record: iptcRecApp, Tag: 120, Data: bytes.Repeat([]byte("long caption "), 3000)}, // extended length
+	{Record: iptcRecApp, Tag: iptcTagKeywords, Data: []byte("Zürich")},
+	{Record: iptcRecApp, Tag: 116, Data: nil},
+}
+
+func TestIPTC(t *testing.T) {
+	data := IPTCBytes(iptcTestDatasets)
+	ds := ParseIPTC(data)
+	if len(ds) != len(iptcTestDatasets) {
+		t.Fatalf("%d datasets written, %d read back", len(iptcTestDatasets), len(ds))
+	}
+	for i, d := range iptcTestDatasets {
+		if ds[i].Record != d.Record || ds[i].Tag != d.Tag || !bytes.Equal(ds[i].Data, d.Data) {
+			t.Errorf("dataset %d:%d read back as %d:%d %q", d.Record, d.Tag, ds[i].Record, ds[i].Tag, ds[i].Data)
+		}
+	}
+
+	// truncated data: only the whole datasets are read
+	var ends []int
+	for i := range iptcTestDatasets {
+		ends = append(ends, len(IPTCBytes(iptcTestDatasets[:i+1])))
+	}
+	for _, n := range []int{0, 3, 5, ends[0] + 2, ends[2], ends[2] + 6, ends[3] - 1, ends[4] + 4, len(data)} {
+		want := 0
+		for want < len(ends) && ends[want] <= n {
+			want++
+		}
+		if ds := ParseIPTC(data[:n]); len(ds) != want {
+			t.Errorf("truncated to %d bytes: read %d datasets, want %d", n, len(ds), want)
+		}
+	}
+}
+
+func TestPhotoshopIRB(t *testing.T) {
+	rs := []PhotoshopResource{
+		{ID: 0x03ed, Data: []byte{0, 0x48, 0, 1, 0, 1, 0, 0x48, 0, 1, 0, 1}},
+		{ID: 0x0424, Name: []byte("odd"), Data: []byte("odd data")},
+		{ID: PhotoshopIPTCID, Name: []byte("IPTC"), Data: IPTCBytes(iptcTestDatasets[:3])},
+		{ID: 0x0425, Data: []byte("data of odd len")},
+	}
+	data := PhotoshopIRBBytes(rs)
+	nrs := ParsePhotoshopIRB(data)
+	if len(nrs) != len(rs) {
+		t.Fatalf("%d resources written, %d read back", len(rs), len(nrs))
+	}
+	for i, r := range rs {
+		if nrs[i].ID != r.ID || !bytes.Equal(nrs[i].Name, r.Name) || !bytes.Equal(nrs[i].Data, r.Data) {
+			t.Errorf("resource 0x%04x read back as 0x%04x %q %q", r.ID, nrs[i].ID, nrs[i].Name, nrs[i].Data)
+		}
+	}
+	if r := PhotoshopResourceByID(nrs, PhotoshopIPTCID); r == nil || len(ParseIPTC(r.Data)) != 3 {
+		t.Errorf("IPTC resource read as %+v", r)
+	}
+
+	// truncated data: only the whole resources are read
+	var ends []int
+	for i, r := range rs {
+		ends = append(ends, len(PhotoshopIRBBytes(rs[:i+1]))-len(r.Data)%2) // without padding
+	}
+	for _, n := range []int{0, 4, 7, ends[0] - 1, ends[0], ends[1] + 9, ends[2] - 3, ends[3], len(data)} {
+		want := 0
+		for want < len(ends) && ends[want] <= n {
+			want++
+		}
+		if rs := ParsePhotoshopIRB(data[:n]); len(rs) != want {
+			t.Errorf("truncated to %d bytes: read %d resources, want %d", n, len(rs), want)
+		}
+	}
+}
+
+// iptcKeywords returns the keyword datasets, in order
+func iptcKeywords(ds []IPTCDataset) []string {
+	var kws []string
+	for _, d := range ds {
+		if d.Record == iptcRecApp && d.Tag == iptcTagKeywords {
+			kws = append(kws, string(d.Data))
+		}
+	}
+	return kws
+}
+
+func TestUpdateIPTC(t *testing.T) {
+	long := strings.Repeat("k", IPTCMaxKeyword-1) + "é"
+	ascii := []IPTCDataset{{Record: iptcRecApp, Tag: iptcTagRecVersion, Data: []byte{0, 4}}, {Record: iptcRecApp, Tag: 5, Data: []byte("title")}}
+	tests := []struct {
+		name  string
+		ds    []IPTCDataset
+		kws   []string
+		want  []string
+		updt  bool
+		utf8  bool
+		nsets int
+	}{
+		{"new", nil, []string{"Family|Kids|Anna", "Zürich"}, []string{"Anna", "Zürich"}, true, true, 4},
+		{"new long", nil, []string{long}, []string{long[:IPTCMaxKeyword-1]}, true, true, 3},
+		{"no keywords", nil, nil, nil, false, false, 0},
+		{"unchanged", iptcTestDatasets, []string{"Anna", "Zürich"}, []string{"Anna", "Zürich"}, false, true, len(iptcTestDatasets)},
+		{"changed", iptcTestDatasets, []string{"Places|Zürich", "Bob"}, []string{"Bob", "Zürich"}, true, true, len(iptcTestDatasets)},
+		{"removed", iptcTestDatasets, nil, nil, true, true, len(iptcTestDatasets) - 2},
+		{"ascii", ascii, []string{"Zürich"}, []string{"Z_rich"}, true, false, 3},
+	}
+	for _, tt := range tests {
+		pi := &Info{}
+		pi.setKeywords(tt.kws)
+		ds, updts := pi.UpdateIPTC(tt.ds)
+		if (len(updts) > 0) != tt.updt {
+			t.Errorf("%s: updated fields %v", tt.name, updts)
+		}
+		if kws := iptcKeywords(ds); strings.Join(kws, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: keywords %q, want %q", tt.name, kws, tt.want)
+		}
+		if len(ds) != tt.nsets {
+			t.Errorf("%s: %d datasets, want %d", tt.name, len(ds), tt.nsets)
+		}
+		hasUTF8 := len(ds) > 0 && ds[0].Record == iptcRecEnvelope && bytes.Equal(ds[0].Data, iptcUTF8)
+		if hasUTF8 != tt.utf8 {
+			t.Errorf("%s: utf-8 charset declared: %v", tt.name, hasUTF8)
+		}
+		for i := 1; i < len(ds); i++ {
+			if ds[i].Record < ds[i-1].Record {
+				t.Errorf("%s: datasets not in record order", tt.name)
+			}
+		}
+
+		// round trip through the encoded data
+		npi := &Info{}
+		npi.SetFromIPTC(ParseIPTC(IPTCBytes(ds)))
+		if strings.Join(npi.Keywords, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: keywords read back as %q", tt.name, npi.Keywords)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	jpegstructure "github.com/dsoprea/go-jpeg-image-structure/v2"
+)
+
+// reference for Jpeg segments and the metadata stored in them:
+// https://www.disktuning.com/jpeg/jpeg-markers.html (markers)
+// https://www.adobe.com/devnet/xmp.html (XMP part 3: storage in files)
+
+// JpegExifPrefix is the prefix of the APP1 segment holding the exif data
+const JpegExifPrefix = "Exif\x00\x00"
+
+// JpegXMPPrefix is the prefix of the APP1 segment holding the XMP packet
+const JpegXMPPrefix = "http://ns.adobe.com/xap/1.0/\x00"
+
+// JpegPhotoshopPrefix is the prefix of the APP13 segment holding
+// Photoshop image resources, including IPTC data
+const JpegPhotoshopPrefix = "Photoshop 3.0\x00"
+
+// JpegMaxSegment is the maximum size of the data in one Jpeg segment
+const JpegMaxSegment = 65533
+
+// Jpeg markers used directly
+const (
+	jpegSOI   = 0xd8
+	jpegSOS   = 0xda
+	jpegAPP1  = 0xe1
+	jpegAPP13 = 0xed
+)
+
+// JpegSegment is one marker segment in the header of a Jpeg file
+type JpegSegment struct {
+
+	// marker id, e.g., 0xe1 for APP1
+	Marker byte
+
+	// segment data, not including the marker and length
+	Data []byte
+}
+
+// ParseJpegSegments parses the header segments of Jpeg file data, up to
+// the start of the scan data.
+func ParseJpegSegments(data []byte) ([]JpegSegment, error) {
+	return ReadJpegSegments(bytes.NewReader(data), int64(len(data)))
+}
+
+// ReadJpegSegments reads the header segments of a Jpeg file of given size,
+// up to the start of the scan data, which is not read.
+func ReadJpegSegments(r io.ReaderAt, size int64) ([]JpegSegment, error) {
+	if b, err := readAt(r, size, 0, 2); err != nil || b[0] != 0xff || b[1] != jpegSOI {
+		return nil, errors.New("picinfo.ReadJpegSegments: not a Jpeg file")
+	}
+	var segs []JpegSegment
+	pos := int64(2)
+	for pos+4 <= size {
+		hdr, err := readAt(r, size, pos, 4)
+		if err != nil {
+			return segs, err
+		}
+		if hdr[0] != 0xff {
+			return segs, fmt.Errorf("picinfo.ReadJpegSegments: invalid marker at %d", pos)
+		}
+		mk := hdr[1]
+		if mk == 0xff { // fill byte
+			pos++
+			continue
+		}
+		ln := int(binary.BigEndian.Uint16(hdr[2:]))
+		if ln < 2 || pos+2+int64(ln) > size {
+			return segs, fmt.Errorf("picinfo.ReadJpegSegments: segment 0x%02x truncated", mk)
+		}
+		data, err := readAt(r, size, pos+4, ln-2)
+		if err != nil {
+			return segs, err
+		}
+		segs = append(segs, JpegSegment{Marker: mk, Data: data})
+		if mk == jpegSOS {
+			break
+		}
+		pos += 2 + int64(ln)
+	}
+	return segs, nil
+}
+
+// isJpegSOF returns true if marker is a start-of-frame marker
+func isJpegSOF(mk byte) bool {
+	return mk >= 0xc0 && mk <= 0xcf && mk != 0xc4 && mk != 0xc8 && mk != 0xcc
+}
+
+// SetJpegExif returns the Jpeg data with given raw exif data (with or
+// without the Exif00 prefix) replacing its exif APP1 segment, or inserted
+// after any APP0 segments if it has none.  The image data is copied as is,
+// so, unlike re-encoding, there is no loss.
+func SetJpegExif(data, rawExif []byte) ([]byte, error) {
+	rawExif = AddExifPrefix(rawExif)
+	if len(rawExif) > JpegMaxSegment {
+		return data, errors.New("picinfo.SetJpegExif: exif data is too large for a Jpeg segment")
+	}
+	segs, err := ParseJpegSegments(data)
+	if err != nil {
+		return data, err
+	}
+	if len(segs) == 0 || segs[len(segs)-1].Marker != jpegSOS {
+		return data, errors.New("picinfo.SetJpegExif: no image data found")
+	}
+	esg := JpegSegment{Marker: jpegAPP1, Data: rawExif}
+	var b bytes.Buffer
+	b.Write(data[:2]) // SOI
+	pos := 2
+	done := false
+	for i := range segs {
+		sg := &segs[i]
+		for data[pos+1] == 0xff { // fill bytes
+			pos++
+		}
+		if sg.Marker == jpegSOS {
+			break
+		}
+		pos += 4 + len(sg.Data)
+		isExif := sg.Marker == jpegAPP1 && bytes.HasPrefix(sg.Data, []byte(JpegExifPrefix))
+		switch {
+		case isExif && done:
+			continue
+		case isExif:
+			sg = &esg
+			done = true
+		case !done && sg.Marker != 0xe0:
+			writeJpegSegment(&b, &esg)
+			done = true
+		}
+		writeJpegSegment(&b, sg)
+	}
+	if !done {
+		writeJpegSegment(&b, &esg)
+	}
+	b.Write(data[pos:])
+	return b.Bytes(), nil
+}
+
+// ParseJpeg parses the metadata from Jpeg file data into RawMeta
+func (rm *RawMeta) ParseJpeg(data []byte) error {
+	return rm.ReadJpeg(bytes.NewReader(data), int64(len(data)))
+}
+
+// ReadJpeg reads the metadata from a Jpeg file of given size into RawMeta,
+// reading only the header segments
+func (rm *RawMeta) ReadJpeg(r io.ReaderAt, size int64) error {
+	segs, err := ReadJpegSegments(r, size)
+	for i := range segs {
+		sg := &segs[i]
+		switch {
+		case isJpegSOF(sg.Marker):
+			if len(sg.Data) >= 5 {
+				rm.Depth = int(sg.Data[0])
+				rm.Size.Y = int(binary.BigEndian.Uint16(sg.Data[1:]))
+				rm.Size.X = int(binary.BigEndian.Uint16(sg.Data[3:]))
+			}
+		case sg.Marker == jpegAPP1 && bytes.HasPrefix(sg.Data, []byte(JpegExifPrefix)):
+			if rm.Exif == nil {
+				rm.Exif = sg.Data[len(JpegExifPrefix):]
+			}
+		case sg.Marker == jpegAPP1 && bytes.HasPrefix(sg.Data, []byte(JpegXMPPrefix)):
+			rm.XMP = sg.Data[len(JpegXMPPrefix):]
+		case sg.Marker == jpegAPP13 && bytes.HasPrefix(sg.Data, []byte(JpegPhotoshopPrefix)):
+			rs := ParsePhotoshopIRB(sg.Data[len(JpegPhotoshopPrefix):])
+			if r := PhotoshopResourceByID(rs, PhotoshopIPTCID); r != nil {
+				rm.IPTC = r.Data
+			}
+		}
+	}
+	rm.ICC = JpegICC(segs)
+	if len(segs) == 0 {
+		return err
+	}
+	return nil
+}
+
+// jpegAppInsertIdx returns the index after the leading APPn segments,
+// where new metadata segments are inserted.
+func jpegAppInsertIdx(segs []*jpegstructure.Segment) int {
+	i := 0
+	if len(segs) > 0 && segs[0].MarkerId == jpegSOI {
+		i++
+	}
+	for i < len(segs) && segs[i].MarkerId >= 0xe0 && segs[i].MarkerId <= 0xef {
+		i++
+	}
+	return i
+}
+
+// UpdateJpegSegments updates the XMP APP1 and Photoshop IPTC APP13 segments
+// of given Jpeg segment list with the current info, returning the updated
+// list and the fields that were updated in each (nil if not updated).
+// These segments are only added if not already present when needed to
+// represent the info (see HasXMPOnly, and Keywords for IPTC).
+func (pi *Info) UpdateJpegSegments(sl *jpegstructure.SegmentList) (*jpegstructure.SegmentList, []string, []string) {
+	segs := sl.Segments()
+	xsi, isi := -1, -1
+	for i, sg := range segs {
+		switch {
+		case xsi < 0 && sg.MarkerId == jpegAPP1 && bytes.HasPrefix(sg.Data, []byte(JpegXMPPrefix)):
+			xsi = i
+		case isi < 0 && sg.MarkerId == jpegAPP13 && bytes.HasPrefix(sg.Data, []byte(JpegPhotoshopPrefix)):
+			isi = i
+		}
+	}
+
+	var xmpData []byte
+	var xupdts []string
+	if xsi >= 0 || pi.HasXMPOnly() {
+		x := NewXMP()
+		if xsi >= 0 {
+			px, err := ParseXMP(segs[xsi].Data[len(JpegXMPPrefix):])
+			if err == nil {
+				x = px
+			} else {
+				log.Printf("File: %s XMP err: %v -- replacing\n", pi.File, err)
+			}
+		}
+		xupdts = pi.UpdateXMP(x)
+		if len(xupdts) > 0 || xsi < 0 {
+			xmpData = append([]byte(JpegXMPPrefix), x.Bytes()...)
+			if len(xmpData) > JpegMaxSegment {
+				log.Printf("File: %s XMP is too large for a Jpeg segment -- not updated\n", pi.File)
+				xmpData = nil
+				xupdts = nil
+			}
+		}
+	}
+
+	var irbData []byte
+	var iupdts []string
+	if isi >= 0 || len(pi.Keywords) > 0 {
+		var rs []PhotoshopResource
+		if isi >= 0 {
+			rs = ParsePhotoshopIRB(segs[isi].Data[len(JpegPhotoshopPrefix):])
+		}
+		var ds []IPTCDataset
+		r := PhotoshopResourceByID(rs, PhotoshopIPTCID)
+		if r != nil {
+			ds = ParseIPTC(r.Data)
+		}
+		nds, updts := pi.UpdateIPTC(ds)
+		if len(updts) > 0 {
+			iupdts = updts
+			if r != nil {
+				r.Data = IPTCBytes(nds)
+			} else {
+				rs = append(rs, PhotoshopResource{ID: PhotoshopIPTCID, Data: IPTCBytes(nds)})
+			}
+			irbData = append([]byte(JpegPhotoshopPrefix), PhotoshopIRBBytes(rs)...)
+		}
+	}
+	if xmpData == nil && irbData == nil {
+		return sl, nil, nil
+	}
+	if xupdts == nil && xmpData != nil {
+		xupdts = []string{}
+	}
+
+	nsegs := append([]*jpegstructure.Segment{}, segs...)
+	var ins []*jpegstructure.Segment
+	if xmpData != nil {
+		if xsi >= 0 {
+			nsegs[xsi].Data = xmpData
+		} else {
+			ins = append(ins, &jpegstructure.Segment{MarkerId: jpegAPP1, MarkerName: "APP1", Data: xmpData})
+		}
+	}
+	if irbData != nil {
+		if isi >= 0 {
+			nsegs[isi].Data = irbData
+		} else {
+			ins = append(ins, &jpegstructure.Segment{MarkerId: jpegAPP13, MarkerName: "APP13", Data: irbData})
+		}
+	}
+	if len(ins) > 0 {
+		ii := jpegAppInsertIdx(nsegs)
+		nsegs = append(nsegs[:ii], append(ins, nsegs[ii:]...)...)
+	}
+	return jpegstructure.NewSegmentList(nsegs), xupdts, iupdts
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// The Go Jpeg encoder always subsamples the color by 4:2:0, so for the
+// other JpegSubsamplings the image is encoded here, with the same
+// quantization tables, into the quantized DCT coefficients that are
+// written by writeJpegCoefs, as for the lossless transforms.
+
+// jpegBaseQuant are the luminance and chrominance quantization tables
+// from Annex K of the Jpeg standard, in natural order, which are scaled
+// by the quality
+var jpegBaseQuant = [2][64]uint16{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// jpegQuant returns the quantization table for given quality, from 1 to
+// 100, and table index, scaled as the Go encoder (and libjpeg) does
+func jpegQuant(quality, tbl int) *[64]uint16 {
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
+	}
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	q := &[64]uint16{}
+	for i, b := range jpegBaseQuant[tbl] {
+		v := (int(b)*scale + 50) / 100
+		if v < 1 {
+			v = 1
+		} else if v > 255 {
+			v = 255
+		}
+		q[i] = uint16(v)
+	}
+	return q
+}
+
+// jpegCos is the DCT basis, scaled so that the 2D transform is the
+// product of the 1D ones: jpegCos[u][x] = C(u)/2 cos((2x+1)u pi/16)
+var jpegCos = func() (c [8][8]float64) {
+	for u := 0; u < 8; u++ {
+		cu := 0.5
+		if u == 0 {
+			cu = 0.5 / math.Sqrt2
+		}
+		for x := 0; x < 8; x++ {
+			c[u][x] = cu * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return
+}()
+
+// fdct sets b to the quantized DCT of the 8x8 samples at given offset and
+// stride in pix, level shifted by 128
+func (b *jpegBlock) fdct(pix []float64, off, stride int, q *[64]uint16) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		row := pix[off+y*stride : off+y*stride+8]
+		for u := 0; u < 8; u++ {
+			s := 0.0
+			for x, p := range row {
+				s += jpegCos[u][x] * (p - 128)
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			s := 0.0
+			for y := 0; y < 8; y++ {
+				s += jpegCos[v][y] * tmp[y*8+u]
+			}
+			b[v*8+u] = int32(math.Round(s / float64(q[v*8+u])))
+		}
+	}
+}
+
+// EncodeJpeg writes the image to w as a Jpeg, with the quality and chroma
+// subsampling of the options -- uses DefaultSaveOptions if opts is nil.
+// Gray images are always saved as gray.
+func EncodeJpeg(w io.Writer, img image.Image, opts *SaveOptions) error {
+	if opts == nil {
+		opts = &DefaultSaveOptions
+	}
+	if opts.JpegSubsampling == Jpeg420 || img.ColorModel() == color.GrayModel {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: opts.JpegQuality})
+	}
+	b, err := encodeJpegCoefs(img, opts)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// encodeJpegCoefs returns the color image encoded as a baseline Jpeg file
+// with the quality and chroma subsampling of the options
+func encodeJpegCoefs(img image.Image, opts *SaveOptions) ([]byte, error) {
+	bounds := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
+	}
+	jc := &jpegCoefs{hmax: 1, vmax: 1}
+	if opts.JpegSubsampling == Jpeg422 {
+		jc.hmax = 2
+	}
+	jc.comps = []*jpegComp{
+		{id: 1, h: jc.hmax, v: jc.vmax, tq: 0},
+		{id: 2, h: 1, v: 1, tq: 1},
+		{id: 3, h: 1, v: 1, tq: 1},
+	}
+	jc.quant[0] = jpegQuant(opts.JpegQuality, 0)
+	jc.quant[1] = jpegQuant(opts.JpegQuality, 1)
+	sz := bounds.Size()
+	if sz.X < 1 || sz.Y < 1 || sz.X > 0xffff || sz.Y > 0xffff {
+		return nil, errors.New("picinfo.EncodeJpeg: invalid image size")
+	}
+	jc.setSize(sz)
+
+	// the full resolution planes cover whole MCUs, repeating the edge pixels
+	pw, ph := jc.comps[0].bw*8, jc.comps[0].bh*8
+	planes := [3][]float64{}
+	for i := range planes {
+		planes[i] = make([]float64, pw*ph)
+	}
+	for y := 0; y < ph; y++ {
+		sy := y
+		if sy >= sz.Y {
+			sy = sz.Y - 1
+		}
+		for x := 0; x < pw; x++ {
+			sx := x
+			if sx >= sz.X {
+				sx = sz.X - 1
+			}
+			p := rgba.Pix[rgba.PixOffset(bounds.Min.X+sx, bounds.Min.Y+sy):]
+			yy, cb, cr := color.RGBToYCbCr(p[0], p[1], p[2])
+			i := y*pw + x
+			planes[0][i], planes[1][i], planes[2][i] = float64(yy), float64(cb), float64(cr)
+		}
+	}
+	for ci, c := range jc.comps {
+		pix, stride := planes[ci], pw
+		sh, sv := jc.hmax/c.h, jc.vmax/c.v
+		if sh > 1 || sv > 1 { // average the subsampled chroma
+			stride = pw / sh
+			sub := make([]float64, stride*(ph/sv))
+			for y := 0; y < ph; y++ {
+				for x := 0; x < pw; x++ {
+					sub[(y/sv)*stride+x/sh] += pix[y*pw+x]
+				}
+			}
+			n := float64(sh * sv)
+			for i := range sub {
+				sub[i] /= n
+			}
+			pix = sub
+		}
+		q := jc.quant[c.tq]
+		for by := 0; by < c.bh; by++ {
+			for bx := 0; bx < c.bw; bx++ {
+				c.blocks[by*c.bw+bx].fdct(pix, by*8*stride+bx*8, stride, q)
+			}
+		}
+	}
+	return writeJpegCoefs(jc)
+}
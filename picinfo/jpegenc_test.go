@@ -0,0 +1,91 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// meanPixelDiff returns the mean difference in the color channels between the images
+func meanPixelDiff(t *testing.T, a, b *image.RGBA) float64 {
+	if a.Bounds() != b.Bounds() {
+		t.Fatalf("image bounds differ: %v != %v", a.Bounds(), b.Bounds())
+	}
+	sum, n := 0, 0
+	for i := range a.Pix {
+		if i%4 == 3 {
+			continue
+		}
+		d := int(a.Pix[i]) - int(b.Pix[i])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+		n++
+	}
+	return float64(sum) / float64(n)
+}
+
+func TestEncodeJpeg(t *testing.T) {
+	src := decodeTestJpeg(t, readTestJpeg(t, "video-001.jpeg"))
+	ratios := map[JpegSubsamplings]image.YCbCrSubsampleRatio{
+		Jpeg420: image.YCbCrSubsampleRatio420,
+		Jpeg422: image.YCbCrSubsampleRatio422,
+		Jpeg444: image.YCbCrSubsampleRatio444,
+	}
+	// the full image, and an odd size that does not cover whole MCUs
+	for _, r := range []image.Rectangle{src.Bounds(), image.Rect(3, 5, 40, 34)} {
+		img := subImage(src, r)
+		diffs := map[JpegSubsamplings]float64{}
+		for ss := Jpeg420; ss < JpegSubsamplingsN; ss++ {
+			opts := DefaultSaveOptions
+			opts.JpegQuality = 95
+			opts.JpegSubsampling = ss
+			var b bytes.Buffer
+			if err := EncodeJpeg(&b, img, &opts); err != nil {
+				t.Fatalf("%v %v: %v", r, ss, err)
+			}
+			dec, err := jpeg.Decode(bytes.NewReader(b.Bytes()))
+			if err != nil {
+				t.Fatalf("%v %v: %v", r, ss, err)
+			}
+			ycc, ok := dec.(*image.YCbCr)
+			if !ok {
+				t.Fatalf("%v %v: decoded %T, not YCbCr", r, ss, dec)
+			}
+			if ycc.SubsampleRatio != ratios[ss] {
+				t.Errorf("%v %v: subsample ratio %v, want %v", r, ss, ycc.SubsampleRatio, ratios[ss])
+			}
+			diffs[ss] = meanPixelDiff(t, img, decodeTestJpeg(t, b.Bytes()))
+			if diffs[ss] > 4 {
+				t.Errorf("%v %v: mean pixel diff %.2f too large", r, ss, diffs[ss])
+			}
+		}
+		if diffs[Jpeg444] > diffs[Jpeg420] {
+			t.Errorf("%v: 4:4:4 mean pixel diff %.2f > 4:2:0 %.2f", r, diffs[Jpeg444], diffs[Jpeg420])
+		}
+	}
+}
+
+func TestJpegQuant(t *testing.T) {
+	// matches the tables written by the Go encoder, at the default quality
+	var b bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	jc, err := readJpegCoefs(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tbl := 0; tbl < 2; tbl++ {
+		if *jc.quant[tbl] != *jpegQuant(90, tbl) {
+			t.Errorf("quantization table %d differs from the Go encoder", tbl)
+		}
+	}
+}
@@ -0,0 +1,1324 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"os"
+)
+
+// Jpeg images can be rotated by multiples of 90 degrees, flipped and
+// cropped without any loss, by transforming the quantized DCT coefficients
+// of each 8x8 block, and moving the blocks, instead of decoding and
+// re-encoding the pixels, which loses a bit more quality every time.
+// This is what jpegtran does.  The coefficients are read from baseline or
+// progressive Huffman coded files, and written as baseline with optimized
+// Huffman tables.  A flip requires the image to be a whole number of MCUs
+// (the 8 or 16 pixel blocks that the color components are coded in) along
+// the flipped axis, as otherwise the partial blocks at the right or bottom
+// edge would end up at the left or top, and crops must start on an MCU
+// boundary: ErrJpegNotLossless is returned otherwise, in which case the
+// image must be re-encoded.
+// reference: https://www.w3.org/Graphics/JPEG/itu-t81.pdf
+
+// ErrJpegNotLossless is returned when a Jpeg transform cannot be done
+// losslessly, because of the image size, crop position or coding type
+var ErrJpegNotLossless = errors.New("picinfo: Jpeg transform cannot be done losslessly")
+
+// jpegUnzig maps from the zig-zag coefficient order to the natural order
+var jpegUnzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Jpeg markers used for reading and writing the coefficients
+const (
+	jpegSOF0 = 0xc0
+	jpegSOF1 = 0xc1
+	jpegSOF2 = 0xc2
+	jpegDHT  = 0xc4
+	jpegRST0 = 0xd0
+	jpegRST7 = 0xd7
+	jpegEOI  = 0xd9
+	jpegDQT  = 0xdb
+	jpegDRI  = 0xdd
+	jpegCOM  = 0xfe
+)
+
+// jpegBlock is the quantized DCT coefficients of one 8x8 block, in natural order
+type jpegBlock [64]int32
+
+// jpegComp is one color component of a Jpeg image, with its coefficients
+type jpegComp struct {
+
+	// component id
+	id byte
+
+	// horizontal and vertical sampling factors
+	h, v int
+
+	// quantization table index
+	tq int
+
+	// number of blocks per row and column, covering whole MCUs
+	bw, bh int
+
+	// coefficient blocks, in row order
+	blocks []jpegBlock
+}
+
+// jpegCoefs are the quantized DCT coefficients of a Jpeg image, with the
+// header segments that are kept
+type jpegCoefs struct {
+
+	// image size
+	size image.Point
+
+	// maximum sampling factors, which determine the MCU size
+	hmax, vmax int
+
+	// color components
+	comps []*jpegComp
+
+	// quantization tables, in natural order -- nil if not defined
+	quant [4]*[64]uint16
+
+	// APPn and COM segments, in order
+	segs []JpegSegment
+}
+
+// mcuSize returns the size of an MCU in pixels
+func (jc *jpegCoefs) mcuSize() image.Point {
+	return image.Point{8 * jc.hmax, 8 * jc.vmax}
+}
+
+// setSize sets the size and allocates the component blocks for it
+func (jc *jpegCoefs) setSize(sz image.Point) {
+	jc.size = sz
+	ms := jc.mcuSize()
+	mx := (sz.X + ms.X - 1) / ms.X
+	my := (sz.Y + ms.Y - 1) / ms.Y
+	for _, c := range jc.comps {
+		c.bw = mx * c.h
+		c.bh = my * c.v
+		c.blocks = make([]jpegBlock, c.bw*c.bh)
+	}
+}
+
+// compBlocks returns the number of blocks per row and column of given
+// component that are actually within the image, which are the blocks
+// coded in a non-interleaved scan
+func (jc *jpegCoefs) compBlocks(c *jpegComp) (int, int) {
+	cw := (jc.size.X*c.h + jc.hmax - 1) / jc.hmax
+	ch := (jc.size.Y*c.v + jc.vmax - 1) / jc.vmax
+	return (cw + 7) / 8, (ch + 7) / 8
+}
+
+// jpegHuff is a Huffman table for decoding
+type jpegHuff struct {
+
+	// symbol values, in code order
+	vals []byte
+
+	// per code length (index 1-16): the first code, last code (-1 = none),
+	// and index into vals of the first code
+	mincode, maxcode, valptr [17]int32
+
+	// lookup of codes up to 8 bits long, indexed by the next 8 bits:
+	// length << 8 | value, with 0 length for longer codes
+	lut [256]uint16
+}
+
+// newJpegHuff returns a Huffman table for given counts of codes of each
+// length, or an error if there are more codes than the lengths allow
+func newJpegHuff(counts [16]byte, vals []byte) (*jpegHuff, error) {
+	h := &jpegHuff{vals: vals}
+	code, k := int32(0), int32(0)
+	for l := 1; l <= 16; l++ {
+		h.mincode[l] = code
+		h.valptr[l] = k
+		n := int32(counts[l-1])
+		if code+n > 1<<l {
+			return nil, errors.New("picinfo.readJpegCoefs: invalid DHT code lengths")
+		}
+		for i := int32(0); i < n; i++ {
+			if l <= 8 {
+				st := (code + i) << (8 - l)
+				for j := int32(0); j < 1<<(8-l); j++ {
+					h.lut[st+j] = uint16(l)<<8 | uint16(vals[k+i])
+				}
+			}
+		}
+		code += n
+		k += n
+		h.maxcode[l] = code - 1
+		if n == 0 {
+			h.maxcode[l] = -1
+		}
+		code <<= 1
+	}
+	return h, nil
+}
+
+// jpegDecoder reads the coefficients from Jpeg file data
+type jpegDecoder struct {
+
+	// file data
+	data []byte
+
+	// position of the next byte to read
+	pos int
+
+	// bit buffer, with nbits valid low bits
+	acc   uint32
+	nbits int
+
+	// Huffman tables: [0] = DC, [1] = AC
+	huff [2][4]*jpegHuff
+
+	// quantization tables, in natural order
+	quant [4]*[64]uint16
+
+	// restart interval in MCUs, 0 = none
+	ri int
+
+	// remaining end-of-band run for progressive AC scans
+	eobrun int
+
+	// APPn and COM segments read so far
+	segs []JpegSegment
+
+	// coding is progressive
+	progressive bool
+
+	// coefficients being read
+	jc *jpegCoefs
+}
+
+// fill fills the bit buffer with at least 25 bits, removing stuffed zero
+// bytes, and filling with zeros at a marker or the end of the data
+func (d *jpegDecoder) fill() {
+	for d.nbits <= 24 {
+		var b byte
+		if d.pos < len(d.data) {
+			b = d.data[d.pos]
+			if b != 0xff {
+				d.pos++
+			} else if d.pos+1 < len(d.data) && d.data[d.pos+1] == 0 {
+				d.pos += 2
+			} else {
+				b = 0 // marker: not consumed
+			}
+		}
+		d.acc = d.acc<<8 | uint32(b)
+		d.nbits += 8
+	}
+}
+
+// bits returns the next n bits, n <= 16
+func (d *jpegDecoder) bits(n int) int32 {
+	if n == 0 {
+		return 0
+	}
+	if d.nbits < n {
+		d.fill()
+	}
+	d.nbits -= n
+	return int32((d.acc >> uint(d.nbits)) & (1<<uint(n) - 1))
+}
+
+// receiveExtend returns the next n bits as a signed value (F.2.2.1)
+func (d *jpegDecoder) receiveExtend(n int) int32 {
+	v := d.bits(n)
+	if n > 0 && v < 1<<uint(n-1) {
+		v += -1<<uint(n) + 1
+	}
+	return v
+}
+
+// decodeHuff returns the next Huffman coded symbol
+func (d *jpegDecoder) decodeHuff(h *jpegHuff) (byte, error) {
+	if h == nil {
+		return 0, errors.New("picinfo.jpegDecoder: undefined Huffman table")
+	}
+	if d.nbits < 16 {
+		d.fill()
+	}
+	if e := h.lut[(d.acc>>uint(d.nbits-8))&0xff]; e != 0 {
+		d.nbits -= int(e >> 8)
+		return byte(e), nil
+	}
+	for l := 9; l <= 16; l++ {
+		code := int32((d.acc >> uint(d.nbits-l)) & (1<<uint(l) - 1))
+		if code <= h.maxcode[l] {
+			d.nbits -= l
+			return h.vals[h.valptr[l]+code-h.mincode[l]], nil
+		}
+	}
+	return 0, errors.New("picinfo.jpegDecoder: invalid Huffman code")
+}
+
+// marker returns the next marker and its segment data, for markers that have it
+func (d *jpegDecoder) marker() (byte, []byte, error) {
+	for d.pos+1 < len(d.data) && !(d.data[d.pos] == 0xff && d.data[d.pos+1] != 0 && d.data[d.pos+1] != 0xff) {
+		d.pos++ // skip any garbage and fill bytes
+	}
+	if d.pos+1 >= len(d.data) {
+		return jpegEOI, nil, nil // missing EOI is common
+	}
+	mk := d.data[d.pos+1]
+	d.pos += 2
+	if mk == jpegEOI || mk == jpegSOI || (mk >= jpegRST0 && mk <= jpegRST7) {
+		return mk, nil, nil
+	}
+	if d.pos+2 > len(d.data) {
+		return mk, nil, errors.New("picinfo.jpegDecoder: segment truncated")
+	}
+	ln := int(binary.BigEndian.Uint16(d.data[d.pos:]))
+	if ln < 2 || d.pos+ln > len(d.data) {
+		return mk, nil, fmt.Errorf("picinfo.jpegDecoder: segment 0x%02x truncated", mk)
+	}
+	seg := d.data[d.pos+2 : d.pos+ln]
+	d.pos += ln
+	return mk, seg, nil
+}
+
+// readJpegCoefs reads the DCT coefficients from Jpeg file data.
+// Returns ErrJpegNotLossless for coding types that are not supported:
+// lossless, hierarchical, arithmetic coded and 12 bit images.
+func readJpegCoefs(data []byte) (*jpegCoefs, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegSOI {
+		return nil, errors.New("picinfo.readJpegCoefs: not a Jpeg file")
+	}
+	d := &jpegDecoder{data: data, pos: 2}
+	for {
+		mk, seg, err := d.marker()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case mk == jpegEOI:
+			if d.jc == nil {
+				return nil, errors.New("picinfo.readJpegCoefs: no image found")
+			}
+			for _, c := range d.jc.comps {
+				if d.quant[c.tq] == nil {
+					return nil, errors.New("picinfo.readJpegCoefs: undefined quantization table")
+				}
+			}
+			d.jc.segs = d.segs
+			d.jc.quant = d.quant
+			return d.jc, nil
+		case mk == jpegSOF0 || mk == jpegSOF1 || mk == jpegSOF2:
+			if d.jc != nil {
+				return nil, errors.New("picinfo.readJpegCoefs: multiple frames")
+			}
+			d.progressive = mk == jpegSOF2
+			err = d.readFrame(seg)
+		case isJpegSOF(mk):
+			return nil, ErrJpegNotLossless
+		case mk == jpegDHT:
+			err = d.readDHT(seg)
+		case mk == jpegDQT:
+			err = d.readDQT(seg)
+		case mk == jpegDRI:
+			if len(seg) >= 2 {
+				d.ri = int(binary.BigEndian.Uint16(seg))
+			}
+		case mk == jpegSOS:
+			if d.jc == nil {
+				return nil, errors.New("picinfo.readJpegCoefs: scan before frame")
+			}
+			err = d.readScan(seg)
+		case (mk >= 0xe0 && mk <= 0xef) || mk == jpegCOM:
+			d.segs = append(d.segs, JpegSegment{Marker: mk, Data: seg})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readFrame reads the SOF segment and allocates the coefficients
+func (d *jpegDecoder) readFrame(seg []byte) error {
+	if len(seg) < 6 {
+		return errors.New("picinfo.readJpegCoefs: SOF truncated")
+	}
+	if seg[0] != 8 {
+		return ErrJpegNotLossless // 12 bit
+	}
+	sz := image.Point{int(binary.BigEndian.Uint16(seg[3:])), int(binary.BigEndian.Uint16(seg[1:]))}
+	nc := int(seg[5])
+	if sz.X == 0 || sz.Y == 0 || nc == 0 || nc > 4 {
+		return ErrJpegNotLossless
+	}
+	if len(seg) < 6+3*nc {
+		return errors.New("picinfo.readJpegCoefs: SOF truncated")
+	}
+	jc := &jpegCoefs{}
+	for i := 0; i < nc; i++ {
+		cs := seg[6+3*i:]
+		c := &jpegComp{id: cs[0], h: int(cs[1] >> 4), v: int(cs[1] & 0xf), tq: int(cs[2])}
+		if c.h < 1 || c.h > 4 || c.v < 1 || c.v > 4 {
+			return errors.New("picinfo.readJpegCoefs: invalid sampling factors")
+		}
+		if c.tq > 3 {
+			return errors.New("picinfo.readJpegCoefs: invalid quantization table id")
+		}
+		if c.h > jc.hmax {
+			jc.hmax = c.h
+		}
+		if c.v > jc.vmax {
+			jc.vmax = c.v
+		}
+		jc.comps = append(jc.comps, c)
+	}
+	jc.setSize(sz)
+	d.jc = jc
+	return nil
+}
+
+// readDQT reads quantization tables
+func (d *jpegDecoder) readDQT(seg []byte) error {
+	for len(seg) > 0 {
+		pq, tq := seg[0]>>4, seg[0]&0xf
+		if pq > 1 || tq > 3 {
+			return errors.New("picinfo.readJpegCoefs: invalid DQT precision or id")
+		}
+		n := 65
+		if pq != 0 {
+			n = 129
+		}
+		if len(seg) < n {
+			return errors.New("picinfo.readJpegCoefs: DQT truncated")
+		}
+		q := &[64]uint16{}
+		for k := 0; k < 64; k++ {
+			if pq != 0 {
+				q[jpegUnzig[k]] = binary.BigEndian.Uint16(seg[1+2*k:])
+			} else {
+				q[jpegUnzig[k]] = uint16(seg[1+k])
+			}
+		}
+		d.quant[tq] = q
+		seg = seg[n:]
+	}
+	return nil
+}
+
+// readDHT reads Huffman tables
+func (d *jpegDecoder) readDHT(seg []byte) error {
+	for len(seg) > 0 {
+		if len(seg) < 17 {
+			return errors.New("picinfo.readJpegCoefs: DHT truncated")
+		}
+		tc, th := seg[0]>>4, seg[0]&0xf
+		if tc > 1 || th > 3 {
+			return errors.New("picinfo.readJpegCoefs: invalid DHT class or id")
+		}
+		var counts [16]byte
+		copy(counts[:], seg[1:17])
+		n := 0
+		for _, c := range counts {
+			n += int(c)
+		}
+		if n > 256 || len(seg) < 17+n {
+			return errors.New("picinfo.readJpegCoefs: DHT truncated")
+		}
+		h, err := newJpegHuff(counts, seg[17:17+n])
+		if err != nil {
+			return err
+		}
+		d.huff[tc][th] = h
+		seg = seg[17+n:]
+	}
+	return nil
+}
+
+// jpegScanComp is a component in a scan, with its Huffman tables and DC prediction
+type jpegScanComp struct {
+	c      *jpegComp
+	dc, ac *jpegHuff
+	pred   int32
+}
+
+// readScan reads the SOS segment and the entropy coded data of the scan
+func (d *jpegDecoder) readScan(seg []byte) error {
+	jc := d.jc
+	if len(seg) < 1 {
+		return errors.New("picinfo.readJpegCoefs: SOS truncated")
+	}
+	ns := int(seg[0])
+	if ns < 1 || ns > 4 || len(seg) < 4+2*ns {
+		return errors.New("picinfo.readJpegCoefs: SOS truncated")
+	}
+	scs := make([]*jpegScanComp, ns)
+	for i := range scs {
+		id, tbl := seg[1+2*i], seg[2+2*i]
+		if tbl>>4 > 3 || tbl&0xf > 3 {
+			return errors.New("picinfo.readJpegCoefs: invalid Huffman table id in scan")
+		}
+		for _, c := range jc.comps {
+			if c.id == id {
+				scs[i] = &jpegScanComp{c: c, dc: d.huff[0][tbl>>4], ac: d.huff[1][tbl&0xf]}
+			}
+		}
+		if scs[i] == nil {
+			return fmt.Errorf("picinfo.readJpegCoefs: unknown component %d in scan", id)
+		}
+	}
+	ps := seg[1+2*ns:]
+	ss, se, ah, al := int(ps[0]), int(ps[1]), uint(ps[2]>>4), uint(ps[2]&0xf)
+	if !d.progressive {
+		ss, se, ah, al = 0, 63, 0, 0
+	}
+	if ss > se || se > 63 || (ss == 0 && se != 0 && d.progressive) || (ss > 0 && ns != 1) {
+		return errors.New("picinfo.readJpegCoefs: invalid progressive scan")
+	}
+	d.acc, d.nbits, d.eobrun = 0, 0, 0
+	decode := func(sc *jpegScanComp, b *jpegBlock) error {
+		switch {
+		case !d.progressive:
+			return d.decodeBaseline(sc, b)
+		case ss == 0 && ah == 0:
+			t, err := d.decodeHuff(sc.dc)
+			if err != nil {
+				return err
+			}
+			sc.pred += d.receiveExtend(int(t))
+			b[0] = sc.pred << al
+		case ss == 0:
+			if d.bits(1) != 0 {
+				b[0] |= 1 << al
+			}
+		case ah == 0:
+			return d.decodeACFirst(sc, b, ss, se, al)
+		default:
+			return d.decodeACRefine(sc, b, ss, se, int32(1)<<al)
+		}
+		return nil
+	}
+	// blocks are in MCUs for interleaved scans, otherwise one at a time
+	mx, my := scs[0].c.bw/scs[0].c.h, scs[0].c.bh/scs[0].c.v
+	if ns == 1 {
+		mx, my = jc.compBlocks(scs[0].c)
+	}
+	n := 0
+	for y := 0; y < my; y++ {
+		for x := 0; x < mx; x++ {
+			if d.ri > 0 && n > 0 && n%d.ri == 0 {
+				d.restart(scs)
+			}
+			n++
+			for _, sc := range scs {
+				c := sc.c
+				if ns == 1 {
+					if err := decode(sc, &c.blocks[y*c.bw+x]); err != nil {
+						return err
+					}
+					continue
+				}
+				for v := 0; v < c.v; v++ {
+					for h := 0; h < c.h; h++ {
+						if err := decode(sc, &c.blocks[(y*c.v+v)*c.bw+x*c.h+h]); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// restart resets the decoder at a restart marker
+func (d *jpegDecoder) restart(scs []*jpegScanComp) {
+	d.acc, d.nbits, d.eobrun = 0, 0, 0
+	for _, sc := range scs {
+		sc.pred = 0
+	}
+	for d.pos+1 < len(d.data) && d.data[d.pos] == 0xff && d.data[d.pos+1] == 0xff {
+		d.pos++
+	}
+	if d.pos+1 < len(d.data) && d.data[d.pos] == 0xff && d.data[d.pos+1] >= jpegRST0 && d.data[d.pos+1] <= jpegRST7 {
+		d.pos += 2
+	}
+}
+
+// decodeBaseline decodes all of the coefficients of a block in a sequential scan
+func (d *jpegDecoder) decodeBaseline(sc *jpegScanComp, b *jpegBlock) error {
+	t, err := d.decodeHuff(sc.dc)
+	if err != nil {
+		return err
+	}
+	sc.pred += d.receiveExtend(int(t))
+	b[0] = sc.pred
+	for k := 1; k < 64; k++ {
+		rs, err := d.decodeHuff(sc.ac)
+		if err != nil {
+			return err
+		}
+		r, s := int(rs>>4), int(rs&0xf)
+		if s == 0 {
+			if r != 15 {
+				break // EOB
+			}
+			k += 15
+			continue
+		}
+		k += r
+		if k > 63 {
+			return errors.New("picinfo.readJpegCoefs: too many coefficients")
+		}
+		b[jpegUnzig[k]] = d.receiveExtend(s)
+	}
+	return nil
+}
+
+// decodeACFirst decodes the first pass of AC coefficients ss..se of a block
+// in a progressive scan (G.1.2.2)
+func (d *jpegDecoder) decodeACFirst(sc *jpegScanComp, b *jpegBlock, ss, se int, al uint) error {
+	if d.eobrun > 0 {
+		d.eobrun--
+		return nil
+	}
+	for k := ss; k <= se; k++ {
+		rs, err := d.decodeHuff(sc.ac)
+		if err != nil {
+			return err
+		}
+		r, s := int(rs>>4), int(rs&0xf)
+		if s == 0 {
+			if r != 15 {
+				d.eobrun = 1<<uint(r) - 1 + int(d.bits(r))
+				break
+			}
+			k += 15
+			continue
+		}
+		k += r
+		if k > 63 {
+			return errors.New("picinfo.readJpegCoefs: too many coefficients")
+		}
+		b[jpegUnzig[k]] = d.receiveExtend(s) << al
+	}
+	return nil
+}
+
+// decodeACRefine decodes a refinement pass of AC coefficients ss..se of a
+// block in a progressive scan (G.1.2.3), where delta is the bit being refined
+func (d *jpegDecoder) decodeACRefine(sc *jpegScanComp, b *jpegBlock, ss, se int, delta int32) error {
+	k := ss
+	if d.eobrun == 0 {
+		for ; k <= se; k++ {
+			rs, err := d.decodeHuff(sc.ac)
+			if err != nil {
+				return err
+			}
+			r, s := int(rs>>4), int(rs&0xf)
+			z := int32(0)
+			switch s {
+			case 0:
+				if r != 15 {
+					d.eobrun = 1<<uint(r) + int(d.bits(r))
+				}
+			case 1:
+				z = delta
+				if d.bits(1) == 0 {
+					z = -z
+				}
+			default:
+				return errors.New("picinfo.readJpegCoefs: invalid refinement code")
+			}
+			if d.eobrun > 0 {
+				break
+			}
+			k = d.refineNonZeroes(b, k, se, r, delta)
+			if k > se {
+				return errors.New("picinfo.readJpegCoefs: too many coefficients")
+			}
+			if z != 0 {
+				b[jpegUnzig[k]] = z
+			}
+		}
+	}
+	if d.eobrun > 0 {
+		d.eobrun--
+		d.refineNonZeroes(b, k, se, -1, delta)
+	}
+	return nil
+}
+
+// refineNonZeroes refines the already non-zero coefficients from k, until
+// nz zero coefficients have been skipped (all if nz < 0), returning the
+// index of the next zero coefficient
+func (d *jpegDecoder) refineNonZeroes(b *jpegBlock, k, se, nz int, delta int32) int {
+	for ; k <= se; k++ {
+		u := jpegUnzig[k]
+		if b[u] == 0 {
+			if nz == 0 {
+				break
+			}
+			nz--
+			continue
+		}
+		if d.bits(1) == 0 {
+			continue
+		}
+		if b[u] >= 0 {
+			b[u] += delta
+		} else {
+			b[u] -= delta
+		}
+	}
+	return k
+}
+
+// jpegHuffEnc is a Huffman table for encoding
+type jpegHuffEnc struct {
+
+	// number of codes of each length 1-16, as stored in the DHT segment
+	counts [16]byte
+
+	// symbols in code order, as stored in the DHT segment
+	vals []byte
+
+	// code and code length for each symbol
+	code [256]uint16
+	size [256]byte
+}
+
+// newJpegHuffEnc returns an optimal Huffman table, with codes of at most
+// 16 bits, for given symbol frequencies, using the procedure of Annex K.2
+func newJpegHuffEnc(freq *[256]int) *jpegHuffEnc {
+	var f [257]int
+	copy(f[:], freq[:])
+	f[256] = 1 // reserved, so that no code is all 1 bits
+	var codesize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+	for {
+		v1, v2 := -1, -1
+		for i := range f { // least frequent, largest symbol for ties
+			if f[i] > 0 && (v1 < 0 || f[i] <= f[v1]) {
+				v1 = i
+			}
+		}
+		for i := range f {
+			if f[i] > 0 && i != v1 && (v2 < 0 || f[i] <= f[v2]) {
+				v2 = i
+			}
+		}
+		if v2 < 0 {
+			break
+		}
+		f[v1] += f[v2]
+		f[v2] = 0
+		codesize[v1]++
+		for others[v1] >= 0 {
+			v1 = others[v1]
+			codesize[v1]++
+		}
+		others[v1] = v2
+		codesize[v2]++
+		for others[v2] >= 0 {
+			v2 = others[v2]
+			codesize[v2]++
+		}
+	}
+	var bits [258]int
+	for _, cs := range codesize {
+		if cs > 0 {
+			bits[cs]++
+		}
+	}
+	for i := len(bits) - 1; i > 16; i-- { // limit to 16 bits
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+	i := 16
+	for i > 0 && bits[i] == 0 {
+		i--
+	}
+	bits[i]-- // remove the reserved code
+	h := &jpegHuffEnc{}
+	for l := 1; l <= 16; l++ {
+		h.counts[l-1] = byte(bits[l])
+	}
+	for l := 1; l < len(bits); l++ {
+		for sym := 0; sym < 256; sym++ {
+			if codesize[sym] == l {
+				h.vals = append(h.vals, byte(sym))
+			}
+		}
+	}
+	code, k := uint16(0), 0
+	for l := 1; l <= 16; l++ {
+		for n := 0; n < int(h.counts[l-1]); n++ {
+			sym := h.vals[k]
+			h.code[sym] = code
+			h.size[sym] = byte(l)
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return h
+}
+
+// jpegBitWriter writes entropy coded data, with stuffed zero bytes
+type jpegBitWriter struct {
+	buf   bytes.Buffer
+	acc   uint32
+	nbits uint
+}
+
+// emit writes the n low bits of bits, n <= 16
+func (w *jpegBitWriter) emit(bits uint32, n uint) {
+	w.acc = w.acc<<n | bits&(1<<n-1)
+	w.nbits += n
+	for w.nbits >= 8 {
+		b := byte(w.acc >> (w.nbits - 8))
+		w.buf.WriteByte(b)
+		if b == 0xff {
+			w.buf.WriteByte(0)
+		}
+		w.nbits -= 8
+	}
+}
+
+// flush pads the last byte with 1 bits
+func (w *jpegBitWriter) flush() {
+	if w.nbits > 0 {
+		w.emit(0xff, 8-w.nbits)
+	}
+}
+
+// jpegEncoder writes the coefficients as a baseline Jpeg, in two passes:
+// first counting the symbol frequencies, then writing with the optimal
+// Huffman tables for them.  Table 0 is for the first (luma) component,
+// and table 1 for the others.
+type jpegEncoder struct {
+
+	// bit writer -- nil when counting
+	w *jpegBitWriter
+
+	// symbol frequencies, by [table][dc, ac]
+	freq [2][2][256]int
+
+	// Huffman tables, by [table][dc, ac]
+	huff [2][2]*jpegHuffEnc
+}
+
+// symbol counts or writes a Huffman coded symbol
+func (e *jpegEncoder) symbol(tbl, class int, sym byte) {
+	if e.w == nil {
+		e.freq[tbl][class][sym]++
+		return
+	}
+	h := e.huff[tbl][class]
+	e.w.emit(uint32(h.code[sym]), uint(h.size[sym]))
+}
+
+// value writes the n bit value that follows a symbol
+func (e *jpegEncoder) value(v int32, n int) {
+	if e.w == nil || n == 0 {
+		return
+	}
+	if v < 0 { // ones complement
+		v--
+	}
+	e.w.emit(uint32(v), uint(n))
+}
+
+// jpegBitSize returns the number of bits needed for the magnitude of v
+func jpegBitSize(v int32) int {
+	if v < 0 {
+		v = -v
+	}
+	n := 0
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+// block counts or writes one block, with given DC prediction
+func (e *jpegEncoder) block(b *jpegBlock, pred *int32, tbl int) error {
+	diff := b[0] - *pred
+	*pred = b[0]
+	n := jpegBitSize(diff)
+	if n > 11 {
+		return errors.New("picinfo.writeJpegCoefs: DC coefficient out of range")
+	}
+	e.symbol(tbl, 0, byte(n))
+	e.value(diff, n)
+	run := 0
+	for k := 1; k < 64; k++ {
+		v := b[jpegUnzig[k]]
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 15 {
+			e.symbol(tbl, 1, 0xf0) // ZRL
+			run -= 16
+		}
+		n := jpegBitSize(v)
+		if n > 10 {
+			return errors.New("picinfo.writeJpegCoefs: AC coefficient out of range")
+		}
+		e.symbol(tbl, 1, byte(run<<4|n))
+		e.value(v, n)
+		run = 0
+	}
+	if run > 0 {
+		e.symbol(tbl, 1, 0) // EOB
+	}
+	return nil
+}
+
+// scan counts or writes all of the blocks, in one sequential scan
+func (e *jpegEncoder) scan(jc *jpegCoefs) error {
+	preds := make([]int32, len(jc.comps))
+	if len(jc.comps) == 1 { // non-interleaved
+		c := jc.comps[0]
+		bw, bh := jc.compBlocks(c)
+		for y := 0; y < bh; y++ {
+			for x := 0; x < bw; x++ {
+				if err := e.block(&c.blocks[y*c.bw+x], &preds[0], 0); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	c0 := jc.comps[0]
+	mx, my := c0.bw/c0.h, c0.bh/c0.v
+	for y := 0; y < my; y++ {
+		for x := 0; x < mx; x++ {
+			for ci, c := range jc.comps {
+				tbl := 1
+				if ci == 0 {
+					tbl = 0
+				}
+				for v := 0; v < c.v; v++ {
+					for h := 0; h < c.h; h++ {
+						if err := e.block(&c.blocks[(y*c.v+v)*c.bw+x*c.h+h], &preds[ci], tbl); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeJpegCoefs returns the coefficients encoded as a baseline Jpeg file,
+// with the kept header segments
+func writeJpegCoefs(jc *jpegCoefs) ([]byte, error) {
+	e := &jpegEncoder{}
+	if err := e.scan(jc); err != nil {
+		return nil, err
+	}
+	ntbl := 2
+	if len(jc.comps) == 1 {
+		ntbl = 1
+	}
+	for t := 0; t < ntbl; t++ {
+		for cl := 0; cl < 2; cl++ {
+			e.huff[t][cl] = newJpegHuffEnc(&e.freq[t][cl])
+		}
+	}
+	var b bytes.Buffer
+	b.Write([]byte{0xff, jpegSOI})
+	for i := range jc.segs {
+		writeJpegSegment(&b, &jc.segs[i])
+	}
+	sof := byte(jpegSOF0)
+	for i, q := range jc.quant {
+		if q == nil {
+			continue
+		}
+		pq := byte(0)
+		for _, v := range q {
+			if v > 255 {
+				pq = 1
+				sof = jpegSOF1 // 16 bit tables are not baseline
+			}
+		}
+		d := []byte{pq<<4 | byte(i)}
+		for k := 0; k < 64; k++ {
+			v := q[jpegUnzig[k]]
+			if pq != 0 {
+				d = append(d, byte(v>>8))
+			}
+			d = append(d, byte(v))
+		}
+		writeJpegSegment(&b, &JpegSegment{Marker: jpegDQT, Data: d})
+	}
+	d := []byte{8, byte(jc.size.Y >> 8), byte(jc.size.Y), byte(jc.size.X >> 8), byte(jc.size.X), byte(len(jc.comps))}
+	for _, c := range jc.comps {
+		d = append(d, c.id, byte(c.h<<4|c.v), byte(c.tq))
+	}
+	writeJpegSegment(&b, &JpegSegment{Marker: sof, Data: d})
+	for t := 0; t < ntbl; t++ {
+		for cl := 0; cl < 2; cl++ {
+			h := e.huff[t][cl]
+			d := append([]byte{byte(cl<<4 | t)}, h.counts[:]...)
+			writeJpegSegment(&b, &JpegSegment{Marker: jpegDHT, Data: append(d, h.vals...)})
+		}
+	}
+	d = []byte{byte(len(jc.comps))}
+	for ci, c := range jc.comps {
+		t := byte(1)
+		if ci == 0 {
+			t = 0
+		}
+		d = append(d, c.id, t<<4|t)
+	}
+	d = append(d, 0, 63, 0)
+	writeJpegSegment(&b, &JpegSegment{Marker: jpegSOS, Data: d})
+	e.w = &jpegBitWriter{}
+	if err := e.scan(jc); err != nil {
+		return nil, err
+	}
+	e.w.flush()
+	b.Write(e.w.buf.Bytes())
+	b.Write([]byte{0xff, jpegEOI})
+	return b.Bytes(), nil
+}
+
+// jpegXform is a transform of the image blocks: an optional transpose
+// (swapping x and y), followed by optional flips in x and y.  All
+// combinations of 90 degree rotations and flips are one of these.
+type jpegXform struct {
+	transpose, flipX, flipY bool
+}
+
+// orientJpegXform returns the transform for displaying an image with given orientation
+func orientJpegXform(or Orientations) jpegXform {
+	rot, flip := or.Transform()
+	// the transform as a matrix of (x, y) with y down: flip, then rotate
+	m := [2][2]int{{1, 0}, {0, 1}}
+	if flip {
+		m[0][0] = -1
+	}
+	for i := 0; i < rot; i++ { // 90 clockwise: (x, y) -> (-y, x)
+		m = [2][2]int{{-m[1][0], -m[1][1]}, {m[0][0], m[0][1]}}
+	}
+	if m[0][0] != 0 {
+		return jpegXform{false, m[0][0] < 0, m[1][1] < 0}
+	}
+	return jpegXform{true, m[0][1] < 0, m[1][0] < 0}
+}
+
+// block transforms the coefficients of a block: transposing swaps the
+// horizontal and vertical frequencies, and flipping negates the odd frequencies
+func (xf jpegXform) block(src, dst *jpegBlock) {
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			c := src[v*8+u]
+			if xf.transpose {
+				c = src[u*8+v]
+			}
+			if xf.flipX && u&1 != 0 {
+				c = -c
+			}
+			if xf.flipY && v&1 != 0 {
+				c = -c
+			}
+			dst[v*8+u] = c
+		}
+	}
+}
+
+// transform returns the coefficients transformed and then cropped to given
+// rectangle in the transformed image, which is the whole image if empty
+func (jc *jpegCoefs) transform(xf jpegXform, crop image.Rectangle) (*jpegCoefs, error) {
+	ms := jc.mcuSize()
+	if xf.transpose {
+		if (xf.flipX && jc.size.Y%ms.Y != 0) || (xf.flipY && jc.size.X%ms.X != 0) {
+			return nil, ErrJpegNotLossless
+		}
+	} else if (xf.flipX && jc.size.X%ms.X != 0) || (xf.flipY && jc.size.Y%ms.Y != 0) {
+		return nil, ErrJpegNotLossless
+	}
+	dst := &jpegCoefs{hmax: jc.hmax, vmax: jc.vmax, segs: jc.segs, quant: jc.quant}
+	full := jc.size
+	if xf.transpose {
+		dst.hmax, dst.vmax = jc.vmax, jc.hmax
+		full.X, full.Y = full.Y, full.X
+		for i, q := range jc.quant {
+			if q == nil {
+				continue
+			}
+			tq := &[64]uint16{}
+			for v := 0; v < 8; v++ {
+				for u := 0; u < 8; u++ {
+					tq[v*8+u] = q[u*8+v]
+				}
+			}
+			dst.quant[i] = tq
+		}
+	}
+	if crop.Empty() {
+		crop = image.Rectangle{Max: full}
+	}
+	crop = crop.Intersect(image.Rectangle{Max: full})
+	dms := dst.mcuSize()
+	if crop.Empty() || crop.Min.X%dms.X != 0 || crop.Min.Y%dms.Y != 0 {
+		return nil, ErrJpegNotLossless
+	}
+	for _, c := range jc.comps {
+		dc := &jpegComp{id: c.id, h: c.h, v: c.v, tq: c.tq}
+		if xf.transpose {
+			dc.h, dc.v = c.v, c.h
+		}
+		dst.comps = append(dst.comps, dc)
+	}
+	dst.setSize(crop.Size())
+	for ci, dc := range dst.comps {
+		sc := jc.comps[ci]
+		nbx, nby := jc.compBlocks(sc) // blocks in the image, in the transformed directions
+		if xf.transpose {
+			nbx, nby = nby, nbx
+		}
+		ox, oy := crop.Min.X/dms.X*dc.h, crop.Min.Y/dms.Y*dc.v
+		for by := 0; by < dc.bh; by++ {
+			for bx := 0; bx < dc.bw; bx++ {
+				x, y := bx+ox, by+oy
+				if xf.flipX {
+					x = nbx - 1 - x
+				}
+				if xf.flipY {
+					y = nby - 1 - y
+				}
+				if xf.transpose {
+					x, y = y, x
+				}
+				if x < 0 || y < 0 || x >= sc.bw || y >= sc.bh {
+					continue // padding beyond the image
+				}
+				xf.block(&sc.blocks[y*sc.bw+x], &dc.blocks[by*dc.bw+bx])
+			}
+		}
+	}
+	return dst, nil
+}
+
+// Exif tags updated for transformed images
+const (
+	exifTagPixelXDimension = 0xa002
+	exifTagPixelYDimension = 0xa003
+)
+
+// setTiffIfdValue sets the value of a single SHORT or LONG entry with given
+// tag in the IFD at given offset, in place, returning false if not found
+func setTiffIfdValue(data []byte, order binary.ByteOrder, off uint32, tag uint16, val uint32) bool {
+	if uint64(off)+2 > uint64(len(data)) {
+		return false
+	}
+	n := int(order.Uint16(data[off:]))
+	for i := 0; i < n; i++ {
+		p := int(off) + 2 + 12*i
+		if p+12 > len(data) {
+			return false
+		}
+		if order.Uint16(data[p:]) != tag || order.Uint32(data[p+4:]) != 1 {
+			continue
+		}
+		switch order.Uint16(data[p+2:]) {
+		case tiffShort:
+			order.PutUint16(data[p+8:], uint16(val))
+		case tiffLong:
+			order.PutUint32(data[p+8:], val)
+		default:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// fixTransformedExif updates raw exif data in place for an image that has
+// been transformed: the orientation is reset, the size is set, and the
+// IFD1 thumbnail, which is not transformed, is unlinked.
+func fixTransformedExif(raw []byte, sz image.Point) {
+	order, off, err := ReadTiffHeader(raw)
+	if err != nil {
+		return
+	}
+	ifd0, err := ReadTiffIfd(raw, order, off)
+	if err != nil {
+		return
+	}
+	setTiffIfdValue(raw, order, off, tiffTagOrientation, uint32(Rotated0))
+	setTiffIfdValue(raw, order, off, tiffTagImageWidth, uint32(sz.X))
+	setTiffIfdValue(raw, order, off, tiffTagImageLength, uint32(sz.Y))
+	if e := ifd0.Entry(tiffTagExifIFD); e != nil {
+		eoff := e.Uint(order, 0)
+		setTiffIfdValue(raw, order, eoff, exifTagPixelXDimension, uint32(sz.X))
+		setTiffIfdValue(raw, order, eoff, exifTagPixelYDimension, uint32(sz.Y))
+	}
+	if np := uint64(off) + 2 + 12*uint64(order.Uint16(raw[off:])); np+4 <= uint64(len(raw)) {
+		order.PutUint32(raw[np:], 0)
+	}
+}
+
+// TransformJpeg returns Jpeg file data with the image transformed
+// losslessly so that it displays with given orientation as is (Rotated0),
+// and then cropped to given rectangle in the oriented image, if not empty.
+// Returns the new image size, and ErrJpegNotLossless if it cannot be done
+// losslessly.  The metadata segments are kept, with the exif orientation
+// reset, the size updated, and the exif thumbnail removed.
+func TransformJpeg(data []byte, orient Orientations, crop image.Rectangle) ([]byte, image.Point, error) {
+	jc, err := readJpegCoefs(data)
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	tc, err := jc.transform(orientJpegXform(orient), crop)
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	tc.segs = make([]JpegSegment, len(jc.segs))
+	for i, sg := range jc.segs {
+		if sg.Marker == jpegAPP1 && bytes.HasPrefix(sg.Data, []byte(JpegExifPrefix)) {
+			sg.Data = append([]byte(nil), sg.Data...) // modified in place
+			fixTransformedExif(sg.Data[len(JpegExifPrefix):], tc.size)
+		}
+		tc.segs[i] = sg
+	}
+	nd, err := writeJpegCoefs(tc)
+	return nd, tc.size, err
+}
+
+// jpegMCUSize returns the size of the MCUs of the Jpeg file data, from its
+// frame header, which crops must start on to be lossless
+func jpegMCUSize(data []byte) (image.Point, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != jpegSOI {
+		return image.Point{}, errors.New("picinfo.jpegMCUSize: not a Jpeg file")
+	}
+	d := &jpegDecoder{data: data, pos: 2}
+	for {
+		mk, seg, err := d.marker()
+		if err != nil {
+			return image.Point{}, err
+		}
+		switch {
+		case mk == jpegEOI || mk == jpegSOS:
+			return image.Point{}, errors.New("picinfo.jpegMCUSize: no frame found")
+		case mk == jpegSOF0 || mk == jpegSOF1 || mk == jpegSOF2:
+			if len(seg) < 6 || len(seg) < 6+3*int(seg[5]) {
+				return image.Point{}, errors.New("picinfo.jpegMCUSize: SOF truncated")
+			}
+			hmax, vmax := 1, 1
+			for i := 0; i < int(seg[5]); i++ {
+				hv := int(seg[7+3*i])
+				if hv>>4 > hmax {
+					hmax = hv >> 4
+				}
+				if hv&0xf > vmax {
+					vmax = hv & 0xf
+				}
+			}
+			return image.Point{8 * hmax, 8 * vmax}, nil
+		case isJpegSOF(mk):
+			return image.Point{}, ErrJpegNotLossless
+		}
+	}
+}
+
+// SnapJpegCrop returns given crop rectangle in the oriented image of the
+// Jpeg file moved to start on the grid of Jpeg blocks (MCUs), as needed
+// for a lossless crop (see SaveJpegTransformed): to the nearest grid
+// point, or the one before it if the crop would otherwise extend beyond
+// the image, keeping its size.
+func (pi *Info) SnapJpegCrop(crop image.Rectangle) (image.Rectangle, error) {
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		log.Println(err)
+		return crop, err
+	}
+	ms, err := jpegMCUSize(data)
+	if err != nil {
+		return crop, err
+	}
+	ms = pi.Orient.OrientSize(ms)
+	sz := pi.Orient.OrientSize(pi.Size)
+	snap := func(lo, hi, g, n int) int { // offset to the grid
+		s := (lo + g/2) / g * g
+		if n > 0 && hi+s-lo > n {
+			s = lo / g * g
+		}
+		return s - lo
+	}
+	crop = crop.Canon()
+	off := image.Point{snap(crop.Min.X, crop.Max.X, ms.X, sz.X), snap(crop.Min.Y, crop.Max.Y, ms.Y, sz.Y)}
+	return crop.Add(off), nil
+}
+
+// SaveJpegTransformed transforms the Jpeg image file losslessly so that
+// it displays with its current Orient as is, which is then Rotated0, and
+// then crops it to given rectangle in the oriented image, if not empty.
+// The Edits, which are in the oriented image, are moved with the crop.
+// Returns ErrJpegNotLossless if it cannot be done losslessly, in which
+// case the file is not changed.
+func (pi *Info) SaveJpegTransformed(crop image.Rectangle) error {
+	if pi.Orient <= Rotated0 || pi.Orient >= OrientUndef {
+		if crop.Empty() {
+			return pi.SaveMeta() // the data is already oriented
+		}
+	}
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	nd, sz, err := TransformJpeg(data, pi.Orient, crop)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(pi.File, nd, 0664)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if !crop.Empty() && !pi.Edits.Crop.Empty() {
+		crop = crop.Intersect(image.Rectangle{Max: pi.Orient.OrientSize(pi.Size)})
+		ec := pi.Edits.Crop.Sub(crop.Min).Intersect(image.Rectangle{Max: sz})
+		if ec == (image.Rectangle{Max: sz}) {
+			ec = image.Rectangle{}
+		}
+		pi.Edits.Crop = ec
+	}
+	pi.Orient = Rotated0
+	pi.Size = sz
+	pi.UpdateFileMod()
+	return pi.SaveMeta()
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the test images are from the Go image/testdata: 150x103 images with
+// 8x8 (4:4:4) and 16x16 (4:2:0) MCUs, so the transforms are done on the
+// aligned 144x96 part
+var jpegTestFiles = []string{"video-001.jpeg", "video-001.progressive.jpeg",
+	"video-001.q50.420.jpeg", "video-001.q50.420.progressive.jpeg"}
+
+// jpegXformTol is the max difference in a color channel between the
+// transformed image and the transformed pixels, from the rounding in the
+// integer IDCT of the decoder, which is not symmetric in x and y
+const jpegXformTol = 3
+
+func readTestJpeg(t *testing.T, fn string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", fn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decodeTestJpeg(t *testing.T, data []byte) *image.RGBA {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba := image.NewRGBA(image.Rectangle{Max: img.Bounds().Size()})
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// subImage returns a copy of given rectangle of the image
+func subImage(img *image.RGBA, r image.Rectangle) *image.RGBA {
+	sub := image.NewRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(sub, sub.Bounds(), img, r.Min, draw.Src)
+	return sub
+}
+
+// xformPixels returns the image transformed in pixels, with the source
+// position for each destination position of given size
+func xformPixels(img *image.RGBA, sz image.Point, src func(x, y int) (int, int)) *image.RGBA {
+	dst := image.NewRGBA(image.Rectangle{Max: sz})
+	for y := 0; y < sz.Y; y++ {
+		for x := 0; x < sz.X; x++ {
+			dst.SetRGBA(x, y, img.RGBAAt(src(x, y)))
+		}
+	}
+	return dst
+}
+
+// maxPixelDiff returns the max difference in a color channel between the images
+func maxPixelDiff(t *testing.T, a, b *image.RGBA) int {
+	if a.Bounds() != b.Bounds() {
+		t.Fatalf("image bounds differ: %v != %v", a.Bounds(), b.Bounds())
+	}
+	mx := 0
+	for i := range a.Pix {
+		d := int(a.Pix[i]) - int(b.Pix[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > mx {
+			mx = d
+		}
+	}
+	return mx
+}
+
+// alignedTestCoefs returns the coefficients of the test file, cropped to
+// the whole MCUs, and the decoded pixels of that part of the original
+func alignedTestCoefs(t *testing.T, fn string) (*jpegCoefs, *image.RGBA) {
+	data := readTestJpeg(t, fn)
+	jc, err := readJpegCoefs(data)
+	if err != nil {
+		t.Fatal(fn, err)
+	}
+	ms := jc.mcuSize()
+	al := image.Rect(0, 0, jc.size.X/ms.X*ms.X, jc.size.Y/ms.Y*ms.Y)
+	ac, err := jc.transform(jpegXform{}, al)
+	if err != nil {
+		t.Fatal(fn, err)
+	}
+	return ac, subImage(decodeTestJpeg(t, data), al)
+}
+
+func TestJpegIdentity(t *testing.T) {
+	for _, fn := range jpegTestFiles {
+		data := readTestJpeg(t, fn)
+		jc, err := readJpegCoefs(data)
+		if err != nil {
+			t.Fatal(fn, err)
+		}
+		nd, err := writeJpegCoefs(jc)
+		if err != nil {
+			t.Fatal(fn, err)
+		}
+		if d := maxPixelDiff(t, decodeTestJpeg(t, data), decodeTestJpeg(t, nd)); d != 0 {
+			t.Errorf("%s: rewritten image differs by %d", fn, d)
+		}
+	}
+}
+
+func TestJpegTransforms(t *testing.T) {
+	tests := []struct {
+		name   string
+		orient Orientations
+		inv    Orientations
+		xpose  bool
+		src    func(x, y, w, h int) (int, int) // w, h are the source size
+	}{
+		{"rotate90", Rotated90L, Rotated90R, true, func(x, y, w, h int) (int, int) { return y, h - 1 - x }},
+		{"rotate180", Rotated180, Rotated180, false, func(x, y, w, h int) (int, int) { return w - 1 - x, h - 1 - y }},
+		{"rotate270", Rotated90R, Rotated90L, true, func(x, y, w, h int) (int, int) { return w - 1 - y, x }},
+		{"flipH", FlippedH, FlippedH, false, func(x, y, w, h int) (int, int) { return w - 1 - x, y }},
+		{"flipV", FlippedV, FlippedV, false, func(x, y, w, h int) (int, int) { return x, h - 1 - y }},
+	}
+	for _, fn := range jpegTestFiles {
+		ac, orig := alignedTestCoefs(t, fn)
+		w, h := ac.size.X, ac.size.Y
+		for _, tt := range tests {
+			tc, err := ac.transform(orientJpegXform(tt.orient), image.Rectangle{})
+			if err != nil {
+				t.Fatal(fn, tt.name, err)
+			}
+			sz := ac.size
+			if tt.xpose {
+				sz.X, sz.Y = sz.Y, sz.X
+			}
+			if tc.size != sz {
+				t.Errorf("%s %s: size %v, want %v", fn, tt.name, tc.size, sz)
+				continue
+			}
+			nd, err := writeJpegCoefs(tc)
+			if err != nil {
+				t.Fatal(fn, tt.name, err)
+			}
+			want := xformPixels(orig, sz, func(x, y int) (int, int) { return tt.src(x, y, w, h) })
+			if d := maxPixelDiff(t, want, decodeTestJpeg(t, nd)); d > jpegXformTol {
+				t.Errorf("%s %s: transformed image differs by %d", fn, tt.name, d)
+			}
+			// the inverse must restore the exact coefficients
+			rc, err := tc.transform(orientJpegXform(tt.inv), image.Rectangle{})
+			if err != nil {
+				t.Fatal(fn, tt.name, err)
+			}
+			for ci, c := range ac.comps {
+				rcc := rc.comps[ci]
+				if rcc.h != c.h || rcc.v != c.v || len(rcc.blocks) != len(c.blocks) {
+					t.Fatalf("%s %s: component %d layout changed", fn, tt.name, ci)
+				}
+				for bi := range c.blocks {
+					if rcc.blocks[bi] != c.blocks[bi] {
+						t.Errorf("%s %s: component %d block %d not restored", fn, tt.name, ci, bi)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestJpegCrop(t *testing.T) {
+	for _, fn := range jpegTestFiles {
+		data := readTestJpeg(t, fn)
+		orig := decodeTestJpeg(t, data)
+		crops := []struct {
+			crop, bounds image.Rectangle
+		}{
+			{image.Rect(16, 32, 83, 69), image.Rect(16, 32, 83, 69)},
+			{image.Rect(0, 0, 48, 16), image.Rect(0, 0, 48, 16)},
+			{image.Rect(32, 16, 500, 500), image.Rect(32, 16, 150, 103)}, // clipped to the image
+		}
+		for _, cr := range crops {
+			nd, sz, err := TransformJpeg(data, Rotated0, cr.crop)
+			if err != nil {
+				t.Fatal(fn, cr.crop, err)
+			}
+			if sz != cr.bounds.Size() {
+				t.Errorf("%s crop %v: size %v, want %v", fn, cr.crop, sz, cr.bounds.Size())
+				continue
+			}
+			if d := maxPixelDiff(t, subImage(orig, cr.bounds), decodeTestJpeg(t, nd)); d != 0 {
+				t.Errorf("%s crop %v: cropped image differs by %d", fn, cr.crop, d)
+			}
+		}
+		jc, err := readJpegCoefs(data)
+		if err != nil {
+			t.Fatal(fn, err)
+		}
+		ms := jc.mcuSize()
+		for _, cr := range []image.Rectangle{image.Rect(ms.X/2, ms.Y, 40, 40), image.Rect(ms.X, ms.Y/2, 40, 40), image.Rect(160, 0, 200, 50)} {
+			if _, _, err := TransformJpeg(data, Rotated0, cr); !errors.Is(err, ErrJpegNotLossless) {
+				t.Errorf("%s crop %v: err %v, want ErrJpegNotLossless", fn, cr, err)
+			}
+		}
+		// flips of the partial MCUs at the edges cannot be done
+		for _, or := range []Orientations{FlippedH, FlippedV, Rotated180, Rotated90L, Rotated90R} {
+			if _, _, err := TransformJpeg(data, or, image.Rectangle{}); !errors.Is(err, ErrJpegNotLossless) {
+				t.Errorf("%s %v: err %v, want ErrJpegNotLossless", fn, or, err)
+			}
+		}
+	}
+}
+
+func TestJpegCropRotated(t *testing.T) {
+	ac, orig := alignedTestCoefs(t, "video-001.jpeg")
+	data, err := writeJpegCoefs(ac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the crop is in the rotated image, which is 96x144
+	cr := image.Rect(16, 32, 70, 130)
+	nd, sz, err := TransformJpeg(data, Rotated90L, cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sz != cr.Size() {
+		t.Fatalf("size %v, want %v", sz, cr.Size())
+	}
+	h := ac.size.Y
+	want := xformPixels(orig, sz, func(x, y int) (int, int) { return y + cr.Min.Y, h - 1 - (x + cr.Min.X) })
+	if d := maxPixelDiff(t, want, decodeTestJpeg(t, nd)); d > jpegXformTol {
+		t.Errorf("rotated crop differs by %d", d)
+	}
+}
+
+// jpegSegOff returns the offset of the first segment with given marker
+func jpegSegOff(t *testing.T, data []byte, mk byte) int {
+	i := bytes.Index(data, []byte{0xff, mk})
+	if i < 0 {
+		t.Fatalf("marker 0x%02x not found", mk)
+	}
+	return i
+}
+
+func TestJpegMalformed(t *testing.T) {
+	data := readTestJpeg(t, "video-001.jpeg")
+	dht := jpegSegOff(t, data, jpegDHT)
+	sof := jpegSegOff(t, data, jpegSOF0)
+	sos := jpegSegOff(t, data, jpegSOS)
+	tests := []struct {
+		name string
+		edit func(d []byte) []byte
+	}{
+		{"empty", func(d []byte) []byte { return d[:0] }},
+		{"DHT truncated", func(d []byte) []byte { return d[:dht+10] }},
+		{"DHT too many codes", func(d []byte) []byte { d[dht+5] = 3; return d }}, // 3 codes of length 1
+		{"DHT overfull", func(d []byte) []byte { d[dht+5], d[dht+6] = 1, 3; return d }},
+		{"DHT class", func(d []byte) []byte { d[dht+4] = 0x20; return d }},
+		{"DHT id", func(d []byte) []byte { d[dht+4] = 0x05; return d }},
+		{"DHT length", func(d []byte) []byte { d[dht+3] = 10; return d }},
+		{"SOF truncated", func(d []byte) []byte { return d[:sof+8] }},
+		{"SOF components", func(d []byte) []byte { d[sof+9] = 9; return d }},
+		{"SOF sampling", func(d []byte) []byte { d[sof+11] = 0x51; return d }},
+		{"SOF quant id", func(d []byte) []byte { d[sof+12] = 7; return d }},
+		{"SOF length", func(d []byte) []byte { d[sof+3] = 8; return d }},
+		{"SOS table id", func(d []byte) []byte { d[sos+6] = 0x50; return d }},
+		{"no frame", func(d []byte) []byte { return append(d[:sof:sof], d[sos:]...) }},
+	}
+	for _, tt := range tests {
+		d := tt.edit(append([]byte(nil), data...))
+		if _, err := readJpegCoefs(d); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+		if _, _, err := TransformJpeg(d, Rotated0, image.Rectangle{}); err == nil {
+			t.Errorf("%s: TransformJpeg no error", tt.name)
+		}
+	}
+}
+
+func TestSnapJpegCrop(t *testing.T) {
+	fn := "video-001.q50.420.jpeg" // 16x16 MCUs
+	pi := &Info{File: filepath.Join("testdata", fn), Size: image.Pt(150, 103), Orient: Rotated0}
+	tests := []struct {
+		crop, want image.Rectangle
+	}{
+		{image.Rect(5, 9, 40, 40), image.Rect(0, 16, 35, 47)},
+		{image.Rect(40, 9, 5, 40), image.Rect(0, 16, 35, 47)},
+		{image.Rect(30, 90, 140, 100), image.Rect(32, 80, 142, 90)}, // kept within the image
+		{image.Rect(0, 0, 150, 103), image.Rect(0, 0, 150, 103)},
+	}
+	data := readTestJpeg(t, fn)
+	for _, tt := range tests {
+		cr, err := pi.SnapJpegCrop(tt.crop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cr != tt.want {
+			t.Errorf("crop %v: snapped to %v, want %v", tt.crop, cr, tt.want)
+		}
+		if _, _, err := TransformJpeg(data, Rotated0, cr); err != nil {
+			t.Errorf("crop %v: %v", cr, err)
+		}
+	}
+}
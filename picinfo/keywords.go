@@ -0,0 +1,137 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"sort"
+	"strings"
+)
+
+// KeywordSep is the separator between levels of a hierarchical keyword,
+// e.g., Family|Kids|Anna -- this is the Lightroom convention used in
+// the XMP lr:hierarchicalSubject property.
+const KeywordSep = "|"
+
+// CleanKeyword returns the keyword with spaces trimmed around each level,
+// and any empty levels removed.
+func CleanKeyword(kw string) string {
+	lvs := strings.Split(kw, KeywordSep)
+	cl := lvs[:0]
+	for _, lv := range lvs {
+		lv = strings.TrimSpace(lv)
+		if lv != "" {
+			cl = append(cl, lv)
+		}
+	}
+	return strings.Join(cl, KeywordSep)
+}
+
+// KeywordLeaf returns the last, most specific level of a hierarchical keyword
+func KeywordLeaf(kw string) string {
+	if i := strings.LastIndex(kw, KeywordSep); i >= 0 {
+		return kw[i+len(KeywordSep):]
+	}
+	return kw
+}
+
+// ParseKeywords parses a list of keywords separated by commas or semicolons,
+// as entered by the user.
+func ParseKeywords(s string) []string {
+	fs := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' })
+	var kws []string
+	for _, f := range fs {
+		if kw := CleanKeyword(f); kw != "" {
+			kws = append(kws, kw)
+		}
+	}
+	return kws
+}
+
+// setKeywords sets the keywords to given list, cleaned and sorted
+func (pi *Info) setKeywords(kws []string) {
+	pi.Keywords = nil
+	for _, kw := range kws {
+		pi.AddKeyword(kw)
+	}
+}
+
+// HasKeyword returns true if the image has given keyword, or any more
+// specific keyword under it in the hierarchy.
+func (pi *Info) HasKeyword(kw string) bool {
+	kw = CleanKeyword(kw)
+	for _, k := range pi.Keywords {
+		if k == kw || strings.HasPrefix(k, kw+KeywordSep) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddKeyword adds given keyword if not already present, returning true
+// if added.  Keywords are kept sorted.
+func (pi *Info) AddKeyword(kw string) bool {
+	kw = CleanKeyword(kw)
+	if kw == "" {
+		return false
+	}
+	for _, k := range pi.Keywords {
+		if k == kw {
+			return false
+		}
+	}
+	pi.Keywords = append(pi.Keywords, kw)
+	sort.Strings(pi.Keywords)
+	return true
+}
+
+// RemoveKeyword removes given keyword and any more specific keywords under
+// it in the hierarchy, returning true if any were removed.  A keyword without
+// any hierarchy also removes keywords having it as their leaf name.
+func (pi *Info) RemoveKeyword(kw string) bool {
+	kw = CleanKeyword(kw)
+	if kw == "" {
+		return false
+	}
+	flat := !strings.Contains(kw, KeywordSep)
+	nk := pi.Keywords[:0]
+	for _, k := range pi.Keywords {
+		if k == kw || strings.HasPrefix(k, kw+KeywordSep) || (flat && KeywordLeaf(k) == kw) {
+			continue
+		}
+		nk = append(nk, k)
+	}
+	rem := len(nk) != len(pi.Keywords)
+	if len(nk) == 0 {
+		nk = nil
+	}
+	pi.Keywords = nk
+	return rem
+}
+
+// KeywordLeaves returns the unique leaf names of the keywords, which
+// are used for flat keyword lists (XMP dc:subject, IPTC Keywords).
+func (pi *Info) KeywordLeaves() []string {
+	var lvs []string
+	has := make(map[string]bool, len(pi.Keywords))
+	for _, k := range pi.Keywords {
+		lf := KeywordLeaf(k)
+		if has[lf] {
+			continue
+		}
+		has[lf] = true
+		lvs = append(lvs, lf)
+	}
+	return lvs
+}
+
+// HasHierKeywords returns true if any keyword is hierarchical
+func (pi *Info) HasHierKeywords() bool {
+	for _, k := range pi.Keywords {
+		if strings.Contains(k, KeywordSep) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/dsoprea/go-exif/v3"
+	"github.com/goki/pi/filecat"
+)
+
+// RawMeta is the raw metadata found in an image file, prior to parsing
+// into an Info record.
+type RawMeta struct {
+
+	// raw exif data, starting with the TIFF header
+	Exif []byte
+
+	// raw XMP packet embedded in the file
+	XMP []byte
+
+	// raw IPTC-IIM data, e.g., from the Jpeg Photoshop APP13 segment
+	IPTC []byte
+
+	// raw ICC color profile embedded in the file
+	ICC []byte
+
+	// text chunks from PNG files, as keyword -> text
+	Text map[string]string
+
+	// size of the image, if available from the file header
+	Size image.Point
+
+	// number of bits per color component, if available from the file header
+	Depth int
+}
+
+// OpenRawMeta opens the raw metadata from given file, reading only the
+// parts of the file that hold the metadata (see ReadRawMeta).
+// Returns exif.ErrNoExif if no exif data was found, in which case
+// other metadata may still be present.
+func OpenRawMeta(fn string) (*RawMeta, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fst, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	sr := &statsReaderAt{r: f}
+	rm, err := ReadRawMeta(fn, sr, fst.Size())
+	ReadStats.Add(sr.n)
+	return rm, err
+}
+
+// ReadRawMeta reads the raw metadata from given reader for a file of given
+// name (which determines its type) and size.  The format-specific container
+// structure (Jpeg segments, TIFF IFDs, HEIF boxes, PNG and WebP chunks) is walked
+// and only the metadata is read, not the image data, which makes it much
+// faster for large files and large numbers of files.
+// Returns exif.ErrNoExif if no exif data was found, in which case
+// other metadata may still be present.
+func ReadRawMeta(fn string, r io.ReaderAt, size int64) (*RawMeta, error) {
+	rm := &RawMeta{}
+	var err error
+	typ := filecat.SupportedFromFile(fn)
+	switch {
+	case IsRaw(fn):
+		err = rm.ReadRaw(r, size)
+		if err == nil {
+			return rm, nil
+		}
+		log.Printf("File: %s RAW parsing err: %v\n", fn, err)
+	case typ == filecat.Jpeg:
+		err = rm.ReadJpeg(r, size)
+		if err == nil {
+			if rm.Exif == nil {
+				return rm, exif.ErrNoExif
+			}
+			return rm, nil
+		}
+		log.Printf("File: %s Jpeg parsing err: %v\n", fn, err)
+	case typ == filecat.Png:
+		err = rm.ReadPng(r, size)
+		if err == nil {
+			if rm.Exif == nil {
+				return rm, exif.ErrNoExif
+			}
+			return rm, nil
+		}
+		log.Printf("File: %s PNG parsing err: %v\n", fn, err)
+	case typ == filecat.Tiff:
+		err = rm.ReadTiff(r, size)
+		if err == nil {
+			return rm, nil
+		}
+		log.Printf("File: %s TIFF parsing err: %v\n", fn, err)
+	case typ == filecat.Heic || IsAvif(fn):
+		err = rm.ReadHeic(r, size)
+		if err == nil {
+			if rm.Exif == nil {
+				return rm, exif.ErrNoExif
+			}
+			return rm, nil
+		}
+		log.Printf("File: %s HEIC parsing err: %v\n", fn, err)
+	case IsWebp(fn):
+		err = rm.ReadWebp(r, size)
+		if err == nil {
+			if rm.Exif == nil {
+				return rm, exif.ErrNoExif
+			}
+			return rm, nil
+		}
+		log.Printf("File: %s WebP parsing err: %v\n", fn, err)
+	}
+	rm.Exif, err = exif.SearchAndExtractExifWithReader(io.NewSectionReader(r, 0, size))
+	return rm, err
+}
+
+// readAt reads n bytes at given offset, returning an error if they are
+// not all within the file size
+func readAt(r io.ReaderAt, size, off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > size {
+		return nil, fmt.Errorf("picinfo: read of %d bytes at %d is beyond end of file", n, off)
+	}
+	b := make([]byte, n)
+	rn, err := r.ReadAt(b, off)
+	if rn == n {
+		return b, nil
+	}
+	return nil, err
+}
+
+// MetaStats records the amount of file data read for metadata, so that
+// the cost of scanning a large library can be measured.  All methods are
+// safe for concurrent use.
+type MetaStats struct {
+
+	// number of files read
+	Files int64
+
+	// number of bytes read
+	Bytes int64
+}
+
+// ReadStats are the stats for all metadata reads by OpenRawMeta
+var ReadStats MetaStats
+
+// Add adds one file with given number of bytes read
+func (ms *MetaStats) Add(bytes int64) {
+	atomic.AddInt64(&ms.Files, 1)
+	atomic.AddInt64(&ms.Bytes, bytes)
+}
+
+// Reset resets the stats to zero
+func (ms *MetaStats) Reset() {
+	atomic.StoreInt64(&ms.Files, 0)
+	atomic.StoreInt64(&ms.Bytes, 0)
+}
+
+// String returns the stats as: files, total MB read, and KB per file
+func (ms *MetaStats) String() string {
+	nf := atomic.LoadInt64(&ms.Files)
+	nb := atomic.LoadInt64(&ms.Bytes)
+	per := 0.0
+	if nf > 0 {
+		per = float64(nb) / float64(nf) / 1024
+	}
+	return fmt.Sprintf("%d files, %.1f MB read, %.1f KB per file", nf, float64(nb)/(1024*1024), per)
+}
+
+// statsReaderAt counts the bytes read through it
+type statsReaderAt struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (sr *statsReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := sr.r.ReadAt(p, off)
+	sr.n += int64(n)
+	return n, err
+}
+
+// SetFromRawMeta sets the Info from given raw metadata.
+// Embedded XMP takes precedence over IPTC and exif, which take precedence
+// over other sources such as PNG text.
+func (pi *Info) SetFromRawMeta(rm *RawMeta) {
+	if rm.Text != nil {
+		pi.SetFromPngText(rm.Text)
+	}
+	pi.ParseRawExif(rm.Exif)
+	if rm.IPTC != nil {
+		pi.SetFromIPTC(ParseIPTC(rm.IPTC))
+	}
+	if rm.Size != image.ZP { // header is more reliable than exif
+		pi.Size = rm.Size
+	}
+	if rm.Depth > 0 {
+		pi.Depth = rm.Depth
+	}
+	if rm.XMP != nil {
+		x, err := ParseXMP(rm.XMP)
+		if err != nil {
+			log.Printf("File: %s XMP err: %v\n", pi.File, err)
+		} else {
+			pi.SetFromXMP(x)
+		}
+	}
+}
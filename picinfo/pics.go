@@ -17,7 +17,8 @@ import (
 // Pics is a slice of Info for a list of pictures
 type Pics []*Info
 
-// SortByDate sorts the pictures by date taken
+// SortByDate sorts the pictures by date taken, which is the actual time
+// when taken, taking into account the time zone of each picture
 func (pc Pics) SortByDate(ascending bool) {
 	if ascending {
 		sort.Slice(pc, func(i, j int) bool {
@@ -30,6 +31,87 @@ func (pc Pics) SortByDate(ascending bool) {
 	}
 }
 
+// SortByKey sorts the pictures by given string key function (e.g., camera name),
+// and then by date taken within the same key
+func (pc Pics) SortByKey(key func(pi *Info) string, ascending bool) {
+	sort.SliceStable(pc, func(i, j int) bool {
+		ki, kj := key(pc[i]), key(pc[j])
+		if ki == kj {
+			return pc[i].DateTaken.Before(pc[j].DateTaken)
+		}
+		if ascending {
+			return ki < kj
+		}
+		return kj < ki
+	})
+}
+
+// Filter returns the pictures for which given function returns true
+func (pc Pics) Filter(fun func(pi *Info) bool) Pics {
+	var fp Pics
+	for _, pi := range pc {
+		if fun(pi) {
+			fp = append(fp, pi)
+		}
+	}
+	return fp
+}
+
+// NameCount is the number of pictures having a given name, e.g., of a camera
+type NameCount struct {
+
+	// name, e.g., of the camera or lens
+	Name string
+
+	// number of pictures
+	Count int
+}
+
+// CountBy returns the number of pictures for each value of given string key
+// function (e.g., camera name), sorted by descending count.
+// Pictures with an empty key are counted under "(none)".
+func (pc Pics) CountBy(key func(pi *Info) string) []NameCount {
+	cnt := make(map[string]int)
+	for _, pi := range pc {
+		k := key(pi)
+		if k == "" {
+			k = "(none)"
+		}
+		cnt[k]++
+	}
+	ncs := make([]NameCount, 0, len(cnt))
+	for k, c := range cnt {
+		ncs = append(ncs, NameCount{k, c})
+	}
+	sort.Slice(ncs, func(i, j int) bool {
+		if ncs[i].Count == ncs[j].Count {
+			return ncs[i].Name < ncs[j].Name
+		}
+		return ncs[i].Count > ncs[j].Count
+	})
+	return ncs
+}
+
+// CameraName returns the camera name -- for use as a key function
+func CameraName(pi *Info) string {
+	return pi.Camera.Name()
+}
+
+// LensName returns the lens name -- for use as a key function
+func LensName(pi *Info) string {
+	return pi.Lens.Name()
+}
+
+// PlaceName returns the place name -- for use as a key function
+func PlaceName(pi *Info) string {
+	return pi.Place.Name()
+}
+
+// CountryName returns the country of the place -- for use as a key function
+func CountryName(pi *Info) string {
+	return pi.Place.Country
+}
+
 // Thumbs returns the list of thumbs for this set of pictures
 func (pc Pics) Thumbs() []string {
 	th := make([]string, len(pc))
@@ -97,6 +179,9 @@ func (pm *PicMap) OpenJSON(fname string) error {
 	if err != nil {
 		log.Println(err)
 	}
+	for _, pi := range *pm {
+		pi.SetDefaultZone()
+	}
 	return err
 }
 
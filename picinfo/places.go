@@ -0,0 +1,253 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Place is the name of the place where a picture was taken, as looked up
+// from its GPS location in a Gazetteer
+type Place struct {
+
+	// country name, e.g., United States
+	Country string
+
+	// region (state, province) name, e.g., California
+	Region string
+
+	// city or town name, e.g., San Francisco
+	City string
+
+	// GPS location the place was looked up for -- the place is looked up
+	// again when the picture's location changes
+	Loc GPSCoord `view:"-"`
+}
+
+// Name returns the place name from the broadest to the most specific,
+// e.g., United States, California, San Francisco -- this sorts places
+// within the same country and region together.
+func (pl *Place) Name() string {
+	var nms []string
+	for _, nm := range []string{pl.Country, pl.Region, pl.City} {
+		if nm != "" {
+			nms = append(nms, nm)
+		}
+	}
+	return strings.Join(nms, ", ")
+}
+
+// IsZero returns true if no place is set
+func (pl *Place) IsZero() bool {
+	return pl.Country == "" && pl.Region == "" && pl.City == ""
+}
+
+// GazPlace is one place in the Gazetteer
+type GazPlace struct {
+
+	// name of the place
+	Name string
+
+	// latitude in decimal degrees
+	Lat float64
+
+	// longitude in decimal degrees
+	Long float64
+
+	// ISO 3166 country code, e.g., US
+	Country string
+
+	// first-level administrative division code, e.g., CA
+	Region string
+}
+
+// gazCell is a 1 x 1 degree cell of the gazetteer spatial index
+type gazCell struct {
+	Lat, Long int
+}
+
+// Gazetteer is a list of places, typically cities and towns, used for
+// offline reverse geocoding of GPS locations to place names.
+// It is read from a GeoNames-format file (e.g., cities15000.txt from
+// https://download.geonames.org/export/dump/), and country and region names
+// are taken from the countryInfo.txt and admin1CodesASCII.txt files in the
+// same directory if present -- otherwise their codes are used.
+type Gazetteer struct {
+
+	// file the places were read from
+	File string
+
+	// all the places
+	Places []GazPlace
+
+	// country names by ISO code
+	Countries map[string]string
+
+	// region names by country.region code, e.g., US.CA
+	Regions map[string]string
+
+	// index of places by cell
+	cells map[gazCell][]int
+}
+
+// GazetteerMaxKm is the default maximum distance in kilometers of the
+// nearest place in the gazetteer, beyond which a location has no place
+var GazetteerMaxKm = 50.0
+
+// OpenGazetteer opens a GeoNames-format gazetteer file, along with the
+// country and region names files in the same directory if present.
+func OpenGazetteer(fn string) (*Gazetteer, error) {
+	gz := &Gazetteer{File: fn, cells: make(map[gazCell][]int)}
+	err := readTabFile(fn, func(fs []string) {
+		if len(fs) < 11 {
+			return
+		}
+		lat, err := strconv.ParseFloat(fs[4], 64)
+		if err != nil {
+			return
+		}
+		long, err := strconv.ParseFloat(fs[5], 64)
+		if err != nil {
+			return
+		}
+		gp := GazPlace{Name: fs[1], Lat: lat, Long: long, Country: fs[8], Region: fs[10]}
+		c := gazCellFor(lat, long)
+		gz.cells[c] = append(gz.cells[c], len(gz.Places))
+		gz.Places = append(gz.Places, gp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(gz.Places) == 0 {
+		return nil, fmt.Errorf("picinfo.OpenGazetteer: no places found in: %s", fn)
+	}
+	dir := filepath.Dir(fn)
+	gz.Countries = make(map[string]string)
+	readTabFile(filepath.Join(dir, "countryInfo.txt"), func(fs []string) {
+		if len(fs) >= 5 {
+			gz.Countries[fs[0]] = fs[4]
+		}
+	})
+	gz.Regions = make(map[string]string)
+	readTabFile(filepath.Join(dir, "admin1CodesASCII.txt"), func(fs []string) {
+		if len(fs) >= 2 {
+			gz.Regions[fs[0]] = fs[1]
+		}
+	})
+	return gz, nil
+}
+
+// readTabFile calls fun with the fields of each line of a tab-separated
+// file, skipping # comment lines
+func readTabFile(fn string, fun func(fs []string)) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024) // alternate names can be long
+	for sc.Scan() {
+		ln := sc.Text()
+		if ln == "" || ln[0] == '#' {
+			continue
+		}
+		fun(strings.Split(ln, "\t"))
+	}
+	return sc.Err()
+}
+
+// gazCellFor returns the index cell for given location
+func gazCellFor(lat, long float64) gazCell {
+	return gazCell{Lat: int(math.Floor(lat)), Long: int(math.Floor(long))}
+}
+
+// Nearest returns the nearest place to given location, and its distance
+// in kilometers -- nil if there is no place within maxKm.
+func (gz *Gazetteer) Nearest(loc GPSCoord, maxKm float64) (*GazPlace, float64) {
+	dlat := int(math.Ceil(maxKm / 111))
+	coslat := math.Cos(loc.Lat * math.Pi / 180)
+	dlong := 180
+	if coslat > 0.01 {
+		dlong = int(math.Ceil(maxKm / (111 * coslat)))
+		if dlong > 180 {
+			dlong = 180
+		}
+	}
+	c := gazCellFor(loc.Lat, loc.Long)
+	var near *GazPlace
+	dist := maxKm
+	for la := c.Lat - dlat; la <= c.Lat+dlat; la++ {
+		for lo := c.Long - dlong; lo <= c.Long+dlong; lo++ {
+			wlo := ((lo+180)%360+360)%360 - 180 // wrap across the 180 meridian
+			for _, i := range gz.cells[gazCell{Lat: la, Long: wlo}] {
+				gp := &gz.Places[i]
+				d := GPSDistKm(loc, GPSCoord{Lat: gp.Lat, Long: gp.Long})
+				if d <= dist {
+					near, dist = gp, d
+				}
+			}
+		}
+	}
+	return near, dist
+}
+
+// Lookup returns the place for given location, using the nearest place
+// within maxKm -- false if there is none.
+func (gz *Gazetteer) Lookup(loc GPSCoord, maxKm float64) (Place, bool) {
+	gp, _ := gz.Nearest(loc, maxKm)
+	if gp == nil {
+		return Place{Loc: loc}, false
+	}
+	pl := Place{Country: gp.Country, Region: gp.Region, City: gp.Name, Loc: loc}
+	if nm, has := gz.Countries[gp.Country]; has {
+		pl.Country = nm
+	}
+	if nm, has := gz.Regions[gp.Country+"."+gp.Region]; has {
+		pl.Region = nm
+	}
+	return pl, true
+}
+
+// GPSDistKm returns the great-circle distance between two locations in kilometers
+func GPSDistKm(a, b GPSCoord) float64 {
+	const r = 6371 // mean earth radius
+	rad := math.Pi / 180
+	dlat := (b.Lat - a.Lat) * rad
+	dlong := (b.Long - a.Long) * rad
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(a.Lat*rad)*math.Cos(b.Lat*rad)*math.Sin(dlong/2)*math.Sin(dlong/2)
+	return 2 * r * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// NeedsPlace returns true if the place needs to be looked up, because
+// the image has a GPS location that differs from the one the place
+// was looked up for, or cleared, because it no longer has a location.
+func (pi *Info) NeedsPlace() bool {
+	if !pi.HasGPS() {
+		return !pi.Place.IsZero()
+	}
+	return !pi.Place.Loc.Near(pi.GPSLoc)
+}
+
+// SetPlace looks up the place for the GPS location in given gazetteer,
+// within maxKm, returning true if the place changed.  The place is cleared
+// if there is no GPS location.
+func (pi *Info) SetPlace(gz *Gazetteer, maxKm float64) bool {
+	if !pi.HasGPS() {
+		chg := !pi.Place.IsZero()
+		pi.Place = Place{}
+		return chg
+	}
+	pl, _ := gz.Lookup(pi.GPSLoc, maxKm)
+	chg := pl != pi.Place
+	pi.Place = pl
+	return chg
+}
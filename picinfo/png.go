@@ -0,0 +1,441 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dsoprea/go-exif/v3"
+)
+
+// reference for PNG chunks, including eXIf:
+// http://www.libpng.org/pub/png/spec/1.2/PNG-Chunks.html
+// https://ftp-osl.osuosl.org/pub/libpng/documents/pngext-1.5.0.html#C.eXIf
+
+// PngSignature is the 8 byte signature at the start of all PNG files
+var PngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// PngXMPKeyword is the iTXt keyword for an embedded XMP packet
+const PngXMPKeyword = "XML:com.adobe.xmp"
+
+// PngChunk is one chunk of a PNG file
+type PngChunk struct {
+
+	// 4 letter chunk type, e.g., IHDR, IDAT, eXIf
+	Type string
+
+	// chunk data, not including length, type or crc
+	Data []byte
+}
+
+// ParsePngChunks parses PNG file data into its list of chunks
+func ParsePngChunks(data []byte) ([]PngChunk, error) {
+	if !bytes.HasPrefix(data, PngSignature) {
+		return nil, errors.New("picinfo.ParsePngChunks: not a PNG file")
+	}
+	var chunks []PngChunk
+	pos := len(PngSignature)
+	for pos+8 <= len(data) {
+		ln := int(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		st := pos + 8
+		ed := st + ln
+		if ln < 0 || ed+4 > len(data) {
+			return chunks, fmt.Errorf("picinfo.ParsePngChunks: chunk %s truncated", typ)
+		}
+		chunks = append(chunks, PngChunk{Type: typ, Data: data[st:ed]})
+		pos = ed + 4 // skip crc
+		if typ == "IEND" {
+			return chunks, nil
+		}
+	}
+	return chunks, errors.New("picinfo.ParsePngChunks: IEND chunk missing, file truncated")
+}
+
+// ReadPngMetaChunks reads the chunks of a PNG file of given size, without
+// reading the data of the IDAT image data chunks, which is left nil.
+func ReadPngMetaChunks(r io.ReaderAt, size int64) ([]PngChunk, error) {
+	sig, err := readAt(r, size, 0, len(PngSignature))
+	if err != nil || !bytes.Equal(sig, PngSignature) {
+		return nil, errors.New("picinfo.ReadPngMetaChunks: not a PNG file")
+	}
+	var chunks []PngChunk
+	pos := int64(len(PngSignature))
+	for pos+8 <= size {
+		hdr, err := readAt(r, size, pos, 8)
+		if err != nil {
+			return chunks, err
+		}
+		ln := int64(binary.BigEndian.Uint32(hdr))
+		typ := string(hdr[4:8])
+		st := pos + 8
+		ed := st + ln
+		if ed+4 > size {
+			return chunks, fmt.Errorf("picinfo.ReadPngMetaChunks: chunk %s truncated", typ)
+		}
+		ch := PngChunk{Type: typ}
+		if typ != "IDAT" {
+			ch.Data, err = readAt(r, size, st, int(ln))
+			if err != nil {
+				return chunks, err
+			}
+		}
+		chunks = append(chunks, ch)
+		pos = ed + 4 // skip crc
+		if typ == "IEND" {
+			return chunks, nil
+		}
+	}
+	return chunks, errors.New("picinfo.ReadPngMetaChunks: IEND chunk missing, file truncated")
+}
+
+// WritePngChunks writes the PNG signature and given chunks, with crcs
+func WritePngChunks(w io.Writer, chunks []PngChunk) error {
+	if _, err := w.Write(PngSignature); err != nil {
+		return err
+	}
+	var hdr [8]byte
+	for _, ch := range chunks {
+		binary.BigEndian.PutUint32(hdr[:4], uint32(len(ch.Data)))
+		copy(hdr[4:], ch.Type)
+		crc := crc32.NewIEEE()
+		crc.Write(hdr[4:])
+		crc.Write(ch.Data)
+		if _, err := w.Write(hdr[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(ch.Data); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, crc.Sum32()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PngChunkIdx returns the index of the first chunk of given type,
+// -1 if not found.
+func PngChunkIdx(chunks []PngChunk, typ string) int {
+	for i, ch := range chunks {
+		if ch.Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+// PngTextChunk decodes a tEXt, zTXt or iTXt chunk into its keyword and text
+func PngTextChunk(ch *PngChunk) (key, text string, err error) {
+	kb, rest, ok := bytes.Cut(ch.Data, []byte{0})
+	if !ok {
+		return "", "", fmt.Errorf("picinfo.PngTextChunk: %s missing keyword", ch.Type)
+	}
+	key = string(kb)
+	switch ch.Type {
+	case "tEXt":
+		return key, string(rest), nil
+	case "zTXt":
+		if len(rest) < 1 {
+			return key, "", fmt.Errorf("picinfo.PngTextChunk: %s truncated", ch.Type)
+		}
+		txt, err := pngInflate(rest[1:])
+		return key, string(txt), err
+	case "iTXt":
+		if len(rest) < 2 {
+			return key, "", fmt.Errorf("picinfo.PngTextChunk: %s truncated", ch.Type)
+		}
+		comp := rest[0] == 1
+		rest = rest[2:]
+		_, rest, _ = bytes.Cut(rest, []byte{0}) // language tag
+		_, rest, _ = bytes.Cut(rest, []byte{0}) // translated keyword
+		if comp {
+			txt, err := pngInflate(rest)
+			return key, string(txt), err
+		}
+		return key, string(rest), nil
+	}
+	return key, "", fmt.Errorf("picinfo.PngTextChunk: %s is not a text chunk", ch.Type)
+}
+
+// NewPngITXtChunk returns a new uncompressed iTXt chunk with given keyword and text
+func NewPngITXtChunk(key, text string) PngChunk {
+	var b bytes.Buffer
+	b.WriteString(key)
+	b.Write([]byte{0, 0, 0, 0, 0}) // null, comp flag, method, lang null, trans null
+	b.WriteString(text)
+	return PngChunk{Type: "iTXt", Data: b.Bytes()}
+}
+
+func pngInflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// pngXMPIdx returns the index of the iTXt chunk with the XMP packet, -1 if none
+func pngXMPIdx(chunks []PngChunk) int {
+	for i := range chunks {
+		ch := &chunks[i]
+		if ch.Type == "iTXt" && bytes.HasPrefix(ch.Data, []byte(PngXMPKeyword+"\x00")) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParsePng parses the metadata from PNG file data into RawMeta
+func (rm *RawMeta) ParsePng(data []byte) error {
+	chunks, err := ParsePngChunks(data)
+	return rm.setFromPngChunks(chunks, err)
+}
+
+// ReadPng reads the metadata from a PNG file of given size into RawMeta,
+// skipping over the image data
+func (rm *RawMeta) ReadPng(r io.ReaderAt, size int64) error {
+	chunks, err := ReadPngMetaChunks(r, size)
+	return rm.setFromPngChunks(chunks, err)
+}
+
+// setFromPngChunks sets the metadata from given chunks, which were
+// parsed with given error
+func (rm *RawMeta) setFromPngChunks(chunks []PngChunk, err error) error {
+	if len(chunks) == 0 {
+		return err
+	}
+	for i := range chunks {
+		ch := &chunks[i]
+		switch ch.Type {
+		case "IHDR":
+			if len(ch.Data) >= 9 {
+				rm.Size.X = int(binary.BigEndian.Uint32(ch.Data[0:]))
+				rm.Size.Y = int(binary.BigEndian.Uint32(ch.Data[4:]))
+				rm.Depth = int(ch.Data[8])
+			}
+		case "eXIf":
+			rm.Exif = bytes.TrimPrefix(ch.Data, []byte("Exif\x00\x00"))
+		case "iCCP": // profile name, compression method, zlib data
+			if i := bytes.IndexByte(ch.Data, 0); i >= 0 && i+2 <= len(ch.Data) {
+				icc, ierr := pngInflate(ch.Data[i+2:])
+				if ierr != nil {
+					log.Println(ierr)
+					continue
+				}
+				rm.ICC = icc
+			}
+		case "tEXt", "zTXt", "iTXt":
+			key, txt, terr := PngTextChunk(ch)
+			if terr != nil {
+				log.Println(terr)
+				continue
+			}
+			if key == PngXMPKeyword {
+				rm.XMP = []byte(txt)
+				continue
+			}
+			if rm.Text == nil {
+				rm.Text = make(map[string]string)
+			}
+			rm.Text[key] = txt
+		}
+	}
+	return err
+}
+
+// SetFromPngText sets Info fields from standard PNG text keywords
+func (pi *Info) SetFromPngText(text map[string]string) {
+	if ds, has := text["Description"]; has && ds != "" {
+		pi.Desc = ds
+	} else if cs, has := text["Comment"]; has && cs != "" {
+		pi.Desc = cs
+	}
+	if ct, has := text["Creation Time"]; has {
+		fmts := []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "2006:01:02 15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+		for i, ft := range fmts {
+			dt, err := time.ParseInLocation(ft, strings.TrimSpace(ct), DefaultZone)
+			if err == nil {
+				pi.DateTaken = dt
+				if i < 3 { // has zone
+					pi.SetZone(ZoneOffset(dt), ZoneMeta)
+				}
+				break
+			}
+		}
+	}
+}
+
+// isPngText returns true if given chunk type is a text chunk
+func isPngText(typ string) bool {
+	return typ == "tEXt" || typ == "zTXt" || typ == "iTXt"
+}
+
+// pngExifUpdts returns true if given exif updates warrant adding an eXIf
+// chunk: the size alone does not, as it is in the IHDR chunk
+func pngExifUpdts(updts []string) bool {
+	for _, u := range updts {
+		if u != "Size.X" && u != "Size.Y" {
+			return true
+		}
+	}
+	return false
+}
+
+// updatePngText updates the Description text chunks to the Desc, or
+// deletes them if it is empty, returning the updated chunks and true if
+// any changed.  A Comment is updated in place of a Description if there
+// is none, as it is then read as the Desc (see SetFromPngText).  New text
+// chunks are not added, as the Desc is also saved in the exif and XMP.
+func (pi *Info) updatePngText(chunks []PngChunk) ([]PngChunk, bool) {
+	key := "Description"
+	hasDesc := false
+	for i := range chunks {
+		if !isPngText(chunks[i].Type) {
+			continue
+		}
+		if k, _, err := PngTextChunk(&chunks[i]); err == nil && k == key {
+			hasDesc = true
+			break
+		}
+	}
+	if !hasDesc {
+		key = "Comment"
+	}
+	updt := false
+	nch := chunks[:0:0]
+	for i := range chunks {
+		ch := &chunks[i]
+		if !isPngText(ch.Type) {
+			nch = append(nch, *ch)
+			continue
+		}
+		k, txt, err := PngTextChunk(ch)
+		switch {
+		case err != nil || (k != "Description" && k != "Comment"):
+		case pi.Desc == "":
+			updt = true
+			continue
+		case k == key && txt != pi.Desc:
+			nch = append(nch, NewPngITXtChunk(k, pi.Desc))
+			updt = true
+			continue
+		}
+		nch = append(nch, *ch)
+	}
+	return nch, updt
+}
+
+// SavePngUpdated updates the eXIf and XMP iTXt chunks of the PNG file
+// to reflect the current info, and the Description text chunks (see
+// updatePngText), leaving all other chunks intact.  Chunks are only
+// written, or added, if their content changed.  The image data is not
+// re-encoded.
+func (pi *Info) SavePngUpdated() error {
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	chunks, err := ParsePngChunks(data)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if pi.Size == image.ZP {
+		if hi := PngChunkIdx(chunks, "IHDR"); hi >= 0 && len(chunks[hi].Data) >= 8 {
+			pi.Size.X = int(binary.BigEndian.Uint32(chunks[hi].Data[0:]))
+			pi.Size.Y = int(binary.BigEndian.Uint32(chunks[hi].Data[4:]))
+		}
+	}
+
+	var rawExif []byte
+	ei := PngChunkIdx(chunks, "eXIf")
+	if ei >= 0 {
+		rawExif = bytes.TrimPrefix(chunks[ei].Data, []byte("Exif\x00\x00"))
+	}
+	ib, updts, err := pi.UpdateExif(rawExif, nil)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	x := NewXMP()
+	xi := pngXMPIdx(chunks)
+	if xi >= 0 {
+		_, txt, terr := PngTextChunk(&chunks[xi])
+		if terr == nil {
+			if px, perr := ParseXMP([]byte(txt)); perr == nil {
+				x = px
+			}
+		}
+	}
+	xupdts := pi.UpdateXMP(x)
+	if ei < 0 && !pngExifUpdts(updts) {
+		updts = nil
+	}
+	chunks, tupdt := pi.updatePngText(chunks)
+	if len(updts) == 0 && len(xupdts) == 0 && !tupdt {
+		fmt.Printf("File: %s had no updates to metadata\n", pi.File)
+		return nil
+	}
+	fmt.Printf("File: %s updating Exif: %v  XMP: %v  Text: %v\n", pi.File, updts, xupdts, tupdt)
+
+	var nch []PngChunk
+	if len(updts) > 0 {
+		exifData, err := exif.NewIfdByteEncoder().EncodeToExif(ib)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		exch := PngChunk{Type: "eXIf", Data: exifData}
+		if ei = PngChunkIdx(chunks, "eXIf"); ei >= 0 {
+			chunks[ei] = exch
+		} else {
+			nch = append(nch, exch)
+		}
+	}
+	if len(xupdts) > 0 {
+		xmch := NewPngITXtChunk(PngXMPKeyword, string(x.Bytes()))
+		if xi = pngXMPIdx(chunks); xi >= 0 {
+			chunks[xi] = xmch
+		} else {
+			nch = append(nch, xmch)
+		}
+	}
+	if len(nch) > 0 { // insert prior to image data
+		ii := PngChunkIdx(chunks, "IDAT")
+		if ii < 0 {
+			return fmt.Errorf("picinfo.SavePngUpdated: %s has no IDAT chunk", pi.File)
+		}
+		chunks = append(chunks[:ii], append(nch, chunks[ii:]...)...)
+	}
+
+	var b bytes.Buffer
+	err = WritePngChunks(&b, chunks)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = os.WriteFile(pi.File, b.Bytes(), 0664)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	pi.UpdateFileMod()
+	return nil
+}
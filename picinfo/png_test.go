@@ -0,0 +1,194 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestPng returns a generated PNG file, with given text chunks
+// inserted before the image data
+func newTestPng(t *testing.T, text ...PngChunk) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 19, 11))
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 19; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 13), uint8(y * 23), 0x80, 0xff})
+		}
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := ParsePngChunks(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ii := PngChunkIdx(chunks, "IDAT")
+	chunks = append(chunks[:ii], append(text, chunks[ii:]...)...)
+	var nb bytes.Buffer // the chunks refer to b
+	if err := WritePngChunks(&nb, chunks); err != nil {
+		t.Fatal(err)
+	}
+	return nb.Bytes()
+}
+
+func TestPngChunks(t *testing.T) {
+	data := newTestPng(t, PngChunk{Type: "tEXt", Data: []byte("Comment\x00a comment")},
+		NewPngITXtChunk("Description", "a description"))
+	chunks, err := ParsePngChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WritePngChunks(&b, chunks); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), data) {
+		t.Error("chunks written differ from those read")
+	}
+	if _, err := png.Decode(bytes.NewReader(b.Bytes())); err != nil {
+		t.Errorf("written chunks do not decode: %v", err)
+	}
+	mchunks, err := ReadPngMetaChunks(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mchunks) != len(chunks) {
+		t.Errorf("read %d meta chunks, want %d", len(mchunks), len(chunks))
+	}
+
+	texts := []struct {
+		ch        PngChunk
+		key, text string
+		ok        bool
+	}{
+		{PngChunk{Type: "tEXt", Data: []byte("Comment\x00a comment")}, "Comment", "a comment", true},
+		{NewPngITXtChunk("Description", "a déscription"), "Description", "a déscription", true},
+		{PngChunk{Type: "tEXt", Data: []byte("Comment")}, "", "", false},
+		{PngChunk{Type: "iTXt", Data: []byte("Description\x00")}, "Description", "", false},
+		{PngChunk{Type: "zTXt", Data: []byte("Comment\x00")}, "Comment", "", false},
+		{PngChunk{Type: "IDAT", Data: []byte("Comment\x00")}, "Comment", "", false},
+	}
+	for _, tt := range texts {
+		key, text, err := PngTextChunk(&tt.ch)
+		if (err == nil) != tt.ok || key != tt.key || text != tt.text {
+			t.Errorf("%s %q read as %q %q %v", tt.ch.Type, tt.ch.Data, key, text, err)
+		}
+	}
+
+	// truncated data
+	for _, n := range []int{4, len(PngSignature) + 6, len(PngSignature) + 20, len(data) - 13} {
+		if _, err := ParsePngChunks(data[:n]); err == nil {
+			t.Errorf("chunks truncated to %d bytes read", n)
+		}
+		if _, err := ReadPngMetaChunks(bytes.NewReader(data[:n]), int64(n)); err == nil {
+			t.Errorf("meta chunks truncated to %d bytes read", n)
+		}
+	}
+}
+
+// readTestPngInfo returns the info read from the PNG file, and its chunks
+func readTestPngInfo(t *testing.T, fn string) (*Info, []PngChunk) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := &RawMeta{}
+	if err := rm.ParsePng(data); err != nil {
+		t.Fatal(err)
+	}
+	pi := &Info{File: fn}
+	pi.SetFromRawMeta(rm)
+	chunks, err := ParsePngChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pi, chunks
+}
+
+func TestSavePngUpdated(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.png")
+	orig := newTestPng(t)
+	if err := os.WriteFile(fn, orig, 0664); err != nil {
+		t.Fatal(err)
+	}
+	pi, _ := readTestPngInfo(t, fn)
+
+	// nothing changed: no chunks added
+	if err := pi.SavePngUpdated(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mustReadFile(t, fn), orig) {
+		t.Error("file changed without any changes to the info")
+	}
+
+	orig = newTestPng(t, PngChunk{Type: "tEXt", Data: []byte("Description\x00old description")},
+		PngChunk{Type: "tEXt", Data: []byte("Comment\x00a comment")})
+	if err := os.WriteFile(fn, orig, 0664); err != nil {
+		t.Fatal(err)
+	}
+	pi, _ = readTestPngInfo(t, fn)
+	if pi.Desc != "old description" {
+		t.Fatalf("Desc read as %q", pi.Desc)
+	}
+
+	pi.Desc = "new description"
+	if err := pi.SavePngUpdated(); err != nil {
+		t.Fatal(err)
+	}
+	npi, chunks := readTestPngInfo(t, fn)
+	if npi.Desc != pi.Desc {
+		t.Errorf("changed Desc read back as %q", npi.Desc)
+	}
+	ei := PngChunkIdx(chunks, "eXIf")
+	if ei < 0 || pngXMPIdx(chunks) < 0 {
+		t.Fatal("eXIf or XMP chunk not added")
+	}
+	exifData := append([]byte{}, chunks[ei].Data...)
+
+	// only in XMP: the eXIf chunk is not rewritten
+	pi.Rating = 4
+	if err := pi.SavePngUpdated(); err != nil {
+		t.Fatal(err)
+	}
+	npi, chunks = readTestPngInfo(t, fn)
+	if npi.Rating != 4 {
+		t.Errorf("Rating read back as %d", npi.Rating)
+	}
+	if !bytes.Equal(chunks[PngChunkIdx(chunks, "eXIf")].Data, exifData) {
+		t.Error("eXIf chunk rewritten without any changes to it")
+	}
+
+	pi.Desc = ""
+	if err := pi.SavePngUpdated(); err != nil {
+		t.Fatal(err)
+	}
+	npi, chunks = readTestPngInfo(t, fn)
+	if npi.Desc != "" {
+		t.Errorf("cleared Desc read back as %q", npi.Desc)
+	}
+	for i := range chunks {
+		if key, _, err := PngTextChunk(&chunks[i]); err == nil && (key == "Description" || key == "Comment") {
+			t.Errorf("%s text chunk not deleted", key)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(mustReadFile(t, fn))); err != nil {
+		t.Errorf("updated file does not decode: %v", err)
+	}
+}
+
+func mustReadFile(t *testing.T, fn string) []byte {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"image/color"
+	"strings"
+
+	"github.com/goki/ki/kit"
+)
+
+// MaxRating is the maximum star rating
+const MaxRating = 5
+
+// Picks are the pick / reject flag states for an image
+type Picks int
+
+const (
+	// Unflagged means the image has not been picked or rejected
+	Unflagged Picks = iota
+
+	// Picked means the image has been marked as a pick (keeper)
+	Picked
+
+	// Rejected means the image has been marked as a reject
+	Rejected
+
+	PicksN
+)
+
+//go:generate stringer -type=Picks
+
+var KiT_Picks = kit.Enums.AddEnum(PicksN, kit.NotBitFlag, nil)
+
+func (ev Picks) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *Picks) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// Labels are the color labels for an image, using the standard Lightroom
+// colors, which are stored by name in the XMP xmp:Label property
+type Labels int
+
+const (
+	// NoLabel means no color label
+	NoLabel Labels = iota
+
+	// RedLabel is the red color label
+	RedLabel
+
+	// YellowLabel is the yellow color label
+	YellowLabel
+
+	// GreenLabel is the green color label
+	GreenLabel
+
+	// BlueLabel is the blue color label
+	BlueLabel
+
+	// PurpleLabel is the purple color label
+	PurpleLabel
+
+	LabelsN
+)
+
+//go:generate stringer -type=Labels
+
+var KiT_Labels = kit.Enums.AddEnum(LabelsN, kit.NotBitFlag, nil)
+
+func (ev Labels) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *Labels) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// XMPName returns the name of the label as used in xmp:Label, e.g., Red
+func (lb Labels) XMPName() string {
+	if lb == NoLabel {
+		return ""
+	}
+	return strings.TrimSuffix(lb.String(), "Label")
+}
+
+// LabelFromXMPName returns the label for given xmp:Label name (case insensitive),
+// NoLabel if not one of the standard colors.
+func LabelFromXMPName(nm string) Labels {
+	nm = strings.TrimSpace(nm)
+	for lb := RedLabel; lb < LabelsN; lb++ {
+		if strings.EqualFold(nm, lb.XMPName()) {
+			return lb
+		}
+	}
+	return NoLabel
+}
+
+// Color returns the display color for the label
+func (lb Labels) Color() color.RGBA {
+	switch lb {
+	case RedLabel:
+		return color.RGBA{0xe0, 0x30, 0x30, 0xff}
+	case YellowLabel:
+		return color.RGBA{0xf0, 0xd0, 0x20, 0xff}
+	case GreenLabel:
+		return color.RGBA{0x30, 0xb0, 0x40, 0xff}
+	case BlueLabel:
+		return color.RGBA{0x30, 0x70, 0xe0, 0xff}
+	case PurpleLabel:
+		return color.RGBA{0x90, 0x40, 0xc0, 0xff}
+	}
+	return color.RGBA{}
+}
+
+// SetRating sets the star rating, clamped to 0..MaxRating,
+// returning true if changed
+func (pi *Info) SetRating(rating int) bool {
+	if rating < 0 {
+		rating = 0
+	}
+	if rating > MaxRating {
+		rating = MaxRating
+	}
+	if pi.Rating == rating {
+		return false
+	}
+	pi.Rating = rating
+	return true
+}
+
+// SetPick sets the pick / reject flag, returning true if changed
+func (pi *Info) SetPick(pick Picks) bool {
+	if pi.Pick == pick {
+		return false
+	}
+	pi.Pick = pick
+	return true
+}
+
+// SetLabel sets the color label, returning true if changed
+func (pi *Info) SetLabel(label Labels) bool {
+	if pi.Label == label {
+		return false
+	}
+	pi.Label = label
+	return true
+}
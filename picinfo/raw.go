@@ -0,0 +1,240 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Camera RAW files are not decoded: instead, the Jpeg preview images that
+// cameras embed in them are used for thumbnails and viewing, and metadata
+// changes are always written to the XMP sidecar file, so the RAW file is
+// never modified.  Only TIFF-based RAW formats are supported: the metadata
+// is in the first IFD and its exif sub-IFDs as in a TIFF file, and the
+// previews are found in the IFD chain and SubIFDs.
+// https://exiftool.org/TagNames/EXIF.html has the tags used by each camera.
+
+// RawExts are the file extensions of supported TIFF-based camera RAW
+// formats, with the name of the format
+var RawExts = map[string]string{
+	".3fr": "Hasselblad",
+	".arw": "Sony",
+	".cr2": "Canon",
+	".dcr": "Kodak",
+	".dng": "Adobe DNG",
+	".erf": "Epson",
+	".iiq": "Phase One",
+	".k25": "Kodak",
+	".kdc": "Kodak",
+	".mef": "Mamiya",
+	".mos": "Leaf",
+	".nef": "Nikon",
+	".nrw": "Nikon",
+	".orf": "Olympus",
+	".pef": "Pentax",
+	".rw2": "Panasonic",
+	".rwl": "Leica",
+	".sr2": "Sony",
+	".srf": "Sony",
+	".srw": "Samsung",
+}
+
+// IsRaw returns true if given file is a supported camera RAW file
+func IsRaw(fn string) bool {
+	_, has := RawExts[strings.ToLower(filepath.Ext(fn))]
+	return has
+}
+
+// tiff tags used for finding the previews
+const (
+	tiffTagCompression  = 0x0103
+	tiffTagStripOffsets = 0x0111
+	tiffTagStripCounts  = 0x0117
+	tiffTagSubIFDs      = 0x014a
+	rawTagJpgFromRaw    = 0x002e // Panasonic RW2 preview in IFD0
+)
+
+// rawSkipTags are the tags whose values are preview images, which are not
+// read with the IFD
+var rawSkipTags = map[uint16]bool{rawTagJpgFromRaw: true}
+
+// readRawTiffHeader reads the header of a TIFF-based RAW file, returning
+// a standard TIFF header for it -- Olympus and Panasonic use their own
+// magic numbers in place of the standard 42.
+func readRawTiffHeader(r io.ReaderAt, size int64) ([]byte, error) {
+	hdr, err := readAt(r, size, 0, 8)
+	if err != nil {
+		return nil, err
+	}
+	switch string(hdr[:4]) {
+	case "IIRO", "IIRS", "MMOR", "IIU\x00":
+		if hdr[0] == 'I' {
+			binary.LittleEndian.PutUint16(hdr[2:], 42)
+		} else {
+			binary.BigEndian.PutUint16(hdr[2:], 42)
+		}
+	}
+	return hdr, nil
+}
+
+// ReadRaw reads the metadata from a TIFF-based RAW file of given size into
+// RawMeta.  The size and depth are those of the largest Jpeg preview,
+// which is what is shown for the image.
+func (rm *RawMeta) ReadRaw(r io.ReaderAt, size int64) error {
+	hdr, err := readRawTiffHeader(r, size)
+	if err != nil {
+		return err
+	}
+	err = rm.readTiff(r, size, hdr, rawSkipTags)
+	if err != nil {
+		return err
+	}
+	rm.Size = image.Point{}
+	rm.Depth = 0
+	if pvs, _ := ReadRawPreviews(r, size); len(pvs) > 0 {
+		rm.Size = pvs[len(pvs)-1].Size
+		rm.Depth = 8
+	}
+	return nil
+}
+
+// RawPreview is a Jpeg preview image embedded in a RAW file
+type RawPreview struct {
+
+	// offset of the Jpeg data in the file
+	Off int64
+
+	// length of the Jpeg data
+	Len int64
+
+	// size of the preview image
+	Size image.Point
+}
+
+// ReadRawPreviews returns the Jpeg preview images embedded in a TIFF-based
+// RAW file of given size, sorted by size, smallest first.  Only the headers
+// of the previews are read, to get their sizes.
+func ReadRawPreviews(r io.ReaderAt, size int64) ([]RawPreview, error) {
+	hdr, err := readRawTiffHeader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	order, off, err := ReadTiffHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	var pvs []RawPreview
+	add := func(off, ln int64) {
+		if ln <= 0 || off <= 0 || off+ln > size {
+			return
+		}
+		for _, pv := range pvs {
+			if pv.Off == off {
+				return
+			}
+		}
+		// lossless Jpeg raw data and other non-baseline data fail here
+		cfg, err := jpeg.DecodeConfig(io.NewSectionReader(r, off, ln))
+		if err != nil {
+			return
+		}
+		pvs = append(pvs, RawPreview{Off: off, Len: ln, Size: image.Point{cfg.Width, cfg.Height}})
+	}
+	var visit func(ifd *TiffIfd, depth int)
+	visit = func(ifd *TiffIfd, depth int) {
+		oe, le := ifd.Entry(exifTagThumbOffset), ifd.Entry(exifTagThumbLength)
+		if oe != nil && le != nil {
+			add(int64(oe.Uint(order, 0)), int64(le.Uint(order, 0)))
+		}
+		if ce := ifd.Entry(tiffTagCompression); ce != nil {
+			comp := ce.Uint(order, 0)
+			so, sc := ifd.Entry(tiffTagStripOffsets), ifd.Entry(tiffTagStripCounts)
+			if (comp == 6 || comp == 7) && so != nil && sc != nil && so.Count == 1 {
+				add(int64(so.Uint(order, 0)), int64(sc.Uint(order, 0)))
+			}
+		}
+		if je := ifd.Entry(rawTagJpgFromRaw); je != nil && je.ValOff != 0 {
+			add(int64(je.ValOff), int64(je.Count))
+		}
+		se := ifd.Entry(tiffTagSubIFDs)
+		if se == nil || depth > 2 {
+			return
+		}
+		for i := 0; i < int(se.Count); i++ {
+			sub, err := readTiffIfdAt(r, size, order, se.Uint(order, i), rawSkipTags)
+			if err == nil {
+				visit(sub, depth+1)
+			}
+		}
+	}
+	for n := 0; off != 0 && n < 8; n++ { // guard against loops
+		ifd, err := readTiffIfdAt(r, size, order, off, rawSkipTags)
+		if err != nil {
+			if n == 0 {
+				return nil, err
+			}
+			break
+		}
+		visit(ifd, 0)
+		off = ifd.Next
+	}
+	for i := 1; i < len(pvs); i++ { // insertion sort by width
+		for j := i; j > 0 && pvs[j].Size.X < pvs[j-1].Size.X; j-- {
+			pvs[j], pvs[j-1] = pvs[j-1], pvs[j]
+		}
+	}
+	return pvs, nil
+}
+
+// OpenRawPreview opens the largest Jpeg preview image embedded in given
+// RAW file.  It has the same orientation as the RAW image, given by Orient.
+func OpenRawPreview(fn string) (image.Image, error) {
+	return openRawPreview(fn, func(pvs []RawPreview) *RawPreview {
+		return &pvs[len(pvs)-1]
+	})
+}
+
+// openRawPreview opens the preview image selected by given function from
+// the previews in given RAW file, which returns nil if none are suitable
+func openRawPreview(fn string, sel func(pvs []RawPreview) *RawPreview) (image.Image, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fst, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pvs, err := ReadRawPreviews(f, fst.Size())
+	if err != nil {
+		return nil, err
+	}
+	if len(pvs) == 0 {
+		return nil, errors.New("picinfo.OpenRawPreview: no Jpeg preview found in: " + fn)
+	}
+	pv := sel(pvs)
+	if pv == nil {
+		return nil, ErrNoThumb
+	}
+	data, err := readAt(f, fst.Size(), pv.Off, int(pv.Len))
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("File: %s RAW preview err: %v\n", fn, err)
+	}
+	return img, err
+}
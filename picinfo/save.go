@@ -0,0 +1,265 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"log"
+
+	"github.com/goki/ki/kit"
+	"github.com/goki/pi/filecat"
+	"golang.org/x/image/tiff"
+)
+
+// SaveOptions are the encoding options for saving images, which apply to
+// the format being saved.
+type SaveOptions struct {
+
+	// Jpeg encoding quality, from 1 to 100 -- higher values are better quality but larger files
+	JpegQuality int `min:"1" max:"100"`
+
+	// Jpeg chroma subsampling for color images: the resolution of the color relative to the brightness -- 4:2:0 is the smallest and standard for photos, and 4:4:4 keeps fine color detail, e.g., for text and graphics
+	JpegSubsampling JpegSubsamplings
+
+	// PNG compression level
+	PngCompression PngCompressions
+
+	// TIFF compression
+	TiffCompression TiffCompressions
+
+	// when saving over an existing file, keep its metadata (Exif, XMP, IPTC, ICC color profile and PNG text), for the formats that support it: Jpeg, PNG and TIFF
+	KeepMeta bool
+}
+
+// DefaultSaveOptions are the options used when nil options are passed
+var DefaultSaveOptions = SaveOptions{}
+
+func init() {
+	DefaultSaveOptions.Defaults()
+}
+
+// Defaults sets the default options
+func (so *SaveOptions) Defaults() {
+	so.JpegQuality = 90
+	so.JpegSubsampling = Jpeg420
+	so.PngCompression = PngDefaultCompression
+	so.TiffCompression = TiffDeflate
+	so.KeepMeta = false
+}
+
+// JpegSubsamplings are the chroma subsampling modes for saving Jpeg
+// color images, which code the color at a lower resolution than the
+// brightness, as the eye is less sensitive to it
+type JpegSubsamplings int
+
+const (
+	// Jpeg420 codes the color at half the resolution in both directions
+	Jpeg420 JpegSubsamplings = iota
+
+	// Jpeg422 codes the color at half the horizontal resolution
+	Jpeg422
+
+	// Jpeg444 codes the color at full resolution
+	Jpeg444
+
+	JpegSubsamplingsN
+)
+
+//go:generate stringer -type=JpegSubsamplings
+
+var KiT_JpegSubsamplings = kit.Enums.AddEnum(JpegSubsamplingsN, kit.NotBitFlag, nil)
+
+func (ev JpegSubsamplings) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *JpegSubsamplings) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// PngCompressions are the PNG compression levels
+type PngCompressions int
+
+const (
+	// PngDefaultCompression is the standard zlib compression level
+	PngDefaultCompression PngCompressions = iota
+
+	// PngNoCompression is no compression -- fastest and largest
+	PngNoCompression
+
+	// PngBestSpeed is fast compression
+	PngBestSpeed
+
+	// PngBestCompression is the smallest and slowest compression
+	PngBestCompression
+
+	PngCompressionsN
+)
+
+//go:generate stringer -type=PngCompressions
+
+var KiT_PngCompressions = kit.Enums.AddEnum(PngCompressionsN, kit.NotBitFlag, nil)
+
+func (ev PngCompressions) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *PngCompressions) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// Level returns the png package compression level
+func (pc PngCompressions) Level() png.CompressionLevel {
+	switch pc {
+	case PngNoCompression:
+		return png.NoCompression
+	case PngBestSpeed:
+		return png.BestSpeed
+	case PngBestCompression:
+		return png.BestCompression
+	}
+	return png.DefaultCompression
+}
+
+// TiffCompressions are the TIFF compression types supported for saving
+type TiffCompressions int
+
+const (
+	// TiffDeflate is lossless ZIP compression
+	TiffDeflate TiffCompressions = iota
+
+	// TiffUncompressed is no compression
+	TiffUncompressed
+
+	TiffCompressionsN
+)
+
+//go:generate stringer -type=TiffCompressions
+
+var KiT_TiffCompressions = kit.Enums.AddEnum(TiffCompressionsN, kit.NotBitFlag, nil)
+
+func (ev TiffCompressions) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *TiffCompressions) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// Options returns the tiff package encoding options
+func (tc TiffCompressions) Options() *tiff.Options {
+	if tc == TiffUncompressed {
+		return &tiff.Options{Compression: tiff.Uncompressed}
+	}
+	return &tiff.Options{Compression: tiff.Deflate}
+}
+
+// CopyMeta returns the dst file data of given type with the metadata from
+// the src file data copied into it, for the formats that support it:
+// Jpeg, PNG and TIFF -- dst is returned as is for other formats.
+func CopyMeta(typ filecat.Supported, dst, src []byte) ([]byte, error) {
+	switch typ {
+	case filecat.Jpeg:
+		return CopyJpegMeta(dst, src)
+	case filecat.Png:
+		return CopyPngMeta(dst, src)
+	case filecat.Tiff:
+		return CopyTiffMeta(dst, src)
+	}
+	return dst, nil
+}
+
+// isJpegMeta returns true if the segment holds metadata: Exif, XMP, IPTC
+// or the ICC color profile
+func isJpegMeta(sg *JpegSegment) bool {
+	return sg.Marker == jpegAPP1 || sg.Marker == jpegAPP13 || isJpegICC(sg)
+}
+
+// CopyJpegMeta returns dst Jpeg data with the metadata segments of the src
+// Jpeg data inserted after its start, replacing any it already has.
+func CopyJpegMeta(dst, src []byte) ([]byte, error) {
+	ssegs, err := ParseJpegSegments(src)
+	if err != nil {
+		return dst, err
+	}
+	dsegs, err := ParseJpegSegments(dst)
+	if err != nil {
+		return dst, err
+	}
+	var b bytes.Buffer
+	b.Write(dst[:2]) // SOI
+	pos := 2
+	for i := range dsegs { // keep leading APP0 (JFIF) first, and skip existing meta
+		sg := &dsegs[i]
+		if sg.Marker != 0xe0 && !isJpegMeta(sg) {
+			break
+		}
+		if sg.Marker == 0xe0 {
+			writeJpegSegment(&b, sg)
+		}
+		pos += 4 + len(sg.Data)
+	}
+	for i := range ssegs {
+		if isJpegMeta(&ssegs[i]) {
+			writeJpegSegment(&b, &ssegs[i])
+		}
+	}
+	b.Write(dst[pos:])
+	return b.Bytes(), nil
+}
+
+// writeJpegSegment writes the marker, length and data of given segment
+func writeJpegSegment(b *bytes.Buffer, sg *JpegSegment) {
+	var hdr [4]byte
+	hdr[0] = 0xff
+	hdr[1] = sg.Marker
+	binary.BigEndian.PutUint16(hdr[2:], uint16(len(sg.Data)+2))
+	b.Write(hdr[:])
+	b.Write(sg.Data)
+}
+
+// pngMetaChunks are the types of PNG chunks that hold metadata, including
+// the color space chunks, which must come before the image data
+var pngMetaChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true,
+	"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true}
+
+// CopyPngMeta returns dst PNG data with the metadata chunks of the src
+// PNG data inserted after its header, replacing any it already has.
+func CopyPngMeta(dst, src []byte) ([]byte, error) {
+	schunks, err := ParsePngChunks(src)
+	if err != nil {
+		return dst, err
+	}
+	dchunks, err := ParsePngChunks(dst)
+	if err != nil || len(dchunks) == 0 {
+		return dst, err
+	}
+	chunks := []PngChunk{dchunks[0]} // IHDR
+	for _, ch := range schunks {
+		if pngMetaChunks[ch.Type] {
+			chunks = append(chunks, ch)
+		}
+	}
+	for _, ch := range dchunks[1:] {
+		if !pngMetaChunks[ch.Type] {
+			chunks = append(chunks, ch)
+		}
+	}
+	var b bytes.Buffer
+	err = WritePngChunks(&b, chunks)
+	if err != nil {
+		return dst, err
+	}
+	return b.Bytes(), nil
+}
+
+// SaveUpdatedImage saves given image to the file, keeping the metadata of
+// the existing file, and then updating the metadata to the current info,
+// in the file for Jpeg, PNG and TIFF, and in the XMP sidecar for other
+// formats.  The image should already be oriented per the current info.
+// Uses DefaultSaveOptions if opts is nil.
+func (pi *Info) SaveUpdatedImage(img image.Image, opts *SaveOptions) error {
+	so := DefaultSaveOptions
+	if opts != nil {
+		so = *opts
+	}
+	so.KeepMeta = true
+	err := SaveImage(pi.File, img, &so)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	pi.Size = img.Bounds().Size()
+	pi.UpdateFileMod()
+	return pi.SaveMeta()
+}
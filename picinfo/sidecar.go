@@ -0,0 +1,117 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goki/pi/filecat"
+)
+
+// SidecarExt is the extension for XMP sidecar files, which live next to
+// the original image file, with the same base name.
+const SidecarExt = ".xmp"
+
+// SidecarFile returns the XMP sidecar file name for given image file
+func SidecarFile(fn string) string {
+	return strings.TrimSuffix(fn, filepath.Ext(fn)) + SidecarExt
+}
+
+// IsSidecar returns true if given file is an XMP sidecar file
+func IsSidecar(fn string) bool {
+	return strings.ToLower(filepath.Ext(fn)) == SidecarExt
+}
+
+// HasSidecar returns true if given image file has an XMP sidecar file
+func HasSidecar(fn string) bool {
+	_, err := os.Stat(SidecarFile(fn))
+	return err == nil
+}
+
+// OpenSidecar opens the XMP sidecar file for given image file
+func OpenSidecar(fn string) (*XMP, error) {
+	data, err := OpenBytes(SidecarFile(fn))
+	if err != nil {
+		return nil, err
+	}
+	return ParseXMP(data)
+}
+
+// SaveSidecar saves the current Info metadata to the XMP sidecar file,
+// retaining any other existing properties in that file.
+func (pi *Info) SaveSidecar() error {
+	sfn := SidecarFile(pi.File)
+	x, err := OpenSidecar(pi.File)
+	exists := err == nil
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("File: %s sidecar err: %v -- replacing\n", sfn, err)
+		}
+		x = NewXMP()
+	}
+	updts := pi.UpdateXMP(x)
+	if !pi.HasGPS() && pi.embeddedGPS() {
+		if x.Set(XMPGPSCleared, "True") {
+			updts = append(updts, "GPSLoc")
+		}
+	}
+	if exists && len(updts) == 0 {
+		return nil
+	}
+	fmt.Printf("File: %s updating sidecar: %v\n", pi.File, updts)
+	err = os.WriteFile(sfn, x.Bytes(), 0664)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+// embeddedGPS returns true if the original file has GPS info embedded in
+// its metadata, which is overridden by the sidecar file
+func (pi *Info) embeddedGPS() bool {
+	rm, err := OpenRawMeta(pi.File)
+	if rm == nil {
+		if err != nil {
+			log.Println(err)
+		}
+		return false
+	}
+	epi := &Info{File: pi.File}
+	epi.SetFromRawMeta(rm)
+	return epi.HasGPS()
+}
+
+// SaveMeta saves the current Info metadata for the file without ever
+// re-encoding the image data.  Jpeg, Png and Tiff files are updated in place, and
+// other formats, including camera RAW files, use the XMP sidecar file.
+// An existing sidecar file is always kept up-to-date, as it takes precedence
+// over embedded metadata.
+func (pi *Info) SaveMeta() error {
+	var err error
+	side := HasSidecar(pi.File)
+	switch {
+	case IsRaw(pi.File): // never modified
+		side = true
+	case pi.Sup == filecat.Jpeg:
+		err = pi.SaveJpegUpdated()
+	case pi.Sup == filecat.Png:
+		err = pi.SavePngUpdated()
+	case pi.Sup == filecat.Tiff:
+		err = pi.SaveTiffUpdated()
+	default:
+		side = true
+	}
+	if side {
+		serr := pi.SaveSidecar()
+		if err == nil {
+			err = serr
+		}
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"github.com/adrium/goheif"
+	"github.com/goki/pi/filecat"
+)
+
+// Many image files have a small embedded thumbnail image, which is much
+// faster to decode than the full image: Jpeg and other exif files have a
+// Jpeg thumbnail in IFD1 of the exif, HEIC files have a thumbnail item, and
+// camera RAW files have several Jpeg previews of different sizes.
+// These are stored in the same orientation as the full image.
+
+// ErrNoThumb is returned when there is no suitable embedded thumbnail
+var ErrNoThumb = errors.New("picinfo: no suitable embedded thumbnail")
+
+// exif IFD1 thumbnail tag ids
+const (
+	exifTagThumbOffset = 0x0201 // JPEGInterchangeFormat
+	exifTagThumbLength = 0x0202 // JPEGInterchangeFormatLength
+)
+
+// ExifThumbData returns the Jpeg thumbnail image data stored in IFD1 of
+// given raw exif data (starting with the TIFF header).
+func ExifThumbData(rawExif []byte) ([]byte, error) {
+	order, off, err := ReadTiffHeader(rawExif)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, err := ReadTiffIfd(rawExif, order, off)
+	if err != nil {
+		return nil, err
+	}
+	if ifd0.Next == 0 {
+		return nil, ErrNoThumb
+	}
+	ifd1, err := ReadTiffIfd(rawExif, order, ifd0.Next)
+	if err != nil {
+		return nil, err
+	}
+	oe, le := ifd1.Entry(exifTagThumbOffset), ifd1.Entry(exifTagThumbLength)
+	if oe == nil || le == nil {
+		return nil, ErrNoThumb
+	}
+	toff, tlen := uint64(oe.Uint(order, 0)), uint64(le.Uint(order, 0))
+	if tlen == 0 || toff+tlen > uint64(len(rawExif)) {
+		return nil, fmt.Errorf("picinfo.ExifThumbData: thumbnail out of range")
+	}
+	return rawExif[toff : toff+tlen], nil
+}
+
+// HeicThumbData returns a copy of given HEIC file data with the primary
+// item set to the thumbnail item, so that it decodes as the thumbnail
+// image, and the size of the thumbnail.
+func HeicThumbData(data []byte) ([]byte, image.Point, error) {
+	hm, err := ParseHeifMeta(data)
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	th := hm.ThumbItem()
+	if th == nil {
+		return nil, image.Point{}, ErrNoThumb
+	}
+	nd := append([]byte(nil), data...)
+	boxes, _ := ParseHeifBoxes(nd)
+	mb := HeifBoxByType(boxes, "meta")
+	if mb == nil || len(mb.Data) < 4 {
+		return nil, image.Point{}, errors.New("picinfo.HeicThumbData: no meta box found")
+	}
+	mboxes, _ := ParseHeifBoxes(mb.Data[4:])
+	pb := HeifBoxByType(mboxes, "pitm")
+	if pb == nil || len(pb.Data) < 6 {
+		return nil, image.Point{}, errors.New("picinfo.HeicThumbData: no pitm box found")
+	}
+	// the box data is a slice of nd, so the item id is set in place
+	switch {
+	case pb.Data[0] == 0 && th.ID <= 0xffff:
+		binary.BigEndian.PutUint16(pb.Data[4:], uint16(th.ID))
+	case pb.Data[0] != 0 && len(pb.Data) >= 8:
+		binary.BigEndian.PutUint32(pb.Data[4:], th.ID)
+	default:
+		return nil, image.Point{}, ErrNoThumb
+	}
+	return nd, hm.ItemSize(th), nil
+}
+
+// OpenThumb returns the embedded thumbnail image for this file, if it has
+// one that is at least minSize in its largest dimension, and has the same
+// aspect ratio as the full image (otherwise it is padded or cropped).
+// Returns ErrNoThumb if there is no suitable thumbnail, in which case
+// the full image must be used.  The thumbnail has the same orientation as
+// the full image, given by Orient.
+func (pi *Info) OpenThumb(minSize int) (image.Image, error) {
+	if IsRaw(pi.File) {
+		return openRawPreview(pi.File, func(pvs []RawPreview) *RawPreview {
+			for i := range pvs { // smallest first
+				if pi.thumbSizeOK(pvs[i].Size, minSize) {
+					return &pvs[i]
+				}
+			}
+			return nil
+		})
+	}
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		return nil, err
+	}
+	var img image.Image
+	switch pi.Sup {
+	case filecat.Heic:
+		td, sz, err := HeicThumbData(data)
+		if err != nil {
+			return nil, err
+		}
+		if !pi.thumbSizeOK(sz, minSize) {
+			return nil, ErrNoThumb
+		}
+		img, err = goheif.Decode(bytes.NewReader(td))
+		if err != nil {
+			return nil, err
+		}
+	case filecat.Jpeg, filecat.Tiff:
+		rawExif := data
+		if pi.Sup == filecat.Jpeg {
+			rm := &RawMeta{}
+			rm.ParseJpeg(data)
+			if rm.Exif == nil {
+				return nil, ErrNoThumb
+			}
+			rawExif = rm.Exif
+		}
+		td, err := ExifThumbData(rawExif)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(td))
+		if err != nil {
+			return nil, err
+		}
+		if !pi.thumbSizeOK(image.Point{cfg.Width, cfg.Height}, minSize) {
+			return nil, ErrNoThumb
+		}
+		img, err = jpeg.Decode(bytes.NewReader(td))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNoThumb
+	}
+	return img, nil
+}
+
+// thumbSizeOK returns true if the thumbnail size is at least minSize in
+// its largest dimension, and within 2% of the aspect ratio of the image
+func (pi *Info) thumbSizeOK(sz image.Point, minSize int) bool {
+	if sz.X < minSize && sz.Y < minSize {
+		return false
+	}
+	if pi.Size.X == 0 || pi.Size.Y == 0 || sz.Y == 0 {
+		return false // can't check aspect
+	}
+	ar := float64(sz.X) / float64(sz.Y)
+	iar := float64(pi.Size.X) / float64(pi.Size.Y)
+	d := ar/iar - 1
+	return d > -0.02 && d < 0.02
+}
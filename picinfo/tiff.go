@@ -0,0 +1,795 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// reference for the TIFF format:
+// https://www.itu.int/itudoc/itu-t/com16/tiff-fx/docs/tiff6.pdf
+// Metadata is updated by writing new versions of the changed IFDs in
+// place, if they fit, or appending them to the end of the file, and
+// re-pointing to them, so the image data is never moved.  The IFDs and
+// values at the end of the file from a previous update are replaced,
+// so the file does not keep growing.
+
+// standard TIFF / exif tag ids used directly
+const (
+	tiffTagImageWidth       = 0x0100
+	tiffTagImageLength      = 0x0101
+	tiffTagBitsPerSample    = 0x0102
+	tiffTagImageDescription = 0x010e
+	tiffTagOrientation      = 0x0112
+	tiffTagDateTime         = 0x0132
+	tiffTagXMP              = 0x02bc
+	tiffTagICC              = 0x8773
+	tiffTagExifIFD          = 0x8769
+	tiffTagGPSIFD           = 0x8825
+	tiffTagInteropIFD       = 0xa005
+	tiffTagDateTimeOriginal = 0x9003
+	tiffTagOffsetTimeOrig   = 0x9011
+	tiffTagImageNumber      = 0x9211
+	tiffTagMakerNote        = 0x927c
+)
+
+// exif GPS tag ids used directly
+const (
+	gpsTagVersionID    = 0x0000
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	gpsTagAltitudeRef  = 0x0005
+	gpsTagAltitude     = 0x0006
+)
+
+// gpsVersion is the GPSVersionID written with new GPS info
+var gpsVersion = []byte{2, 3, 0, 0}
+
+// TIFF field types
+const (
+	tiffByte      = 1
+	tiffASCII     = 2
+	tiffShort     = 3
+	tiffLong      = 4
+	tiffRational  = 5
+	tiffSByte     = 6
+	tiffUndefined = 7
+	tiffSShort    = 8
+	tiffSLong     = 9
+	tiffSRational = 10
+	tiffFloat     = 11
+	tiffDouble    = 12
+	tiffIFD       = 13
+)
+
+// tiffTypeSize returns the size in bytes of one value of given TIFF type,
+// and the size of each byte-order-dependent component of it.
+func tiffTypeSize(typ uint16) (size, comp int) {
+	switch typ {
+	case tiffShort, tiffSShort:
+		return 2, 2
+	case tiffLong, tiffSLong, tiffFloat, tiffIFD:
+		return 4, 4
+	case tiffRational, tiffSRational:
+		return 8, 4
+	case tiffDouble:
+		return 8, 8
+	}
+	return 1, 1
+}
+
+// TiffEntry is one tag entry in a TIFF IFD
+type TiffEntry struct {
+
+	// tag id
+	Tag uint16
+
+	// field type
+	Type uint16
+
+	// number of values
+	Count uint32
+
+	// raw value bytes, in the byte order of the file -- nil if an
+	// out-of-line value was not read, e.g., because it is out of range,
+	// in which case it is kept at its original ValOff when writing
+	Data []byte
+
+	// original offset of the value data if stored out-of-line, which is
+	// retained when writing as long as this is non-zero -- set to 0 for
+	// new or modified values
+	ValOff uint32
+}
+
+// TiffIfd is one TIFF IFD (image file directory)
+type TiffIfd struct {
+
+	// tag entries, in ascending tag order
+	Entries []TiffEntry
+
+	// offset of next IFD in chain, 0 if none
+	Next uint32
+}
+
+// ReadTiffHeader reads the TIFF header from start of data, returning
+// the byte order and offset of the first IFD.
+func ReadTiffHeader(data []byte) (binary.ByteOrder, uint32, error) {
+	if len(data) < 8 {
+		return nil, 0, errors.New("picinfo.ReadTiffHeader: data too short")
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("picinfo.ReadTiffHeader: not a TIFF header")
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, 0, errors.New("picinfo.ReadTiffHeader: not a TIFF header")
+	}
+	return order, order.Uint32(data[4:]), nil
+}
+
+// ReadTiffIfd reads the IFD at given offset in TIFF data
+func ReadTiffIfd(data []byte, order binary.ByteOrder, off uint32) (*TiffIfd, error) {
+	return ReadTiffIfdAt(bytes.NewReader(data), int64(len(data)), order, off)
+}
+
+// ReadTiffIfdAt reads the IFD at given offset in TIFF data of given size,
+// reading only the IFD and its values
+func ReadTiffIfdAt(r io.ReaderAt, size int64, order binary.ByteOrder, off uint32) (*TiffIfd, error) {
+	return readTiffIfdAt(r, size, order, off, nil)
+}
+
+// readTiffIfdAt reads the IFD at given offset, without reading the values
+// of the skip tags, which have nil Data (and must not be copied), as do
+// values that are out of range of the data
+func readTiffIfdAt(r io.ReaderAt, size int64, order binary.ByteOrder, off uint32, skip map[uint16]bool) (*TiffIfd, error) {
+	nb, err := readAt(r, size, int64(off), 2)
+	if err != nil {
+		return nil, fmt.Errorf("picinfo.ReadTiffIfd: offset %d out of range", off)
+	}
+	n := int(order.Uint16(nb))
+	ifdb, err := readAt(r, size, int64(off)+2, n*12+4)
+	if err != nil {
+		return nil, fmt.Errorf("picinfo.ReadTiffIfd: IFD at %d truncated", off)
+	}
+	ifd := &TiffIfd{Entries: make([]TiffEntry, 0, n)}
+	for i := 0; i < n; i++ {
+		eb := ifdb[i*12:]
+		e := TiffEntry{}
+		e.Tag = order.Uint16(eb)
+		e.Type = order.Uint16(eb[2:])
+		e.Count = order.Uint32(eb[4:])
+		sz, _ := tiffTypeSize(e.Type)
+		ln := int64(sz) * int64(e.Count)
+		if ln <= 4 {
+			e.Data = append([]byte{}, eb[8:8+ln]...)
+		} else {
+			e.ValOff = order.Uint32(eb[8:])
+			if skip[e.Tag] {
+				ifd.Entries = append(ifd.Entries, e)
+				continue
+			}
+			e.Data, err = readAt(r, size, int64(e.ValOff), int(ln))
+			if err != nil {
+				log.Printf("picinfo.ReadTiffIfd: tag 0x%04x value out of range -- keeping as is\n", e.Tag)
+				e.Data = nil
+			}
+		}
+		ifd.Entries = append(ifd.Entries, e)
+	}
+	ifd.Next = order.Uint32(ifdb[n*12:])
+	return ifd, nil
+}
+
+// Entry returns the entry for given tag, nil if not present
+func (ifd *TiffIfd) Entry(tag uint16) *TiffEntry {
+	for i := range ifd.Entries {
+		if ifd.Entries[i].Tag == tag {
+			return &ifd.Entries[i]
+		}
+	}
+	return nil
+}
+
+// Set sets given entry, replacing any existing entry with the same tag
+func (ifd *TiffIfd) Set(e TiffEntry) {
+	if ce := ifd.Entry(e.Tag); ce != nil {
+		*ce = e
+		return
+	}
+	ifd.Entries = append(ifd.Entries, e)
+	sort.Slice(ifd.Entries, func(i, j int) bool {
+		return ifd.Entries[i].Tag < ifd.Entries[j].Tag
+	})
+}
+
+// Delete deletes the entry for given tag, returning true if it existed
+func (ifd *TiffIfd) Delete(tag uint16) bool {
+	for i := range ifd.Entries {
+		if ifd.Entries[i].Tag == tag {
+			ifd.Entries = append(ifd.Entries[:i], ifd.Entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Uint returns the i'th value of an integer entry
+func (e *TiffEntry) Uint(order binary.ByteOrder, i int) uint32 {
+	sz, _ := tiffTypeSize(e.Type)
+	if (i+1)*sz > len(e.Data) {
+		return 0
+	}
+	switch sz {
+	case 1:
+		return uint32(e.Data[i])
+	case 2:
+		return uint32(order.Uint16(e.Data[i*2:]))
+	}
+	return order.Uint32(e.Data[i*sz:])
+}
+
+// String returns the value of an ASCII entry
+func (e *TiffEntry) String() string {
+	return string(bytes.TrimRight(e.Data, "\x00"))
+}
+
+// ConvertOrder returns a copy of the entry with data converted from
+// the from byte order to the to byte order
+func (e *TiffEntry) ConvertOrder(from, to binary.ByteOrder) TiffEntry {
+	ne := *e
+	ne.ValOff = 0
+	ne.Data = append([]byte{}, e.Data...)
+	if from == to {
+		return ne
+	}
+	_, comp := tiffTypeSize(e.Type)
+	if comp == 1 {
+		return ne
+	}
+	for i := 0; i+comp <= len(ne.Data); i += comp {
+		c := ne.Data[i : i+comp]
+		for l, r := 0, comp-1; l < r; l, r = l+1, r-1 {
+			c[l], c[r] = c[r], c[l]
+		}
+	}
+	return ne
+}
+
+// NewTiffASCII returns a new ASCII entry for given tag and string
+func NewTiffASCII(tag uint16, s string) TiffEntry {
+	d := append([]byte(s), 0)
+	return TiffEntry{Tag: tag, Type: tiffASCII, Count: uint32(len(d)), Data: d}
+}
+
+// NewTiffShort returns a new SHORT entry for given tag and values
+func NewTiffShort(order binary.ByteOrder, tag uint16, vals ...uint16) TiffEntry {
+	d := make([]byte, 2*len(vals))
+	for i, v := range vals {
+		order.PutUint16(d[i*2:], v)
+	}
+	return TiffEntry{Tag: tag, Type: tiffShort, Count: uint32(len(vals)), Data: d}
+}
+
+// NewTiffLong returns a new LONG entry for given tag and values
+func NewTiffLong(order binary.ByteOrder, tag uint16, vals ...uint32) TiffEntry {
+	d := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		order.PutUint32(d[i*4:], v)
+	}
+	return TiffEntry{Tag: tag, Type: tiffLong, Count: uint32(len(vals)), Data: d}
+}
+
+// NewTiffRational returns a new RATIONAL entry for given tag and
+// (numerator, denominator) values
+func NewTiffRational(order binary.ByteOrder, tag uint16, vals ...[2]uint32) TiffEntry {
+	d := make([]byte, 8*len(vals))
+	for i, v := range vals {
+		order.PutUint32(d[i*8:], v[0])
+		order.PutUint32(d[i*8+4:], v[1])
+	}
+	return TiffEntry{Tag: tag, Type: tiffRational, Count: uint32(len(vals)), Data: d}
+}
+
+// NewTiffBytes returns a new entry of given byte type (BYTE or UNDEFINED)
+func NewTiffBytes(tag, typ uint16, data []byte) TiffEntry {
+	return TiffEntry{Tag: tag, Type: typ, Count: uint32(len(data)), Data: append([]byte{}, data...)}
+}
+
+// AppendTiffIfd appends given IFD to the end of TIFF data (word aligned),
+// with any new out-of-line values following it.
+// Returns the new data and the offset of the IFD.
+func AppendTiffIfd(data []byte, order binary.ByteOrder, ifd *TiffIfd) ([]byte, uint32) {
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+	off := uint32(len(data))
+	ifdb, vals := tiffIfdBytes(order, ifd, off+tiffIfdSize(len(ifd.Entries)))
+	data = append(data, ifdb...)
+	data = append(data, vals...)
+	return data, off
+}
+
+// PutTiffIfd writes given IFD into the TIFF data in place of the IFD at
+// given offset, if it has no more entries than that one, with any new
+// out-of-line values appended (word aligned), and otherwise appends it
+// (see AppendTiffIfd).  The data is modified in place.
+// Returns the new data and the offset of the IFD.
+func PutTiffIfd(data []byte, order binary.ByteOrder, ifd *TiffIfd, off uint32) ([]byte, uint32) {
+	if off == 0 || uint64(off)+2 > uint64(len(data)) {
+		return AppendTiffIfd(data, order, ifd)
+	}
+	on := int(order.Uint16(data[off:]))
+	if len(ifd.Entries) > on || uint64(off)+uint64(tiffIfdSize(on)) > uint64(len(data)) {
+		return AppendTiffIfd(data, order, ifd)
+	}
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+	ifdb, vals := tiffIfdBytes(order, ifd, uint32(len(data)))
+	old := data[off : off+tiffIfdSize(on)]
+	copy(old, ifdb)
+	for i := len(ifdb); i < len(old); i++ {
+		old[i] = 0
+	}
+	data = append(data, vals...)
+	return data, off
+}
+
+// tiffIfdSize returns the size of an IFD with given number of entries
+func tiffIfdSize(n int) uint32 {
+	return 2 + uint32(n)*12 + 4
+}
+
+// tiffIfdBytes returns the encoded IFD, and its new out-of-line values,
+// which are to be written at given offset
+func tiffIfdBytes(order binary.ByteOrder, ifd *TiffIfd, voff uint32) ([]byte, []byte) {
+	n := len(ifd.Entries)
+	var vals []byte
+	ifdb := make([]byte, tiffIfdSize(n))
+	order.PutUint16(ifdb, uint16(n))
+	for i := range ifd.Entries {
+		e := &ifd.Entries[i]
+		eb := ifdb[2+i*12:]
+		order.PutUint16(eb, e.Tag)
+		order.PutUint16(eb[2:], e.Type)
+		order.PutUint32(eb[4:], e.Count)
+		switch {
+		case e.ValOff != 0:
+			order.PutUint32(eb[8:], e.ValOff)
+		case len(e.Data) <= 4:
+			copy(eb[8:12], e.Data)
+		default:
+			order.PutUint32(eb[8:], voff+uint32(len(vals)))
+			vals = append(vals, e.Data...)
+			if len(vals)%2 != 0 {
+				vals = append(vals, 0)
+			}
+		}
+	}
+	order.PutUint32(ifdb[2+n*12:], ifd.Next)
+	return ifdb, vals
+}
+
+// tiffFixedTags are the tags whose values are never moved when rewriting
+// an IFD: the MakerNote can have offsets relative to the start of the file
+var tiffFixedTags = map[uint16]bool{
+	tiffTagMakerNote: true,
+}
+
+// tiffIfdRegions returns the ranges of the TIFF data used by given IFD,
+// as read from given offset: the IFD itself, and its out-of-line values
+// that can be moved
+func tiffIfdRegions(ifd *TiffIfd, off uint32) [][2]uint32 {
+	if off == 0 {
+		return nil
+	}
+	regs := [][2]uint32{{off, off + tiffIfdSize(len(ifd.Entries))}}
+	for _, e := range ifd.Entries {
+		if e.ValOff != 0 && e.Data != nil && !tiffFixedTags[e.Tag] {
+			regs = append(regs, [2]uint32{e.ValOff, e.ValOff + uint32(len(e.Data))})
+		}
+	}
+	return regs
+}
+
+// trimTiffRegions returns the TIFF data without any of given regions
+// that are at the end of it, one after the other, allowing for the word
+// alignment padding after each
+func trimTiffRegions(data []byte, regs [][2]uint32) []byte {
+	end := uint32(len(data))
+	for trim := true; trim; {
+		trim = false
+		for _, r := range regs {
+			if r[0] >= 8 && r[0] < end && (r[1] == end || r[1]+1 == end) {
+				end = r[0]
+				trim = true
+			}
+		}
+	}
+	return data[:end]
+}
+
+// unsetTiffValOffs resets the original value offset of the entries that
+// are at or beyond given end of the data, which has been trimmed, so
+// their values are written again.  Returns true if any were reset.
+func unsetTiffValOffs(ifd *TiffIfd, end uint32) bool {
+	reset := false
+	for i := range ifd.Entries {
+		e := &ifd.Entries[i]
+		if e.ValOff >= end && e.Data != nil {
+			e.ValOff = 0
+			reset = true
+		}
+	}
+	return reset
+}
+
+// ParseTiff parses the metadata from TIFF file data into RawMeta.
+// The entire TIFF structure serves as the raw exif data.
+func (rm *RawMeta) ParseTiff(data []byte) error {
+	order, off, err := ReadTiffHeader(data)
+	if err != nil {
+		return err
+	}
+	ifd0, err := ReadTiffIfd(data, order, off)
+	if err != nil {
+		return err
+	}
+	rm.Exif = data
+	rm.setFromTiffIfd(order, ifd0)
+	return nil
+}
+
+// ReadTiff reads the metadata from a TIFF file of given size into RawMeta,
+// reading only the first IFD and its metadata sub-IFDs, which are
+// copied into a compact TIFF structure that serves as the raw exif data.
+func (rm *RawMeta) ReadTiff(r io.ReaderAt, size int64) error {
+	hdr, err := readAt(r, size, 0, 8)
+	if err != nil {
+		return err
+	}
+	return rm.readTiff(r, size, hdr, nil)
+}
+
+// readTiff reads the metadata from a TIFF file with given header,
+// without reading the values of the skip tags in the first IFD
+func (rm *RawMeta) readTiff(r io.ReaderAt, size int64, hdr []byte, skip map[uint16]bool) error {
+	order, off, err := ReadTiffHeader(hdr)
+	if err != nil {
+		return err
+	}
+	ifd0, err := readTiffIfdAt(r, size, order, off, skip)
+	if err != nil {
+		return err
+	}
+	meta := &TiffIfd{}
+	for _, e := range ifd0.Entries {
+		if !tiffDataTags[e.Tag] && !skip[e.Tag] {
+			meta.Entries = append(meta.Entries, e)
+		}
+	}
+	data, meta := copyTiffIfd(r, size, order, meta, hdr, order)
+	data, off = AppendTiffIfd(data, order, meta)
+	order.PutUint32(data[4:], off)
+	rm.Exif = data
+	rm.setFromTiffIfd(order, ifd0)
+	return nil
+}
+
+// setFromTiffIfd sets the size, depth, XMP and ICC profile from the first IFD
+func (rm *RawMeta) setFromTiffIfd(order binary.ByteOrder, ifd0 *TiffIfd) {
+	if e := ifd0.Entry(tiffTagImageWidth); e != nil {
+		rm.Size.X = int(e.Uint(order, 0))
+	}
+	if e := ifd0.Entry(tiffTagImageLength); e != nil {
+		rm.Size.Y = int(e.Uint(order, 0))
+	}
+	if e := ifd0.Entry(tiffTagBitsPerSample); e != nil {
+		rm.Depth = int(e.Uint(order, 0))
+	}
+	if e := ifd0.Entry(tiffTagXMP); e != nil {
+		rm.XMP = e.Data
+	}
+	if e := ifd0.Entry(tiffTagICC); e != nil {
+		rm.ICC = e.Data
+	}
+}
+
+// tiffSubIfd returns the sub-IFD pointed to by given pointer tag in ifd,
+// and its offset, or a new empty one and 0 if not present.
+func tiffSubIfd(data []byte, order binary.ByteOrder, ifd *TiffIfd, tag uint16) (*TiffIfd, uint32) {
+	if e := ifd.Entry(tag); e != nil {
+		off := e.Uint(order, 0)
+		sub, err := ReadTiffIfd(data, order, off)
+		if err == nil {
+			return sub, off
+		}
+		log.Println(err)
+	}
+	return &TiffIfd{}, 0
+}
+
+// UpdateTiff updates the TIFF data with the current info, returning the
+// updated data and the list of fields that were changed -- if none, the
+// data is returned unchanged.  Changed IFDs are written in place if they
+// fit, and otherwise appended to the data, replacing any IFDs and values
+// at the end of the data from a previous update.
+func (pi *Info) UpdateTiff(data []byte) ([]byte, []string, error) {
+	order, off, err := ReadTiffHeader(data)
+	if err != nil {
+		return data, nil, err
+	}
+	ifd0, err := ReadTiffIfd(data, order, off)
+	if err != nil {
+		return data, nil, err
+	}
+	exifd, exoff := tiffSubIfd(data, order, ifd0, tiffTagExifIFD)
+	gpsd, gpsoff := tiffSubIfd(data, order, ifd0, tiffTagGPSIFD)
+	regs := tiffIfdRegions(ifd0, off)
+	regs = append(regs, tiffIfdRegions(exifd, exoff)...)
+	regs = append(regs, tiffIfdRegions(gpsd, gpsoff)...)
+
+	ci := &Info{File: pi.File}
+	ci.ParseRawExif(data)
+
+	var updts []string
+	exUpdt := false
+	if !pi.DateTaken.IsZero() && (!ci.DateTaken.Equal(pi.DateTaken) || pi.zoneDiffers(ci)) {
+		exifd.Set(NewTiffASCII(tiffTagDateTimeOriginal, ExifDateString(pi.DateTaken)))
+		updts = append(updts, "DateTaken")
+		if pi.HasZone() {
+			exifd.Set(NewTiffASCII(tiffTagOffsetTimeOrig, pi.DateTaken.Format(ExifOffsetFmt)))
+			updts = append(updts, "ZoneSrc")
+		}
+		exUpdt = true
+	}
+	if ci.Number != pi.Number {
+		ifd0.Set(NewTiffLong(order, tiffTagImageNumber, uint32(pi.Number)))
+		if exifd.Delete(tiffTagImageNumber) { // not defined in the Exif IFD
+			exUpdt = true
+		}
+		updts = append(updts, "Number")
+	}
+	gpsUpdt := false
+	if pi.HasGPS() && !ci.GPSLoc.Near(pi.GPSLoc) {
+		if gpsd.Entry(gpsTagVersionID) == nil {
+			gpsd.Set(NewTiffBytes(gpsTagVersionID, tiffByte, gpsVersion))
+		}
+		gpsd.Set(NewTiffASCII(gpsTagLatitudeRef, GPSRef(pi.GPSLoc.Lat, "N", "S")))
+		gpsd.Set(NewTiffRational(order, gpsTagLatitude, GPSDMSRationals(pi.GPSLoc.Lat)...))
+		gpsd.Set(NewTiffASCII(gpsTagLongitudeRef, GPSRef(pi.GPSLoc.Long, "E", "W")))
+		gpsd.Set(NewTiffRational(order, gpsTagLongitude, GPSDMSRationals(pi.GPSLoc.Long)...))
+		ar := byte(0)
+		if pi.GPSLoc.Alt < 0 {
+			ar = 1
+		}
+		gpsd.Set(NewTiffBytes(gpsTagAltitudeRef, tiffByte, []byte{ar}))
+		gpsd.Set(NewTiffRational(order, gpsTagAltitude, [2]uint32{uint32(math.Round(math.Abs(pi.GPSLoc.Alt) * 1000)), 1000}))
+		updts = append(updts, "GPSLoc")
+		gpsUpdt = true
+	}
+	if !pi.HasGPS() && ci.HasGPS() {
+		ifd0.Delete(tiffTagGPSIFD)
+		updts = append(updts, "GPSLoc")
+	}
+	if pi.Orient != NoOrient && ci.Orient != pi.Orient {
+		ifd0.Set(NewTiffShort(order, tiffTagOrientation, uint16(pi.Orient)))
+		updts = append(updts, "Orient")
+	}
+	if ci.Desc != pi.Desc {
+		if pi.Desc == "" {
+			ifd0.Delete(tiffTagImageDescription)
+		} else {
+			ifd0.Set(NewTiffASCII(tiffTagImageDescription, pi.Desc))
+		}
+		updts = append(updts, "Desc")
+	}
+
+	x := NewXMP()
+	if e := ifd0.Entry(tiffTagXMP); e != nil {
+		if px, perr := ParseXMP(e.Data); perr == nil {
+			x = px
+		}
+	}
+	xupdts := pi.UpdateXMP(x)
+	if len(xupdts) > 0 || ifd0.Entry(tiffTagXMP) == nil {
+		ifd0.Set(NewTiffBytes(tiffTagXMP, tiffByte, x.Bytes()))
+	}
+	if len(updts) == 0 && len(xupdts) == 0 {
+		return data, nil, nil
+	}
+	updts = append(updts, xupdts...)
+
+	pi.DateMod = time.Now()
+	ifd0.Set(NewTiffASCII(tiffTagDateTime, ExifDateString(pi.DateMod)))
+
+	// the metadata at the end, e.g., from a previous update, is rewritten
+	ndata := trimTiffRegions(append([]byte{}, data...), regs)
+	end := uint32(len(ndata))
+	inPlace := func(off uint32) uint32 {
+		if off >= end {
+			return 0
+		}
+		return off
+	}
+	if unsetTiffValOffs(exifd, end) || exoff >= end {
+		exUpdt = true
+	}
+	if exUpdt {
+		ndata, exoff = PutTiffIfd(ndata, order, exifd, inPlace(exoff))
+		ifd0.Set(NewTiffLong(order, tiffTagExifIFD, exoff))
+	}
+	if (unsetTiffValOffs(gpsd, end) || gpsoff >= end) && ifd0.Entry(tiffTagGPSIFD) != nil {
+		gpsUpdt = true
+	}
+	if gpsUpdt {
+		ndata, gpsoff = PutTiffIfd(ndata, order, gpsd, inPlace(gpsoff))
+		ifd0.Set(NewTiffLong(order, tiffTagGPSIFD, gpsoff))
+	}
+	unsetTiffValOffs(ifd0, end)
+	ndata, off = PutTiffIfd(ndata, order, ifd0, inPlace(off))
+	order.PutUint32(ndata[4:], off)
+	return ndata, updts, nil
+}
+
+// SaveTiffUpdated updates the metadata of the TIFF file to reflect the
+// current info, without re-encoding or moving the image data.
+func (pi *Info) SaveTiffUpdated() error {
+	data, err := OpenBytes(pi.File)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	ndata, updts, err := pi.UpdateTiff(data)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if len(updts) == 0 {
+		fmt.Printf("File: %s had no updates to metadata\n", pi.File)
+		return nil
+	}
+	fmt.Printf("File: %s updating Tiff metadata: %v\n", pi.File, updts)
+	err = os.WriteFile(pi.File, ndata, 0664)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	pi.UpdateFileMod()
+	return nil
+}
+
+// tiffImageTags are the IFD0 tags that describe the image data itself,
+// which are written by the image encoder and never copied from other files.
+var tiffImageTags = map[uint16]bool{
+	0x00fe: true, // NewSubfileType
+	0x00ff: true, // SubfileType
+	0x0100: true, // ImageWidth
+	0x0101: true, // ImageLength
+	0x0102: true, // BitsPerSample
+	0x0103: true, // Compression
+	0x0106: true, // PhotometricInterpretation
+	0x0111: true, // StripOffsets
+	0x0115: true, // SamplesPerPixel
+	0x0116: true, // RowsPerStrip
+	0x0117: true, // StripByteCounts
+	0x011a: true, // XResolution
+	0x011b: true, // YResolution
+	0x011c: true, // PlanarConfiguration
+	0x0128: true, // ResolutionUnit
+	0x013d: true, // Predictor
+	0x0140: true, // ColorMap
+	0x0142: true, // TileWidth
+	0x0143: true, // TileLength
+	0x0144: true, // TileOffsets
+	0x0145: true, // TileByteCounts
+	0x014a: true, // SubIFDs
+	0x0152: true, // ExtraSamples
+	0x0153: true, // SampleFormat
+	0x015b: true, // JPEGTables
+	0x0211: true, // YCbCrCoefficients
+	0x0212: true, // YCbCrSubSampling
+	0x0213: true, // YCbCrPositioning
+}
+
+// tiffDataTags are the IFD0 tags that locate the image data, which are
+// not meaningful outside of the file, and can be large for tiled images.
+var tiffDataTags = map[uint16]bool{
+	0x0111: true, // StripOffsets
+	0x0117: true, // StripByteCounts
+	0x0144: true, // TileOffsets
+	0x0145: true, // TileByteCounts
+	0x014a: true, // SubIFDs
+}
+
+// tiffSubIfdTags are the tags that point to metadata sub-IFDs
+var tiffSubIfdTags = []uint16{tiffTagExifIFD, tiffTagGPSIFD, tiffTagInteropIFD}
+
+// copyTiffIfd returns a copy of given IFD from src of given size, converted
+// to the dst byte order, with any metadata sub-IFDs appended to dst and re-pointed.
+func copyTiffIfd(src io.ReaderAt, ssize int64, sorder binary.ByteOrder, ifd *TiffIfd, dst []byte, dorder binary.ByteOrder) ([]byte, *TiffIfd) {
+	nifd := &TiffIfd{}
+	for i := range ifd.Entries {
+		e := &ifd.Entries[i]
+		if e.Data == nil && e.ValOff != 0 {
+			continue // value not read, which cannot be copied
+		}
+		nifd.Entries = append(nifd.Entries, e.ConvertOrder(sorder, dorder))
+	}
+	for _, tag := range tiffSubIfdTags {
+		e := ifd.Entry(tag)
+		if e == nil {
+			continue
+		}
+		sub, err := ReadTiffIfdAt(src, ssize, sorder, e.Uint(sorder, 0))
+		if err != nil {
+			log.Println(err)
+			nifd.Delete(tag)
+			continue
+		}
+		var nsub *TiffIfd
+		dst, nsub = copyTiffIfd(src, ssize, sorder, sub, dst, dorder)
+		nsub.Next = 0
+		var soff uint32
+		dst, soff = AppendTiffIfd(dst, dorder, nsub)
+		nifd.Set(NewTiffLong(dorder, tag, soff))
+	}
+	return dst, nifd
+}
+
+// CopyTiffMeta returns dst TIFF data with all of the metadata tags and
+// sub-IFDs from the first IFD of the src TIFF data copied into its first IFD,
+// leaving the image data of dst as is.  This is used to preserve metadata
+// when re-encoding an image.
+func CopyTiffMeta(dst, src []byte) ([]byte, error) {
+	sorder, soff, err := ReadTiffHeader(src)
+	if err != nil {
+		return dst, err
+	}
+	dorder, doff, err := ReadTiffHeader(dst)
+	if err != nil {
+		return dst, err
+	}
+	sifd, err := ReadTiffIfd(src, sorder, soff)
+	if err != nil {
+		return dst, err
+	}
+	difd, err := ReadTiffIfd(dst, dorder, doff)
+	if err != nil {
+		return dst, err
+	}
+	meta := &TiffIfd{}
+	for _, e := range sifd.Entries {
+		if !tiffImageTags[e.Tag] {
+			meta.Entries = append(meta.Entries, e)
+		}
+	}
+	ndata := append([]byte{}, dst...)
+	ndata, meta = copyTiffIfd(bytes.NewReader(src), int64(len(src)), sorder, meta, ndata, dorder)
+	for _, e := range meta.Entries {
+		if difd.Entry(e.Tag) == nil {
+			difd.Set(e)
+		}
+	}
+	ndata, doff = AppendTiffIfd(ndata, dorder, difd)
+	dorder.PutUint32(ndata[4:], doff)
+	return ndata, nil
+}
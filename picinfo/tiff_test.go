@@ -0,0 +1,167 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"golang.org/x/image/tiff"
+)
+
+// tiffTestTag is a private tag for an entry with its value out of range
+const tiffTestTag = 0xc000
+
+// newTestTiff returns a generated TIFF image and its encoded data, with
+// an entry in IFD0 whose value offset is out of range of the data
+func newTestTiff(t *testing.T) (*image.RGBA, []byte, uint32) {
+	img := image.NewRGBA(image.Rect(0, 0, 37, 23))
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 7), uint8(y * 11), uint8(x * y), 0xff})
+		}
+	}
+	var b bytes.Buffer
+	if err := tiff.Encode(&b, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	order, off, err := ReadTiffHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifd0, err := ReadTiffIfd(data, order, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	voff := uint32(0xfffffff0)
+	ifd0.Set(TiffEntry{Tag: tiffTestTag, Type: tiffLong, Count: 4, ValOff: voff})
+	data, off = AppendTiffIfd(data, order, ifd0)
+	order.PutUint32(data[4:], off)
+	return img, data, voff
+}
+
+func TestReadTiffIfd(t *testing.T) {
+	_, data, voff := newTestTiff(t)
+	order, off, err := ReadTiffHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ifd0, err := ReadTiffIfd(data, order, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := ifd0.Entry(tiffTestTag); e == nil || e.Data != nil || e.ValOff != voff {
+		t.Errorf("out of range entry read as %+v", e)
+	}
+	if e := ifd0.Entry(tiffTagImageWidth); e == nil || e.Uint(order, 0) != 37 {
+		t.Errorf("ImageWidth read as %+v", e)
+	}
+
+	// round trip through AppendTiffIfd
+	ndata, noff := AppendTiffIfd(append([]byte{}, data...), order, ifd0)
+	nifd, err := ReadTiffIfd(ndata, order, noff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nifd.Entries) != len(ifd0.Entries) {
+		t.Fatalf("%d entries written, %d read back", len(ifd0.Entries), len(nifd.Entries))
+	}
+	for i, e := range ifd0.Entries {
+		ne := nifd.Entries[i]
+		if ne.Tag != e.Tag || ne.Type != e.Type || ne.Count != e.Count || !bytes.Equal(ne.Data, e.Data) {
+			t.Errorf("entry 0x%04x read back as %+v, want %+v", e.Tag, ne, e)
+		}
+	}
+
+	// truncated data
+	for _, n := range []int{0, 4, 7, int(off) + 1, int(off) + 13} {
+		if _, _, err := ReadTiffHeader(data[:n]); err == nil && n < 8 {
+			t.Errorf("header truncated to %d bytes read", n)
+		}
+		if _, err := ReadTiffIfd(data[:n], order, off); err == nil {
+			t.Errorf("IFD truncated to %d bytes read", n)
+		}
+	}
+}
+
+func TestUpdateTiff(t *testing.T) {
+	img, data, voff := newTestTiff(t)
+	pi := &Info{
+		DateTaken: time.Date(2019, 7, 4, 13, 14, 15, 0, DefaultZone),
+		Number:    3,
+		Desc:      "first",
+		GPSLoc:    GPSCoord{Lat: 45.5, Long: -122.6, Alt: 30},
+	}
+	descs := []string{"second", "third!"} // same size, so the file should not grow
+	var size int
+	for i := 0; i < 4; i++ {
+		var updts []string
+		var err error
+		data, updts, err = pi.UpdateTiff(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(updts) == 0 {
+			t.Fatalf("update %d: nothing updated", i)
+		}
+		if i == 1 {
+			size = len(data)
+		} else if i > 1 && len(data) > size {
+			t.Errorf("update %d: file grew from %d to %d", i, size, len(data))
+		}
+
+		npi := &Info{}
+		npi.ParseRawExif(data)
+		if npi.Desc != pi.Desc || npi.Number != pi.Number || !npi.DateTaken.Equal(pi.DateTaken) || !npi.GPSLoc.Near(pi.GPSLoc) {
+			t.Errorf("update %d: read back as %q %d %v %v", i, npi.Desc, npi.Number, npi.DateTaken, npi.GPSLoc)
+		}
+
+		order, off, err := ReadTiffHeader(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ifd0, err := ReadTiffIfd(data, order, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := ifd0.Entry(tiffTestTag); e == nil || e.ValOff != voff {
+			t.Errorf("update %d: out of range entry written as %+v", i, e)
+		}
+		if e := ifd0.Entry(tiffTagImageNumber); e == nil || e.Uint(order, 0) != uint32(pi.Number) {
+			t.Errorf("update %d: ImageNumber not in IFD0: %+v", i, e)
+		}
+
+		dimg, err := tiff.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+		if db := dimg.Bounds(); db != img.Bounds() {
+			t.Fatalf("update %d: decoded bounds %v", i, db)
+		}
+		for y := 0; y < 23; y++ {
+			for x := 0; x < 37; x++ {
+				if color.RGBAModel.Convert(dimg.At(x, y)) != img.At(x, y) {
+					t.Fatalf("update %d: pixel %d,%d differs", i, x, y)
+				}
+			}
+		}
+
+		pi.Desc = descs[i%2]
+		pi.Number++
+	}
+
+	// no changes
+	data, _, err := pi.UpdateTiff(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ndata, updts, _ := pi.UpdateTiff(data); len(updts) != 0 || !bytes.Equal(ndata, data) {
+		t.Errorf("unchanged info updated fields %v", updts)
+	}
+}
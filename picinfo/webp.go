@@ -0,0 +1,119 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// reference for the WebP RIFF container, including the EXIF and XMP chunks:
+// https://developers.google.com/speed/webp/docs/riff_container
+
+// WebpChunk is one chunk of a WebP file
+type WebpChunk struct {
+
+	// 4 letter chunk type, e.g., VP8X, VP8L, EXIF, "XMP "
+	Type string
+
+	// chunk data, not including the type and size -- only the start of
+	// the image data chunks is read, which has their size
+	Data []byte
+}
+
+// webpImageHeader is the number of bytes read from the start of the
+// VP8 and VP8L image data chunks, which is enough for the image size
+const webpImageHeader = 10
+
+// IsWebp returns true if given file is a WebP file
+func IsWebp(fn string) bool {
+	return strings.ToLower(filepath.Ext(fn)) == ".webp"
+}
+
+// ReadWebpChunks reads the chunks of a WebP file of given size, without
+// reading the image data, which is most of the file.
+func ReadWebpChunks(r io.ReaderAt, size int64) ([]WebpChunk, error) {
+	hdr, err := readAt(r, size, 0, 12)
+	if err != nil || string(hdr[:4]) != "RIFF" || string(hdr[8:]) != "WEBP" {
+		return nil, errors.New("picinfo.ReadWebpChunks: not a WebP file")
+	}
+	if rsz := int64(binary.LittleEndian.Uint32(hdr[4:])) + 8; rsz < size {
+		size = rsz // ignore anything after the RIFF data
+	}
+	var chunks []WebpChunk
+	pos := int64(12)
+	for pos+8 <= size {
+		ch, err := readAt(r, size, pos, 8)
+		if err != nil {
+			return chunks, err
+		}
+		typ := string(ch[:4])
+		ln := int64(binary.LittleEndian.Uint32(ch[4:]))
+		st := pos + 8
+		if st+ln > size {
+			return chunks, fmt.Errorf("picinfo.ReadWebpChunks: chunk %s truncated", typ)
+		}
+		rl := ln
+		switch typ {
+		case "VP8 ", "VP8L":
+			if rl > webpImageHeader {
+				rl = webpImageHeader
+			}
+		case "ALPH", "ANMF":
+			rl = 0
+		}
+		wc := WebpChunk{Type: typ}
+		wc.Data, err = readAt(r, size, st, int(rl))
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, wc)
+		pos = st + ln + ln%2 // padded to even size
+	}
+	return chunks, nil
+}
+
+// ReadWebp reads the metadata from a WebP file of given size into RawMeta
+func (rm *RawMeta) ReadWebp(r io.ReaderAt, size int64) error {
+	chunks, err := ReadWebpChunks(r, size)
+	if len(chunks) == 0 {
+		return err
+	}
+	for i := range chunks {
+		ch := &chunks[i]
+		d := ch.Data
+		switch ch.Type {
+		case "VP8X": // extended format canvas size, 24 bits each
+			if len(d) >= 10 {
+				rm.Size.X = int(uint32(d[4])|uint32(d[5])<<8|uint32(d[6])<<16) + 1
+				rm.Size.Y = int(uint32(d[7])|uint32(d[8])<<8|uint32(d[9])<<16) + 1
+			}
+		case "VP8 ": // lossy: frame tag, start code, then 14 bit sizes
+			if rm.Size.X == 0 && len(d) >= 10 && d[3] == 0x9d && d[4] == 0x01 && d[5] == 0x2a {
+				rm.Size.X = int(binary.LittleEndian.Uint16(d[6:]) & 0x3fff)
+				rm.Size.Y = int(binary.LittleEndian.Uint16(d[8:]) & 0x3fff)
+			}
+		case "VP8L": // lossless: signature, then 14 bit sizes - 1
+			if rm.Size.X == 0 && len(d) >= 5 && d[0] == 0x2f {
+				bits := binary.LittleEndian.Uint32(d[1:])
+				rm.Size.X = int(bits&0x3fff) + 1
+				rm.Size.Y = int((bits>>14)&0x3fff) + 1
+			}
+		case "EXIF":
+			rm.Exif = bytes.TrimPrefix(d, []byte("Exif\x00\x00"))
+		case "XMP ":
+			rm.XMP = d
+		case "ICCP":
+			rm.ICC = d
+		}
+	}
+	rm.Depth = 8
+	return err
+}
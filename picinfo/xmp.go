@@ -0,0 +1,744 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reference for the XMP standard:
+// https://www.adobe.com/devnet/xmp.html
+// This is a simplified, flat representation: each property is a list of
+// string values (a single value for simple properties).  Structured
+// properties (e.g., mwg-rs:Regions, xmpMM:History) are not modeled, and
+// are kept as their raw XML, which is written back unchanged.
+
+// XMPNamespaces maps standard prefixes to XMP namespace URIs.
+// These prefixes are always used for the keys in XMP.Props.
+var XMPNamespaces = map[string]string{
+	"x":         "adobe:ns:meta/",
+	"rdf":       "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+	"dc":        "http://purl.org/dc/elements/1.1/",
+	"xmp":       "http://ns.adobe.com/xap/1.0/",
+	"exif":      "http://ns.adobe.com/exif/1.0/",
+	"tiff":      "http://ns.adobe.com/tiff/1.0/",
+	"photoshop": "http://ns.adobe.com/photoshop/1.0/",
+	"lr":        "http://ns.adobe.com/lightroom/1.0/",
+	"aux":       "http://ns.adobe.com/exif/1.0/aux/",
+	"exifEX":    "http://cipa.jp/exif/1.0/",
+	"gopix":     "https://goki.dev/gopix/ns/1.0/",
+}
+
+// XMPListKinds are the rdf container types for list-valued properties
+// that we write -- any property not listed here is written as a simple value
+// unless it was read as a list.
+var XMPListKinds = map[string]string{
+	"dc:description":         "Alt",
+	"dc:subject":             "Bag",
+	"lr:hierarchicalSubject": "Bag",
+	"gopix:UserFields":       "Bag",
+}
+
+// XMP is a flattened XMP metadata packet
+type XMP struct {
+
+	// property values, keyed by prefix:Name -- simple properties have one value
+	Props map[string][]string
+
+	// rdf container kind (Seq, Bag, Alt) for list-valued properties
+	Kinds map[string]string
+
+	// prefixes for any non-standard namespaces that were read, keyed by URI
+	NS map[string]string
+
+	// raw XML of the structured properties that are not modeled, keyed by
+	// prefix:Name, including the namespace declarations it uses
+	Raw map[string]string
+}
+
+// NewXMP returns a new empty XMP
+func NewXMP() *XMP {
+	x := &XMP{}
+	x.Props = make(map[string][]string)
+	x.Kinds = make(map[string]string)
+	x.NS = make(map[string]string)
+	x.Raw = make(map[string]string)
+	return x
+}
+
+// Get returns the first value for given property, and whether it exists
+func (x *XMP) Get(prop string) (string, bool) {
+	vl, has := x.Props[prop]
+	if !has || len(vl) == 0 {
+		return "", false
+	}
+	return vl[0], true
+}
+
+// List returns all values for given property
+func (x *XMP) List(prop string) []string {
+	return x.Props[prop]
+}
+
+// Set sets given property to given simple value, returning true if it changed.
+func (x *XMP) Set(prop, val string) bool {
+	cv, has := x.Get(prop)
+	if has && cv == val && len(x.Props[prop]) == 1 {
+		return false
+	}
+	x.Props[prop] = []string{val}
+	delete(x.Raw, prop)
+	return true
+}
+
+// SetList sets given property to given list of values, returning true if it changed.
+// Setting an empty list deletes the property.
+func (x *XMP) SetList(prop string, vals []string) bool {
+	if len(vals) == 0 {
+		return x.Delete(prop)
+	}
+	cv := x.Props[prop]
+	same := len(cv) == len(vals)
+	if same {
+		for i := range cv {
+			if cv[i] != vals[i] {
+				same = false
+				break
+			}
+		}
+	}
+	x.Props[prop] = append([]string{}, vals...)
+	delete(x.Raw, prop)
+	if _, has := x.Kinds[prop]; !has {
+		kd, ok := XMPListKinds[prop]
+		if !ok {
+			kd = "Bag"
+		}
+		x.Kinds[prop] = kd
+	}
+	return !same
+}
+
+// Delete deletes given property, returning true if it existed
+func (x *XMP) Delete(prop string) bool {
+	_, has := x.Props[prop]
+	_, hasRaw := x.Raw[prop]
+	delete(x.Props, prop)
+	delete(x.Kinds, prop)
+	delete(x.Raw, prop)
+	return has || hasRaw
+}
+
+// prefix returns the prefix to use for given namespace URI
+func (x *XMP) prefix(uri string) string {
+	for pf, ns := range XMPNamespaces {
+		if ns == uri {
+			return pf
+		}
+	}
+	if pf, has := x.NS[uri]; has {
+		return pf
+	}
+	return ""
+}
+
+// nsURI returns the namespace URI for given prefix
+func (x *XMP) nsURI(pf string) string {
+	if ns, has := XMPNamespaces[pf]; has {
+		return ns
+	}
+	for ns, p := range x.NS {
+		if p == pf {
+			return ns
+		}
+	}
+	return ""
+}
+
+// ParseXMP parses an XMP packet into a new XMP
+func ParseXMP(data []byte) (*XMP, error) {
+	x := NewXMP()
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	decls := map[string]string{} // namespace declarations as written, by prefix
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return x, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		x.addNS(se, decls)
+		if se.Name.Space == XMPNamespaces["rdf"] && se.Name.Local == "Description" {
+			err = x.parseDesc(d, se, data, decls)
+			if err != nil {
+				return x, err
+			}
+		}
+	}
+	return x, nil
+}
+
+// addNS records the namespaces declared on given element, in NS for any
+// non-standard ones, and in decls by the prefix as written
+func (x *XMP) addNS(se xml.StartElement, decls map[string]string) {
+	for _, at := range se.Attr {
+		if at.Name.Space != "xmlns" {
+			continue
+		}
+		decls[at.Name.Local] = at.Value
+		if x.prefix(at.Value) == "" {
+			x.NS[at.Value] = at.Name.Local
+		}
+	}
+}
+
+// parseDesc parses one rdf:Description element, in the packet data
+func (x *XMP) parseDesc(d *xml.Decoder, se xml.StartElement, data []byte, decls map[string]string) error {
+	for _, at := range se.Attr {
+		if at.Name.Space == "xmlns" || at.Name.Space == XMPNamespaces["rdf"] || at.Name.Space == "" {
+			continue
+		}
+		pf := x.prefix(at.Name.Space)
+		if pf == "" {
+			continue
+		}
+		x.Props[pf+":"+at.Name.Local] = []string{at.Value}
+	}
+	for {
+		start := d.InputOffset()
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			x.addNS(t, decls)
+			vals, kind, ok, err := x.parseProp(d, t)
+			if err != nil {
+				return err
+			}
+			pf := x.prefix(t.Name.Space)
+			if pf == "" {
+				continue
+			}
+			key := pf + ":" + t.Name.Local
+			if !ok {
+				x.Raw[key] = xmpRawProp(string(data[start:d.InputOffset()]), decls)
+				continue
+			}
+			x.Props[key] = vals
+			if kind != "" {
+				x.Kinds[key] = kind
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// xmpRawProp returns the raw XML of a property element with declarations
+// added to it for the namespaces in decls that it uses, so it is
+// self-contained
+func xmpRawProp(raw string, decls map[string]string) string {
+	end := strings.IndexAny(raw, " \t\r\n/>")
+	if end < 0 {
+		return raw
+	}
+	pfs := make([]string, 0, len(decls))
+	for pf := range decls {
+		pfs = append(pfs, pf)
+	}
+	sort.Strings(pfs)
+	var b strings.Builder
+	b.WriteString(raw[:end])
+	for _, pf := range pfs {
+		if !strings.Contains(raw, pf+":") || strings.Contains(raw, "xmlns:"+pf+"=") {
+			continue
+		}
+		if (pf == "x" || pf == "rdf") && decls[pf] == XMPNamespaces[pf] {
+			continue // always declared by Bytes
+		}
+		fmt.Fprintf(&b, " xmlns:%s=\"", pf)
+		xml.EscapeText(&b, []byte(decls[pf]))
+		b.WriteString("\"")
+	}
+	b.WriteString(raw[end:])
+	return b.String()
+}
+
+// parseProp parses one property element, returning its values, the
+// container kind if a list, and false if it is a structured value that
+// is not supported.
+func (x *XMP) parseProp(d *xml.Decoder, se xml.StartElement) (vals []string, kind string, ok bool, err error) {
+	ok = true
+	for _, at := range se.Attr {
+		switch {
+		case at.Name.Space == XMPNamespaces["rdf"] && at.Name.Local == "resource":
+			vals = []string{at.Value}
+		case at.Name.Space == "xmlns" || at.Name.Space == "xml" || at.Name.Space == xmlNS:
+		default:
+			ok = false // rdf:parseType or struct fields as attributes
+		}
+	}
+	var cd strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, "", false, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			cd.Write(t)
+		case xml.StartElement:
+			if t.Name.Space == XMPNamespaces["rdf"] {
+				switch t.Name.Local {
+				case "Seq", "Bag", "Alt":
+					kind = t.Name.Local
+					continue
+				case "li":
+					for _, at := range t.Attr {
+						if at.Name.Space != "xml" && at.Name.Space != xmlNS && at.Name.Space != "xmlns" {
+							ok = false // struct fields as attributes
+						}
+					}
+					var li strings.Builder
+					for {
+						ltok, err := d.Token()
+						if err != nil {
+							return nil, "", false, err
+						}
+						if lcd, isc := ltok.(xml.CharData); isc {
+							li.Write(lcd)
+							continue
+						}
+						if _, ise := ltok.(xml.StartElement); ise {
+							ok = false
+							d.Skip()
+							continue
+						}
+						if _, isee := ltok.(xml.EndElement); isee {
+							break
+						}
+					}
+					vals = append(vals, strings.TrimSpace(li.String()))
+					continue
+				}
+			}
+			ok = false // structure -- not supported
+			d.Skip()
+		case xml.EndElement:
+			if t.Name == se.Name {
+				if kind == "" && vals == nil {
+					vals = []string{strings.TrimSpace(cd.String())}
+				}
+				return vals, kind, ok, nil
+			}
+		}
+	}
+}
+
+// xmlNS is the namespace URI of the xml: prefix, e.g., for xml:lang
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// Bytes returns the XMP encoded as a standard XMP packet
+func (x *XMP) Bytes() []byte {
+	keys := make([]string, 0, len(x.Props))
+	pfs := map[string]bool{}
+	for k := range x.Props {
+		keys = append(keys, k)
+		pf, _, _ := strings.Cut(k, ":")
+		pfs[pf] = true
+	}
+	for k := range x.Raw {
+		if _, has := x.Props[k]; !has {
+			keys = append(keys, k) // declares its own namespaces
+		}
+	}
+	sort.Strings(keys)
+	pfl := make([]string, 0, len(pfs))
+	for pf := range pfs {
+		pfl = append(pfl, pf)
+	}
+	sort.Strings(pfl)
+
+	var b bytes.Buffer
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	fmt.Fprintf(&b, " <rdf:RDF xmlns:rdf=\"%s\">\n", XMPNamespaces["rdf"])
+	b.WriteString("  <rdf:Description rdf:about=\"\"")
+	for _, pf := range pfl {
+		fmt.Fprintf(&b, "\n    xmlns:%s=\"%s\"", pf, x.nsURI(pf))
+	}
+	b.WriteString(">\n")
+	for _, k := range keys {
+		if raw, has := x.Raw[k]; has && x.Props[k] == nil {
+			fmt.Fprintf(&b, "   %s\n", raw)
+			continue
+		}
+		vals := x.Props[k]
+		kind, has := x.Kinds[k]
+		if !has {
+			kind = XMPListKinds[k]
+		}
+		if kind == "" {
+			fmt.Fprintf(&b, "   <%s>", k)
+			if len(vals) > 0 {
+				xml.EscapeText(&b, []byte(vals[0]))
+			}
+			fmt.Fprintf(&b, "</%s>\n", k)
+			continue
+		}
+		fmt.Fprintf(&b, "   <%s>\n    <rdf:%s>\n", k, kind)
+		for _, v := range vals {
+			if kind == "Alt" {
+				b.WriteString("     <rdf:li xml:lang=\"x-default\">")
+			} else {
+				b.WriteString("     <rdf:li>")
+			}
+			xml.EscapeText(&b, []byte(v))
+			b.WriteString("</rdf:li>\n")
+		}
+		fmt.Fprintf(&b, "    </rdf:%s>\n   </%s>\n", kind, k)
+	}
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+///////////////////////////////////////////////////////////////////////////////
+//  Info <-> XMP
+
+// XMPDateFmt is the format used for writing XMP dates
+var XMPDateFmt = "2006-01-02T15:04:05"
+
+// XMPDateParser parses an XMP (ISO 8601) date string, returning true if
+// it has a time zone -- otherwise it is a local time in DefaultZone.
+func XMPDateParser(ds string) (time.Time, bool, error) {
+	zfmts := []string{time.RFC3339Nano, time.RFC3339, "2006-01-02T15:04Z07:00"}
+	var err error
+	for _, ft := range zfmts {
+		var dt time.Time
+		dt, err = time.Parse(ft, ds)
+		if err == nil {
+			return dt, true, nil
+		}
+	}
+	fmts := []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+	for _, ft := range fmts {
+		var dt time.Time
+		dt, err = time.ParseInLocation(ft, ds, DefaultZone)
+		if err == nil {
+			return dt, false, nil
+		}
+	}
+	return time.Time{}, false, err
+}
+
+// XMPDateTaken returns the XMP date string for DateTaken, including
+// the time zone offset if known
+func (pi *Info) XMPDateTaken() string {
+	if pi.HasZone() {
+		return pi.DateTaken.Format(XMPDateFmt + ExifOffsetFmt)
+	}
+	return pi.DateTaken.Format(XMPDateFmt)
+}
+
+// XMPGPSCleared is the XMP property set in a sidecar file when the GPS
+// info has been cleared, which overrides any GPS info embedded in the
+// original file, as that is not changed
+const XMPGPSCleared = "gopix:GPSCleared"
+
+// XMPRejectedRating is the XMP property holding the star rating of a
+// rejected image, as its xmp:Rating is -1, which marks rejects for other
+// tools, so the rating is kept when the reject is cleared
+const XMPRejectedRating = "gopix:Rating"
+
+// xmpGPSProps are the XMP GPS properties, which are all deleted
+// when the GPS info is cleared
+var xmpGPSProps = []string{"exif:GPSVersionID", "exif:GPSLatitude", "exif:GPSLongitude", "exif:GPSAltitude", "exif:GPSAltitudeRef", "exif:GPSTimeStamp", "exif:GPSImgDirection", "exif:GPSImgDirectionRef", "exif:GPSSpeed", "exif:GPSSpeedRef", "exif:GPSDestBearing", "exif:GPSDestBearingRef", "exif:GPSMapDatum"}
+
+// XMPGPSCoord returns the XMP GPSCoordinate string (DDD,MM.mmmmmmK) for
+// given decimal degrees, using pos or neg as the direction reference.
+func XMPGPSCoord(deg float64, pos, neg byte) string {
+	ref := pos
+	if deg < 0 {
+		ref = neg
+		deg = -deg
+	}
+	dg := math.Floor(deg)
+	mn := (deg - dg) * 60
+	return fmt.Sprintf("%d,%.6f%c", int(dg), mn, ref)
+}
+
+// ParseXMPGPSCoord parses an XMP GPSCoordinate string, in either
+// DDD,MM,SSk or DDD,MM.mmk format, returning decimal degrees.
+func ParseXMPGPSCoord(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return 0, fmt.Errorf("picinfo.ParseXMPGPSCoord: invalid coordinate: %q", s)
+	}
+	ref := s[len(s)-1]
+	sign := 1.0
+	switch ref {
+	case 'N', 'E', 'n', 'e':
+		s = s[:len(s)-1]
+	case 'S', 'W', 's', 'w':
+		sign = -1
+		s = s[:len(s)-1]
+	}
+	parts := strings.Split(s, ",")
+	var dms [3]float64
+	for i, p := range parts {
+		if i >= 3 {
+			break
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return 0, fmt.Errorf("picinfo.ParseXMPGPSCoord: invalid coordinate: %q: %w", s, err)
+		}
+		dms[i] = v
+	}
+	return sign * DecDegFromDMS(dms[0], dms[1], dms[2]), nil
+}
+
+// parseXMPRational parses an XMP rational (n/d) or plain number
+func parseXMPRational(s string) float64 {
+	if n, d, has := strings.Cut(s, "/"); has {
+		nv, _ := strconv.ParseFloat(n, 64)
+		dv, _ := strconv.ParseFloat(d, 64)
+		if dv == 0 {
+			return 0
+		}
+		return nv / dv
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+// SetFromXMP sets Info fields from any corresponding properties present
+// in given XMP, overriding existing values (e.g., from the Exif).
+func (pi *Info) SetFromXMP(x *XMP) {
+	fnbase := pi.FileBase()
+	for _, prop := range []string{"exif:DateTimeOriginal", "xmp:CreateDate", "photoshop:DateCreated"} {
+		ds, has := x.Get(prop)
+		if !has || ds == "" {
+			continue
+		}
+		dt, hasZone, err := XMPDateParser(ds)
+		if err != nil {
+			log.Printf("File: %s %s err: %v\n", fnbase, prop, err)
+			continue
+		}
+		switch {
+		case hasZone:
+			pi.DateTaken = WallClockIn(dt, FixedZone(ZoneOffset(dt)))
+			pi.ZoneSrc = ZoneMeta
+		case pi.HasZone(): // keep zone from the exif
+			pi.DateTaken = WallClockIn(dt, pi.DateTaken.Location())
+		default:
+			pi.DateTaken = dt
+		}
+		break
+	}
+	if ors, has := x.Get("tiff:Orientation"); has {
+		if ov, err := strconv.Atoi(ors); err == nil && ov > 0 && ov < int(OrientUndef) {
+			pi.Orient = Orientations(ov)
+		}
+	}
+	if ds, has := x.Get("dc:description"); has {
+		pi.Desc = ds
+	}
+	if rs, has := x.Get("xmp:Rating"); has {
+		if rv, err := strconv.Atoi(strings.TrimSpace(rs)); err == nil {
+			if rv < 0 {
+				pi.Pick = Rejected
+				if ss, has := x.Get(XMPRejectedRating); has {
+					if sv, err := strconv.Atoi(strings.TrimSpace(ss)); err == nil {
+						pi.SetRating(sv)
+					}
+				}
+			} else {
+				pi.SetRating(rv)
+			}
+		}
+	}
+	if ps, has := x.Get("gopix:Pick"); has {
+		var pk Picks
+		if err := pk.FromString(ps); err == nil {
+			pi.Pick = pk
+		}
+	}
+	if ls, has := x.Get("xmp:Label"); has {
+		pi.Label = LabelFromXMPName(ls)
+	}
+	pi.setCameraFromXMP(x)
+	if hl := x.List("lr:hierarchicalSubject"); len(hl) > 0 {
+		pi.setKeywords(hl)
+	} else if sl := x.List("dc:subject"); len(sl) > 0 {
+		pi.setKeywords(sl)
+	}
+	if gc, has := x.Get(XMPGPSCleared); has && gc == "True" {
+		pi.ClearGPS()
+	}
+	if lat, has := x.Get("exif:GPSLatitude"); has {
+		if v, err := ParseXMPGPSCoord(lat); err == nil {
+			pi.GPSLoc.Lat = v
+		}
+	}
+	if long, has := x.Get("exif:GPSLongitude"); has {
+		if v, err := ParseXMPGPSCoord(long); err == nil {
+			pi.GPSLoc.Long = v
+		}
+	}
+	if alt, has := x.Get("exif:GPSAltitude"); has {
+		pi.GPSLoc.Alt = parseXMPRational(alt)
+		if ar, has := x.Get("exif:GPSAltitudeRef"); has && ar == "1" {
+			pi.GPSLoc.Alt = -pi.GPSLoc.Alt
+		}
+	}
+	if ufl := x.List("gopix:UserFields"); len(ufl) > 0 {
+		pi.User = make(map[string]string, len(ufl))
+		for _, uf := range ufl {
+			k, v, _ := strings.Cut(uf, "=")
+			pi.User[k] = v
+		}
+	}
+	pi.Edits.SetFromXMP(x)
+}
+
+// setCameraFromXMP sets the camera and lens info from XMP, which is
+// only read, as it is not edited
+func (pi *Info) setCameraFromXMP(x *XMP) {
+	get := func(props ...string) (string, bool) {
+		for _, prop := range props {
+			if v, has := x.Get(prop); has && v != "" {
+				return strings.TrimSpace(v), true
+			}
+		}
+		return "", false
+	}
+	if v, has := get("tiff:Make"); has {
+		pi.Camera.Make = v
+	}
+	if v, has := get("tiff:Model"); has {
+		pi.Camera.Model = v
+	}
+	if v, has := get("exifEX:BodySerialNumber", "aux:SerialNumber"); has {
+		pi.Camera.Serial = v
+	}
+	if v, has := get("exifEX:LensMake"); has {
+		pi.Lens.Make = v
+	}
+	if v, has := get("exifEX:LensModel", "aux:Lens"); has {
+		pi.Lens.Model = v
+	}
+	if v, has := get("exifEX:LensSerialNumber", "aux:LensSerialNumber"); has {
+		pi.Lens.Serial = v
+	}
+	if v, has := get("xmp:CreatorTool", "tiff:Software"); has {
+		pi.Software = v
+	}
+}
+
+// HasXMPOnly returns true if the Info has any values that can only be
+// represented in XMP metadata, which is then embedded in files that
+// do not otherwise have it (e.g., Jpeg)
+func (pi *Info) HasXMPOnly() bool {
+	return len(pi.Keywords) > 0 || len(pi.User) > 0 || pi.Rating != 0 || pi.Pick != Unflagged || pi.Label != NoLabel || !pi.Edits.IsZero()
+}
+
+// UpdateXMP updates given XMP with the current Info values, retaining
+// any other properties.  Returns the list of Info fields that were
+// different and require saving (empty if nothing changed).
+func (pi *Info) UpdateXMP(x *XMP) []string {
+	var updts []string
+	updt := func(field string, chg bool) {
+		if chg {
+			updts = append(updts, field)
+		}
+	}
+	if !pi.DateTaken.IsZero() {
+		updt("DateTaken", x.Set("exif:DateTimeOriginal", pi.XMPDateTaken()))
+	}
+	if pi.Orient != NoOrient {
+		updt("Orient", x.Set("tiff:Orientation", strconv.Itoa(int(pi.Orient))))
+	}
+	if pi.Desc != "" {
+		updt("Desc", x.SetList("dc:description", []string{pi.Desc}))
+	} else {
+		updt("Desc", x.Delete("dc:description"))
+	}
+	var rchg bool
+	switch {
+	case pi.Pick == Rejected:
+		rchg = x.Set("xmp:Rating", "-1")
+	case pi.Rating > 0:
+		rchg = x.Set("xmp:Rating", strconv.Itoa(pi.Rating))
+	default:
+		rchg = x.Delete("xmp:Rating")
+	}
+	if pi.Pick == Rejected && pi.Rating > 0 {
+		rchg = x.Set(XMPRejectedRating, strconv.Itoa(pi.Rating)) || rchg
+	} else {
+		rchg = x.Delete(XMPRejectedRating) || rchg
+	}
+	updt("Rating", rchg)
+	if pi.Pick != Unflagged {
+		updt("Pick", x.Set("gopix:Pick", pi.Pick.String()))
+	} else {
+		updt("Pick", x.Delete("gopix:Pick"))
+	}
+	if pi.Label != NoLabel {
+		updt("Label", x.Set("xmp:Label", pi.Label.XMPName()))
+	} else {
+		updt("Label", x.Delete("xmp:Label"))
+	}
+	chg := x.SetList("dc:subject", pi.KeywordLeaves())
+	if _, has := x.Props["lr:hierarchicalSubject"]; has || pi.HasHierKeywords() {
+		chg = x.SetList("lr:hierarchicalSubject", pi.Keywords) || chg
+	}
+	updt("Keywords", chg)
+	if pi.HasGPS() {
+		chg := x.Set("exif:GPSLatitude", XMPGPSCoord(pi.GPSLoc.Lat, 'N', 'S'))
+		chg = x.Set("exif:GPSLongitude", XMPGPSCoord(pi.GPSLoc.Long, 'E', 'W')) || chg
+		ar := "0"
+		if pi.GPSLoc.Alt < 0 {
+			ar = "1"
+		}
+		chg = x.Set("exif:GPSAltitude", fmt.Sprintf("%d/1000", int64(math.Round(math.Abs(pi.GPSLoc.Alt)*1000)))) || chg
+		chg = x.Set("exif:GPSAltitudeRef", ar) || chg
+		chg = x.Delete(XMPGPSCleared) || chg
+		updt("GPSLoc", chg)
+	} else {
+		chg := false
+		for _, prop := range xmpGPSProps {
+			chg = x.Delete(prop) || chg
+		}
+		updt("GPSLoc", chg)
+	}
+	ufl := make([]string, 0, len(pi.User))
+	for k, v := range pi.User {
+		ufl = append(ufl, k+"="+v)
+	}
+	sort.Strings(ufl)
+	updt("User", x.SetList("gopix:UserFields", ufl))
+	updt("Edits", pi.Edits.UpdateXMP(x))
+	return updts
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// xmpRoundTrip returns the Info read back from the XMP updated from pi
+func xmpRoundTrip(t *testing.T, pi *Info) *Info {
+	x := NewXMP()
+	pi.UpdateXMP(x)
+	px, err := ParseXMP(x.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	npi := &Info{}
+	npi.SetFromXMP(px)
+	return npi
+}
+
+func TestXMPRejectRating(t *testing.T) {
+	pi := &Info{Rating: 3, Pick: Rejected}
+	x := NewXMP()
+	pi.UpdateXMP(x)
+	if rs, _ := x.Get("xmp:Rating"); rs != "-1" {
+		t.Errorf("rejected xmp:Rating = %q, want -1", rs)
+	}
+	npi := xmpRoundTrip(t, pi)
+	if npi.Pick != Rejected || npi.Rating != 3 {
+		t.Errorf("rejected read back as %v with rating %d, want Rejected with 3", npi.Pick, npi.Rating)
+	}
+
+	npi.SetPick(Unflagged)
+	npi = xmpRoundTrip(t, npi)
+	if npi.Pick != Unflagged || npi.Rating != 3 {
+		t.Errorf("unrejected read back as %v with rating %d, want Unflagged with 3", npi.Pick, npi.Rating)
+	}
+
+	// a reject from another tool, without a kept rating
+	x = NewXMP()
+	x.Set("xmp:Rating", "-1")
+	npi = &Info{}
+	npi.SetFromXMP(x)
+	if npi.Pick != Rejected || npi.Rating != 0 {
+		t.Errorf("external reject read as %v with rating %d, want Rejected with 0", npi.Pick, npi.Rating)
+	}
+}
+
+// xmpStructPacket has structured properties, with the namespaces declared
+// on x:xmpmeta and rdf:RDF, as well as on the rdf:Description elements
+const xmpStructPacket = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+   xmlns:mwg-rs="http://www.metadataworkinggroup.com/schemas/regions/"
+   xmlns:stDim="http://ns.adobe.com/xap/1.0/sType/Dimensions#"
+   xmlns:stArea="http://ns.adobe.com/xmp/sType/Area#">
+  <rdf:Description rdf:about="" xmp:Rating="3"
+    xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>cat</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <mwg-rs:Regions rdf:parseType="Resource">
+    <mwg-rs:AppliedToDimensions stDim:w="4000" stDim:h="3000" stDim:unit="pixel"/>
+    <mwg-rs:RegionList>
+     <rdf:Bag>
+      <rdf:li>
+       <rdf:Description mwg-rs:Name="Tom" mwg-rs:Type="Face">
+        <mwg-rs:Area stArea:x="0.5" stArea:y="0.4" stArea:w="0.1" stArea:h="0.2" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+     </rdf:Bag>
+    </mwg-rs:RegionList>
+   </mwg-rs:Regions>
+  </rdf:Description>
+  <rdf:Description rdf:about=""
+    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"
+    xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#">
+   <xmpMM:DocumentID>xmp.did:1234</xmpMM:DocumentID>
+   <xmpMM:History>
+    <rdf:Seq>
+     <rdf:li stEvt:action="saved" stEvt:when="2020-01-02T03:04:05Z"/>
+     <rdf:li rdf:parseType="Resource">
+      <stEvt:action>derived</stEvt:action>
+      <stEvt:parameters>converted from raw</stEvt:parameters>
+     </rdf:li>
+    </rdf:Seq>
+   </xmpMM:History>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+// xmpResolved checks that all of the element and attribute names in the
+// packet have declared namespaces, returning the local names of the elements
+func xmpResolved(t *testing.T, data []byte) []string {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var names []string
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		names = append(names, se.Name.Local)
+		for _, n := range append([]xml.Name{se.Name}, func() []xml.Name {
+			var an []xml.Name
+			for _, at := range se.Attr {
+				an = append(an, at.Name)
+			}
+			return an
+		}()...) {
+			if n.Space != "" && n.Space != "xmlns" && !strings.Contains(n.Space, "/") {
+				t.Errorf("undeclared namespace prefix %q in %s:%s", n.Space, n.Space, n.Local)
+			}
+		}
+	}
+}
+
+func TestXMPStructRoundTrip(t *testing.T) {
+	x, err := ParseXMP([]byte(xmpStructPacket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs, _ := x.Get("xmp:Rating"); rs != "3" {
+		t.Errorf("xmp:Rating = %q, want 3", rs)
+	}
+	if ds, _ := x.Get("xmpMM:DocumentID"); ds != "xmp.did:1234" {
+		t.Errorf("xmpMM:DocumentID = %q", ds)
+	}
+	if sl := x.List("dc:subject"); len(sl) != 1 || sl[0] != "cat" {
+		t.Errorf("dc:subject = %v", sl)
+	}
+	for _, k := range []string{"mwg-rs:Regions", "xmpMM:History"} {
+		if _, has := x.Raw[k]; !has {
+			t.Fatalf("%s not kept", k)
+		}
+	}
+
+	x.Set("xmp:Rating", "4")
+	out := x.Bytes()
+	names := strings.Join(xmpResolved(t, out), " ")
+	for _, n := range []string{"Regions AppliedToDimensions RegionList Bag li Description Area", "History Seq li li action parameters"} {
+		if !strings.Contains(names, n) {
+			t.Errorf("elements %q not written back: %s", n, names)
+		}
+	}
+	for _, v := range []string{`stArea:x="0.5"`, `mwg-rs:Name="Tom"`, `stEvt:when="2020-01-02T03:04:05Z"`, "converted from raw"} {
+		if !bytes.Contains(out, []byte(v)) {
+			t.Errorf("%s not written back", v)
+		}
+	}
+
+	// unchanged by another round trip
+	nx, err := ParseXMP(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs, _ := nx.Get("xmp:Rating"); rs != "4" {
+		t.Errorf("xmp:Rating = %q, want 4", rs)
+	}
+	if nout := nx.Bytes(); !bytes.Equal(nout, out) {
+		t.Errorf("second round trip differs:\n%s\n----\n%s", nout, out)
+	}
+
+	// a structured property can be deleted
+	nx.Delete("xmpMM:History")
+	if bytes.Contains(nx.Bytes(), []byte("History")) {
+		t.Error("deleted xmpMM:History written back")
+	}
+}
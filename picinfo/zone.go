@@ -0,0 +1,140 @@
+// Copyright (c) 2020, The Goki Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package picinfo
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/goki/ki/kit"
+)
+
+// Exif dates are local wall-clock times, with the offset from UTC recorded
+// separately in the OffsetTime tags (Exif 2.31), as "+09:00".  Older cameras
+// don't record the offset, in which case it can be derived from the GPS
+// time, which is always UTC.  DateTaken carries the zone as its Location,
+// so it always represents the actual instant the picture was taken, while
+// formatting it gives the local time where it was taken.
+
+// DefaultZone is the location used for dates without any time zone info,
+// which are typically taken at home.
+var DefaultZone = time.Local
+
+// ZoneSources are the sources of the time zone of DateTaken
+type ZoneSources int
+
+const (
+	// NoZone means there is no time zone info: DateTaken is the local
+	// wall-clock time interpreted in DefaultZone
+	NoZone ZoneSources = iota
+
+	// ZoneMeta means the offset is recorded in the metadata, e.g., in the
+	// Exif OffsetTimeOriginal tag or the XMP date
+	ZoneMeta
+
+	// ZoneGPS means the offset was derived from the GPS time
+	ZoneGPS
+
+	ZoneSourcesN
+)
+
+//go:generate stringer -type=ZoneSources
+
+var KiT_ZoneSources = kit.Enums.AddEnum(ZoneSourcesN, kit.NotBitFlag, nil)
+
+func (ev ZoneSources) MarshalJSON() ([]byte, error)  { return kit.EnumMarshalJSON(ev) }
+func (ev *ZoneSources) UnmarshalJSON(b []byte) error { return kit.EnumUnmarshalJSON(ev, b) }
+
+// ExifOffsetFmt is the format of the Exif OffsetTime tags
+var ExifOffsetFmt = "-07:00"
+
+// ExifDateFmt is the format of Exif dates
+var ExifDateFmt = "2006:01:02 15:04:05"
+
+// ExifDateString returns the Exif date string for given time, which is
+// the wall-clock time in the location of the time (not UTC).
+func ExifDateString(t time.Time) string {
+	return t.Format(ExifDateFmt)
+}
+
+// ExifOffsetParser parses an Exif OffsetTime value, e.g., "+09:00",
+// returning the offset in seconds east of UTC.
+func ExifOffsetParser(ofs string) (int, error) {
+	var sign byte
+	var hr, mn int
+	_, err := fmt.Sscanf(ofs, "%c%02d:%02d", &sign, &hr, &mn)
+	if err != nil || (sign != '+' && sign != '-') || hr > 14 || mn > 59 {
+		return 0, fmt.Errorf("picinfo.ExifOffsetParser: invalid offset: %q", ofs)
+	}
+	off := hr*3600 + mn*60
+	if sign == '-' {
+		off = -off
+	}
+	return off, nil
+}
+
+// ZoneOffset returns the offset in seconds east of UTC of given time
+func ZoneOffset(t time.Time) int {
+	_, off := t.Zone()
+	return off
+}
+
+// FixedZone returns a fixed time zone location for given offset in seconds
+// east of UTC, named by the offset, e.g., "+09:00"
+func FixedZone(off int) *time.Location {
+	return time.FixedZone(time.Unix(0, 0).In(time.FixedZone("", off)).Format(ExifOffsetFmt), off)
+}
+
+// WallClockIn returns the time with the same wall-clock time as given time,
+// in given location -- i.e., the time is re-interpreted, not converted.
+func WallClockIn(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// GPSZoneOffset returns the time zone offset in seconds east of UTC implied by
+// the difference between the wall-clock date taken and the UTC GPS date,
+// rounded to the nearest quarter hour to allow for a stale GPS fix or
+// camera clock drift.  Returns false if the difference is not a valid offset.
+func GPSZoneOffset(dt, gps time.Time) (int, bool) {
+	if dt.IsZero() || gps.IsZero() {
+		return 0, false
+	}
+	d := WallClockIn(dt, time.UTC).Sub(gps)
+	qh := 15 * time.Minute
+	off := int(math.Round(float64(d)/float64(qh))) * int(qh/time.Second)
+	if off < -12*3600 || off > 14*3600 {
+		return 0, false
+	}
+	return off, true
+}
+
+// SetZone sets the time zone of DateTaken to given offset in seconds east
+// of UTC, keeping its wall-clock time, and records the source of the zone.
+func (pi *Info) SetZone(off int, src ZoneSources) {
+	pi.DateTaken = WallClockIn(pi.DateTaken, FixedZone(off))
+	pi.ZoneSrc = src
+}
+
+// HasZone returns true if the time zone of DateTaken is known
+func (pi *Info) HasZone() bool {
+	return pi.ZoneSrc != NoZone
+}
+
+// zoneDiffers returns true if the known time zone of DateTaken differs from
+// that of given current info, e.g., as recorded in the file.
+func (pi *Info) zoneDiffers(ci *Info) bool {
+	return pi.HasZone() && (!ci.HasZone() || ZoneOffset(pi.DateTaken) != ZoneOffset(ci.DateTaken))
+}
+
+// SetDefaultZone re-interprets DateTaken in DefaultZone if it has no known
+// time zone.  This is needed for dates decoded from JSON, which only records
+// the offset, and from info saved before time zones were supported, where
+// the wall-clock time was stored as UTC.
+func (pi *Info) SetDefaultZone() {
+	if pi.ZoneSrc == NoZone && !pi.DateTaken.IsZero() {
+		pi.DateTaken = WallClockIn(pi.DateTaken, DefaultZone)
+	}
+}